@@ -0,0 +1,136 @@
+// Optional access log: one entry for each HTTP request, saying what was asked, where in-world it came
+// from (Second Life and OpenSimulator tell us in their X-Secondlife-* headers), how it went, and how long
+// it took. Until now, requests were only logged when something went wrong, so there was no way of knowing
+// which regions and objects were actually using the service.
+// What to do with the entries (write them somewhere, as text or JSON...) is up to whoever passes
+// WithAccessLog; see cmd/gosl-basics for one way of doing it. gRPC and the Redis protocol are not logged.
+package gosl
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AccessEntry is what gets logged for each request.
+type AccessEntry struct {
+	Time		time.Time			`json:"time"`					// when the request arrived.
+	RemoteAddr	string				`json:"remoteAddr"`
+	Method		string				`json:"method"`
+	Path		string				`json:"path"`					// without the query, which is in Params.
+	Params		map[string]string	`json:"params,omitempty"`		// query and form parameters; see WithRedactedNames.
+	Region		string				`json:"region,omitempty"`		// X-Secondlife-Region, e.g. "Da Boom (256000, 256000)".
+	OwnerKey	string				`json:"ownerKey,omitempty"`		// X-Secondlife-Owner-Key.
+	ObjectName	string				`json:"objectName,omitempty"`	// X-Secondlife-Object-Name.
+	Status		int					`json:"status"`
+	Bytes		int64				`json:"bytes"`					// size of the reply.
+	Latency		time.Duration		`json:"latency"`				// in nanoseconds (as JSON).
+	// Lookups counts how the lookups made for this request (if any) were answered: "hit", "miss",
+	// "bloom" (a miss which never got to the database, thanks to the Bloom filter), "shared" (with
+	// a concurrent lookup for the same item) or "error". There is no other cache, so "bloom" and
+	// "shared" are as close as it gets to a cache hit.
+	Lookups		map[string]int		`json:"lookups,omitempty"`
+}
+
+// redacted replaces avatar names in the access log, if WithRedactedNames says so.
+const redacted = "[redacted]"
+
+// WithAccessLog calls accessLog with an AccessEntry after each HTTP request has been answered; nil,
+// the default, means no access log. accessLog gets called from many goroutines at the same time.
+func WithAccessLog(accessLog func(AccessEntry)) HandlerOption {
+	return func(options *serverOptions) {
+		options.accessLog = accessLog
+	}
+}
+
+// WithRedactedNames keeps avatar names (i.e. the `name` parameter) out of the access log.
+func WithRedactedNames(redact bool) HandlerOption {
+	return func(options *serverOptions) {
+		options.redactNames = redact
+	}
+}
+
+// accessEntryKey is where the entry for a request is kept in its context, so that lookups can add to it.
+type accessEntryKey struct{}
+
+// noteLookup counts the outcome of a lookup; each request is handled by a single goroutine, so there is no need to lock.
+func (entry *AccessEntry) noteLookup(outcome string) {
+	if entry.Lookups == nil {
+		entry.Lookups = make(map[string]int)
+	}
+	entry.Lookups[outcome]++
+}
+
+// lookup is Store.Lookup(), which also notes how it went in the access log entry in ctx, if there is one.
+func (srv *server) lookup(ctx context.Context, searchItem string) (AvatarUUID, error) {
+	if entry, ok := ctx.Value(accessEntryKey{}).(*AccessEntry); ok {
+		return srv.store.lookupNoting(searchItem, entry.noteLookup)
+	}
+	return srv.store.Lookup(searchItem)
+}
+
+// serveLogged calls next, and then accessLog with what happened.
+func serveLogged(next http.HandlerFunc, accessLog func(AccessEntry), redactNames bool, w http.ResponseWriter, r *http.Request) {
+	entry := &AccessEntry{
+		Time:		time.Now(),
+		RemoteAddr:	r.RemoteAddr,
+		Method:		r.Method,
+		Path:		r.URL.Path,
+		Region:		r.Header.Get("X-Secondlife-Region"),
+		OwnerKey:	r.Header.Get("X-Secondlife-Owner-Key"),
+		ObjectName:	r.Header.Get("X-Secondlife-Object-Name"),
+	}
+	recorder := &statusRecorder{ResponseWriter: w}
+	r = r.WithContext(context.WithValue(r.Context(), accessEntryKey{}, entry))
+	next(recorder, r)
+
+	entry.Latency = time.Since(entry.Time)
+	entry.Status, entry.Bytes = recorder.status, recorder.bytes
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK // nothing was written at all, which net/http turns into an empty 200.
+	}
+	// The handlers have parsed the form by now, if they needed it; if they didn't, there's just the query.
+	form := r.Form
+	if form == nil {
+		form = r.URL.Query()
+	}
+	if len(form) > 0 {
+		entry.Params = make(map[string]string, len(form))
+		for name, values := range form {
+			entry.Params[name] = strings.Join(values, ",")
+		}
+		if _, ok := entry.Params["name"]; ok && redactNames {
+			entry.Params["name"] = redacted
+		}
+	}
+	accessLog(*entry)
+}
+
+// statusRecorder remembers the status and size of a reply.
+type statusRecorder struct {
+	http.ResponseWriter
+	status	int
+	bytes	int64
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController get to the real ResponseWriter, e.g. to flush it.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
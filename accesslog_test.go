@@ -0,0 +1,80 @@
+package gosl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	const key = "a2e76fcd-9360-4f6d-a924-000000000001"
+	config := DefaultConfig()
+	config.Database = "memory"
+	config.BloomCapacity = 1000
+	store, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Insert(AvatarUUID{"Resident One", key, "Production"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var entries []AccessEntry
+	handler := NewHandler(store, WithAccessLog(func(entry AccessEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		entries = append(entries, entry)
+	}))
+	do := func(method, target, body string) AccessEntry {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		req.Header.Set("X-Secondlife-Region", "Da Boom (256000, 256000)")
+		req.Header.Set("X-Secondlife-Owner-Key", key)
+		req.Header.Set("X-Secondlife-Object-Name", "name2key HUD")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		mu.Lock()
+		defer mu.Unlock()
+		if len(entries) == 0 {
+			t.Fatalf("%s %s was not logged", method, target)
+		}
+		return entries[len(entries)-1]
+	}
+
+	entry := do(http.MethodGet, "/name2key?name=Resident+One", "")
+	if entry.Method != http.MethodGet || entry.Path != "/name2key" || entry.Status != http.StatusOK || entry.Bytes != 36 {
+		t.Errorf("name2key entry = %+v", entry)
+	}
+	if entry.Region != "Da Boom (256000, 256000)" || entry.OwnerKey != key || entry.ObjectName != "name2key HUD" {
+		t.Errorf("name2key entry is missing the in-world headers: %+v", entry)
+	}
+	if want := map[string]string{"name": "Resident One"}; !reflect.DeepEqual(entry.Params, want) {
+		t.Errorf("name2key params = %v, want %v", entry.Params, want)
+	}
+	if want := map[string]int{"hit": 1}; !reflect.DeepEqual(entry.Lookups, want) {
+		t.Errorf("name2key lookups = %v, want %v", entry.Lookups, want)
+	}
+
+	// Unknown names are (usually) answered by the Bloom filter.
+	if entry := do(http.MethodPost, "/", "name=Nobody+Here"); !reflect.DeepEqual(entry.Lookups, map[string]int{"miss": 1, "bloom": 1}) {
+		t.Errorf("legacy lookup of an unknown name: lookups = %v", entry.Lookups)
+	}
+	if entry := do(http.MethodGet, "/api/v1/avatars/"+key, ""); entry.Path != "/api/v1/avatars/"+key || entry.Status != http.StatusOK || entry.Lookups["hit"] != 1 {
+		t.Errorf("API entry = %+v", entry)
+	}
+	if entry := do(http.MethodGet, "/key2name", ""); entry.Status != http.StatusBadRequest || entry.Lookups != nil {
+		t.Errorf("bad request entry = %+v", entry)
+	}
+
+	handler.(Reconfigurable).Reconfigure(WithRedactedNames(true))
+	if entry := do(http.MethodGet, "/api/v1/avatars?name=Resident+One", ""); entry.Params["name"] != redacted {
+		t.Errorf("redacted params = %v", entry.Params)
+	}
+}
@@ -0,0 +1,74 @@
+// Administrative endpoints, under `/api/v1/admin/`, which are disabled unless an admin token
+// has been set (see WithAdminToken); requests must then carry it as `Authorization: Bearer <token>`.
+//
+//	GET    /api/v1/admin/backup       streams a backup of the whole database (see backup.go)
+package gosl
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WithAdminToken enables the admin endpoints, which will require this token.
+// An empty token, which is the default, keeps them disabled.
+func WithAdminToken(token string) HandlerOption {
+	return func(options *serverOptions) {
+		options.adminToken = token
+	}
+}
+
+// checkAdmin replies with an error, and returns false, unless the request has the admin token.
+func (srv *server) checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	adminToken := srv.options.Load().adminToken
+	if adminToken == "" {
+		apiError(w, http.StatusNotFound, "admin endpoints are disabled")
+		return false
+	}
+	if !hasAdminToken(r, adminToken) {
+		log.Warningf("rejected admin request from %s\n", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gosl-basics admin"`)
+		apiError(w, http.StatusUnauthorized, "missing or invalid admin token")
+		return false
+	}
+	return true
+}
+
+// hasAdminToken is true if the request carries adminToken, which must not be empty.
+func hasAdminToken(r *http.Request, adminToken string) bool {
+	return isAdminAuthorization(r.Header.Get("Authorization"), adminToken)
+}
+
+// isAdminAuthorization is true if an Authorization header (or gRPC metadata) is `Bearer adminToken`, and adminToken is not empty.
+func isAdminAuthorization(authorization string, adminToken string) bool {
+	token, found := strings.CutPrefix(authorization, "Bearer ")
+	return found && adminToken != "" && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(adminToken)) == 1
+}
+
+// apiBackup streams a backup, which is taken from a snapshot, so the server keeps working meanwhile.
+// Once the first bytes are out, errors can no longer be reported with a status code; the connection
+// is closed, where the server lets us, so that the client sees that the download was cut short, and,
+// anyway, an incomplete backup does not pass verification.
+func (srv *server) apiBackup(w http.ResponseWriter, r *http.Request) {
+	if !srv.checkAdmin(w, r) {
+		return
+	}
+	filename := fmt.Sprintf("gosl-%s-%s.backup", srv.store.config.Database, time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	start := time.Now()
+	info, err := srv.store.Backup(r.Context(), w)
+	if err != nil {
+		log.Errorf("backup for %s failed after %d keys: %v\n", r.RemoteAddr, info.Keys, err)
+		// Without the end of the (chunked) body, the client knows that it did not get everything.
+		// FastCGI and HTTP/2 cannot do this; panicking instead would bring down the whole process under FastCGI.
+		if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+			conn.Close()
+		}
+		return
+	}
+	log.Infof("backup of %d keys sent to %s in %v\n", info.Keys, r.RemoteAddr, time.Since(start).Round(time.Millisecond))
+}
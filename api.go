@@ -0,0 +1,358 @@
+// RESTful API for avatar records, under `/api/v1`, for services that would rather
+// not deal with the LSL-friendly interface (which always replies with 200 and NULL_KEY).
+//
+//	GET    /api/v1/avatars/{uuid}     returns the record for that UUID
+//	GET    /api/v1/avatars?name=...   returns the record for that avatar name
+//	PUT    /api/v1/avatars/{uuid}     creates or replaces the record, from a JSON body
+//	DELETE /api/v1/avatars/{uuid}     removes the record
+//	POST   /api/v1/lookup             looks up many names and/or UUIDs at once, from a JSON array
+//	GET    /api/v1/health             checks that the database is answering
+//	GET    /api/v1/stats              returns the store's counters (see stats.go)
+//	GET    /api/v1/admin/backup       streams a backup, if enabled (see admin.go)
+//
+// Records are JSON-encoded AvatarUUID structs; responses carry an ETag, and If-None-Match/If-Match
+// are honoured for conditional requests.
+// PUT and DELETE are refused (403) unless a signing secret or an admin token has been set; then they
+// must be signed (see sign.go), or carry the admin token (see admin.go).
+package gosl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// apiPrefix is where the API lives, relative to wherever the application has been mounted.
+const apiPrefix = "/api/v1"
+
+// apiRoute is an http.ServeMux pattern, relative to apiPrefix, and its handler.
+type apiRoute struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// apiRoutes returns the API routes.
+// Keep openapi.json in sync with these (there is a test for that).
+func (srv *server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{"GET /avatars/{uuid}", srv.apiGetAvatar},
+		{"GET /avatars", srv.apiFindAvatar},
+		{"PUT /avatars/{uuid}", srv.apiPutAvatar},
+		{"DELETE /avatars/{uuid}", srv.apiDeleteAvatar},
+		{"POST /lookup", srv.apiLookup},
+		{"GET /health", srv.apiHealth},
+		{"GET /stats", srv.apiStats},
+		{"GET /admin/backup", srv.apiBackup},
+	}
+}
+
+// newAPIMux sets up the API routes; the mux handles the API requests once apiPrefix
+// (and whatever came before it) has been stripped.
+func (srv *server) newAPIMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, route := range srv.apiRoutes() {
+		mux.HandleFunc(route.pattern, route.handler)
+	}
+	return mux
+}
+
+// serveAPI strips everything up to and including apiPrefix from the path and hands the request to apiMux.
+// path is what is left once the base path (if any) is taken out; if anchored, apiPrefix must come first.
+// It returns false if this is not an API request.
+func serveAPI(apiMux *http.ServeMux, w http.ResponseWriter, r *http.Request, path string, anchored bool) bool {
+	i := strings.Index(path, apiPrefix+"/")
+	if i < 0 || (anchored && i > 0) {
+		return false
+	}
+	http.StripPrefix(r.URL.Path[:len(r.URL.Path)-len(path)+i+len(apiPrefix)], apiMux).ServeHTTP(w, r)
+	return true
+}
+
+// apiGetAvatar returns the record for a UUID, or 404.
+func (srv *server) apiGetAvatar(w http.ResponseWriter, r *http.Request) {
+	key, ok := apiPathUUID(w, r)
+	if !ok {
+		return
+	}
+	record, found := srv.lookupAvatar(r.Context(), key)
+	if !found {
+		apiError(w, http.StatusNotFound, "no avatar with UUID "+key)
+		return
+	}
+	apiReply(w, r, http.StatusOK, record)
+}
+
+// apiFindAvatar returns the record for an avatar name (`name` parameter), or 404.
+func (srv *server) apiFindAvatar(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		apiError(w, http.StatusBadRequest, "missing avatar name")
+		return
+	}
+	record, found := srv.lookupAvatar(r.Context(), name)
+	if !found {
+		apiError(w, http.StatusNotFound, "no avatar named "+name)
+		return
+	}
+	apiReply(w, r, http.StatusOK, record)
+}
+
+// apiPutAvatar creates (201) or replaces (200) the record for a UUID. The body is a JSON record;
+// the UUID comes from the path, and if there is a `key` in the body, it must be the same one.
+func (srv *server) apiPutAvatar(w http.ResponseWriter, r *http.Request) {
+	key, ok := apiPathUUID(w, r)
+	if !ok {
+		return
+	}
+	var record AvatarUUID
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&record); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	record.AvatarName = strings.TrimSpace(record.AvatarName)
+	if record.AvatarName == "" {
+		apiError(w, http.StatusUnprocessableEntity, "missing avatar name")
+		return
+	}
+	if record.UUID != "" && !sameUUID(record.UUID, key) {
+		apiError(w, http.StatusUnprocessableEntity, "UUID in body does not match UUID in path")
+		return
+	}
+	record.UUID = key
+	// signatures are for the UUID as it was sent, which is not necessarily in canonical form.
+	if !srv.authoriseWrite(w, r, record.AvatarName, r.PathValue("uuid")) {
+		return
+	}
+
+	defer srv.lockRecord(key)()
+	old, found := srv.lookupAvatar(r.Context(), key)
+	if !apiPreconditions(w, r, old, found) {
+		return
+	}
+	if found && old.AvatarName != record.AvatarName {
+		// the avatar got a new name; forget the old one, or it would still point to this UUID.
+		if err := srv.store.Delete(AvatarUUID{AvatarName: old.AvatarName}); err != nil {
+			apiError(w, writeErrorStatus(w, err), "could not remove old name: "+err.Error())
+			return
+		}
+	}
+	if err := srv.store.Insert(record); err != nil {
+		apiError(w, writeErrorStatus(w, err), "could not store record: "+err.Error())
+		return
+	}
+	status := http.StatusOK
+	if !found {
+		status = http.StatusCreated
+	}
+	apiReply(w, r, status, record)
+}
+
+// apiDeleteAvatar removes the record for a UUID; 204 on success, 404 if there was nothing to delete.
+func (srv *server) apiDeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	key, ok := apiPathUUID(w, r)
+	if !ok {
+		return
+	}
+	if !srv.authoriseWrite(w, r, "", r.PathValue("uuid")) {
+		return
+	}
+	defer srv.lockRecord(key)()
+	record, found := srv.lookupAvatar(r.Context(), key)
+	if !found {
+		apiError(w, http.StatusNotFound, "no avatar with UUID "+key)
+		return
+	}
+	if !apiPreconditions(w, r, record, found) {
+		return
+	}
+	if err := srv.store.Delete(record); err != nil {
+		apiError(w, writeErrorStatus(w, err), "could not delete record: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiPathUUID returns the UUID in the path in canonical form (lower case, no braces), so that
+// there is only ever one key for each record; if it is not a UUID, it replies with 400 and returns false.
+func apiPathUUID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	parsed, err := uuid.Parse(r.PathValue("uuid"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid UUID "+r.PathValue("uuid"))
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// sameUUID is true if both are the same UUID, no matter how they are written.
+func sameUUID(a string, b string) bool {
+	parsedA, errA := uuid.Parse(a)
+	parsedB, errB := uuid.Parse(b)
+	return errA == nil && errB == nil && parsedA == parsedB
+}
+
+// lockRecord locks the record for a (canonical) UUID, so that checking the preconditions and
+// writing happen as one, and two conditional requests cannot both succeed; call the returned function to unlock.
+// Locks are striped, so unrelated UUIDs may occasionally have to wait for each other, which is harmless.
+func (srv *server) lockRecord(key string) func() {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	mutex := &srv.recordLocks[hash.Sum32()%uint32(len(srv.recordLocks))]
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+// authoriseWrite replies with an error, and returns false, unless the request may change the record
+// for name and key: either it carries the admin token, or it has been signed with the signing secret.
+// If neither has been set, the API is read-only, since otherwise anyone could delete anything.
+func (srv *server) authoriseWrite(w http.ResponseWriter, r *http.Request, name string, key string) bool {
+	options := srv.options.Load()
+	switch {
+	case options.signingSecret == "" && options.adminToken == "":
+		apiError(w, http.StatusForbidden, "writing through the API is disabled; set a signing secret or an admin token")
+		return false
+	case hasAdminToken(r, options.adminToken):
+		return true
+	case options.signingSecret != "":
+		if err := srv.checkSignature(r, name, key); err != nil {
+			apiError(w, http.StatusUnauthorized, err.Error())
+			return false
+		}
+		return true
+	}
+	log.Warningf("rejected API write from %s\n", r.RemoteAddr)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="gosl-basics admin"`)
+	apiError(w, http.StatusUnauthorized, "missing or invalid admin token")
+	return false
+}
+
+// maxBatch is the most items that can be looked up with a single request to /lookup.
+const maxBatch = 1000
+
+// batchResult is what /lookup returns for each item, in the same order as they were sent.
+type batchResult struct {
+	Query	string	`json:"query"`
+	Found	bool	`json:"found"`
+	AvatarUUID
+}
+
+// apiLookup looks up a JSON array of avatar names and/or UUIDs (up to maxBatch), and
+// returns a JSON array of results; items which are not found are not an error.
+func (srv *server) apiLookup(w http.ResponseWriter, r *http.Request) {
+	var items []string
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatch*128)).Decode(&items); err != nil {
+		apiError(w, http.StatusBadRequest, "invalid JSON body, expected an array of names and/or UUIDs: "+err.Error())
+		return
+	}
+	if len(items) > maxBatch {
+		apiError(w, http.StatusRequestEntityTooLarge, "too many items, the maximum is "+strconv.Itoa(maxBatch))
+		return
+	}
+	results := make([]batchResult, len(items))
+	for i, item := range items {
+		record, found := srv.lookupAvatar(r.Context(), item)
+		results[i] = batchResult{Query: item, Found: found, AvatarUUID: record}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	checkErr(json.NewEncoder(w).Encode(results))
+}
+
+// apiHealth replies 200 if the database is answering, 503 otherwise; meant for load balancers and monitoring.
+func (srv *server) apiHealth(w http.ResponseWriter, r *http.Request) {
+	status, reply := http.StatusOK, map[string]string{"status": "ok", "database": srv.store.Config().Database}
+	if err := srv.store.Ping(); err != nil {
+		log.Error("health check failed:", err)
+		status, reply["status"], reply["error"] = http.StatusServiceUnavailable, "unavailable", err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	checkErr(json.NewEncoder(w).Encode(reply))
+}
+
+// apiStats returns the store's counters.
+func (srv *server) apiStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	checkErr(json.NewEncoder(w).Encode(srv.store.Stats()))
+}
+
+// lookupAvatar is Store.Lookup() for those who just need to know if something was found or not.
+func (srv *server) lookupAvatar(ctx context.Context, searchItem string) (AvatarUUID, bool) {
+	record, err := srv.lookup(ctx, searchItem)
+	return record, err == nil && record.UUID != NullUUID && record.UUID != ""
+}
+
+// etag returns a strong ETag for a record, i.e. a hash of its JSON encoding.
+func etag(record AvatarUUID) string {
+	data, _ := json.Marshal(record)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// etagMatches checks an If-Match/If-None-Match header value against an ETag; `*` matches anything that exists.
+func etagMatches(header string, tag string, exists bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if (candidate == "*" && exists) || (exists && candidate == tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiPreconditions checks If-Match and If-None-Match for requests that change something.
+// If they fail, a 412 has already been sent and it returns false.
+func apiPreconditions(w http.ResponseWriter, r *http.Request, current AvatarUUID, exists bool) bool {
+	tag := ""
+	if exists {
+		tag = etag(current)
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, tag, exists) {
+		apiError(w, http.StatusPreconditionFailed, "record has changed (If-Match)")
+		return false
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, tag, exists) {
+		apiError(w, http.StatusPreconditionFailed, "record already exists (If-None-Match)")
+		return false
+	}
+	return true
+}
+
+// apiReply sends a record as JSON, with its ETag; GETs with a matching If-None-Match get a 304 instead.
+func apiReply(w http.ResponseWriter, r *http.Request, status int, record AvatarUUID) {
+	tag := etag(record)
+	w.Header().Set("ETag", tag)
+	if r.Method == http.MethodGet && etagMatches(r.Header.Get("If-None-Match"), tag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	checkErr(json.NewEncoder(w).Encode(record))
+}
+
+// writeErrorStatus returns the status for an error from Store.Insert or Store.Delete: read-only
+// databases only allow lookups, so that's 405 (which must say what is allowed); anything else is our fault.
+func writeErrorStatus(w http.ResponseWriter, err error) int {
+	if errors.Is(err, ErrReadOnly) {
+		w.Header().Set("Allow", "GET, HEAD")
+		return http.StatusMethodNotAllowed
+	}
+	return http.StatusInternalServerError
+}
+
+// apiError sends back (and logs) an error as JSON.
+func apiError(w http.ResponseWriter, status int, errorMessage string) {
+	log.Error("(" + http.StatusText(status) + ") " + errorMessage)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	checkErr(json.NewEncoder(w).Encode(map[string]string{"error": errorMessage}))
+}
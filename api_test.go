@@ -0,0 +1,240 @@
+// Checks the REST API: who may write, the conditional requests (ETag, 304, 412), and that UUIDs are stored in one form only.
+package gosl
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openMemoryStore returns an empty in-memory store, closed when the test ends.
+func openMemoryStore(t *testing.T) *Store {
+	t.Helper()
+	config := DefaultConfig()
+	config.Database = "memory"
+	config.BloomCapacity = 1000
+	store, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// apiRequest sends a request to handler, with extra headers, and returns the recorded response.
+func apiRequest(handler http.Handler, method string, target string, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIWritesNeedCredentials(t *testing.T) {
+	const (
+		key    = "a2e76fcd-9360-4f6d-a924-000000000001"
+		token  = "s3cret"
+		secret = "correct horse battery staple"
+		body   = `{"name":"Resident One"}`
+	)
+	store := openMemoryStore(t)
+	if err := store.Insert(AvatarUUID{"Resident One", key, "Production"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a signing secret or an admin token, the API is read-only.
+	open := NewHandler(store)
+	if rec := apiRequest(open, http.MethodDelete, "/api/v1/avatars/"+key, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("unconfigured DELETE = %d, want 403", rec.Code)
+	}
+	if rec := apiRequest(open, http.MethodPut, "/api/v1/avatars/"+key, body); rec.Code != http.StatusForbidden {
+		t.Errorf("unconfigured PUT = %d, want 403", rec.Code)
+	}
+	if record, err := store.Lookup(key); err != nil || record.AvatarName != "Resident One" {
+		t.Fatalf("after unconfigured writes, Lookup() = %+v, %v", record, err)
+	}
+
+	// With an admin token, it must be sent.
+	admin := NewHandler(store, WithAdminToken(token))
+	if rec := apiRequest(admin, http.MethodPut, "/api/v1/avatars/"+key, body); rec.Code != http.StatusUnauthorized {
+		t.Errorf("PUT without the admin token = %d, want 401", rec.Code)
+	}
+	if rec := apiRequest(admin, http.MethodPut, "/api/v1/avatars/"+key, body, "Authorization", "Bearer "+token); rec.Code != http.StatusOK {
+		t.Errorf("PUT with the admin token = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	// With a signing secret, writes must be signed; the admin token, if any, also works.
+	signed := NewHandler(store, WithSigningSecret(secret), WithAdminToken(token))
+	if rec := apiRequest(signed, http.MethodDelete, "/api/v1/avatars/"+key, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned DELETE = %d, want 401", rec.Code)
+	}
+	timestamp := time.Now().Unix()
+	rec := apiRequest(signed, http.MethodDelete, "/api/v1/avatars/"+key, "",
+		TimestampHeader, strconv.FormatInt(timestamp, 10), SignatureHeader, Sign(secret, timestamp, "", key))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("signed DELETE = %d, want 204: %s", rec.Code, rec.Body)
+	}
+}
+
+// Concurrent conditional PUTs for the same record must not both succeed, and UUIDs in the path,
+// however they are written, must end up as one record.
+func TestAPIConditionalWritesAreSerialised(t *testing.T) {
+	const (
+		key   = "a2e76fcd-9360-4f6d-a924-000000000001"
+		token = "s3cret"
+	)
+	store := openMemoryStore(t)
+	original := AvatarUUID{"Resident One", key, "Production"}
+	if err := store.Insert(original); err != nil {
+		t.Fatal(err)
+	}
+	store.db = slowBackend{store.db} // so that the requests have every chance to overlap.
+	handler := NewHandler(store, WithAdminToken(token))
+
+	const writers = 20
+	codes := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"name":"Resident %d"}`, i+100)
+			codes <- apiRequest(handler, http.MethodPut, "/api/v1/avatars/"+key, body,
+				"Authorization", "Bearer "+token, "If-Match", etag(original)).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	succeeded := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusPreconditionFailed:
+		default:
+			t.Errorf("conditional PUT = %d", code)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d conditional PUTs with the same If-Match succeeded, want 1", succeeded)
+	}
+
+	upper := "{" + strings.ToUpper(key) + "}"
+	rec := apiRequest(handler, http.MethodPut, "/api/v1/avatars/"+upper, `{"name":"Resident Two"}`, "Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"key":"`+key+`"`) {
+		t.Errorf("PUT with %s = %d: %s", upper, rec.Code, rec.Body)
+	}
+	if record, err := store.Lookup("Resident Two"); err != nil || record.UUID != key {
+		t.Errorf("Lookup(\"Resident Two\") = %+v, %v", record, err)
+	}
+	// Lookup() would find the canonical record for any spelling, so ask the backend itself.
+	if value, err := store.db.get(strings.ToUpper(key)); !errors.Is(err, errKeyNotFound) {
+		t.Errorf("there is a second record under %s: %s, %v", strings.ToUpper(key), value, err)
+	}
+}
+
+// GETs carry an ETag, which conditional GETs, PUTs and DELETEs check.
+func TestAPIConditionalRequests(t *testing.T) {
+	const (
+		key   = "a2e76fcd-9360-4f6d-a924-000000000001"
+		token = "s3cret"
+	)
+	handler := NewHandler(openMemoryStore(t), WithAdminToken(token))
+	path := "/api/v1/avatars/" + key
+	auth := []string{"Authorization", "Bearer " + token}
+
+	// Creating it only if it's not there yet.
+	create := append([]string{"If-None-Match", "*"}, auth...)
+	if rec := apiRequest(handler, http.MethodPut, path, `{"name":"Resident One"}`, create...); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT with If-None-Match: * on a new record = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := apiRequest(handler, http.MethodPut, path, `{"name":"Resident One"}`, create...); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with If-None-Match: * on an existing record = %d", rec.Code)
+	}
+
+	rec := apiRequest(handler, http.MethodGet, path, "")
+	tag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || tag != etag(AvatarUUID{"Resident One", key, ""}) {
+		t.Fatalf("GET = %d, ETag %q: %s", rec.Code, tag, rec.Body)
+	}
+	if rec := apiRequest(handler, http.MethodGet, path, "", "If-None-Match", tag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("GET with the current ETag = %d: %q", rec.Code, rec.Body)
+	}
+	if rec := apiRequest(handler, http.MethodGet, path, "", "If-None-Match", `"stale", `+tag); rec.Code != http.StatusNotModified {
+		t.Errorf("GET with a list of ETags = %d", rec.Code)
+	}
+	if rec := apiRequest(handler, http.MethodGet, path, "", "If-None-Match", `"stale"`); rec.Code != http.StatusOK {
+		t.Errorf("GET with another ETag = %d", rec.Code)
+	}
+
+	// Changing it, but only if nobody else did.
+	if rec := apiRequest(handler, http.MethodPut, path, `{"name":"Resident Two"}`, append([]string{"If-Match", `"stale"`}, auth...)...); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a stale If-Match = %d", rec.Code)
+	}
+	rec = apiRequest(handler, http.MethodPut, path, `{"name":"Resident Two"}`, append([]string{"If-Match", tag}, auth...)...)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == tag {
+		t.Fatalf("PUT with the current If-Match = %d, ETag %q: %s", rec.Code, rec.Header().Get("ETag"), rec.Body)
+	}
+	if rec := apiRequest(handler, http.MethodDelete, path, "", append([]string{"If-Match", tag}, auth...)...); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with the ETag from before the PUT = %d", rec.Code)
+	}
+	if rec := apiRequest(handler, http.MethodDelete, path, "", append([]string{"If-Match", "*"}, auth...)...); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE with If-Match: * = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := apiRequest(handler, http.MethodPut, path, `{"name":"Resident Two"}`, append([]string{"If-Match", "*"}, auth...)...); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with If-Match: * on a deleted record = %d", rec.Code)
+	}
+}
+
+// slowBackend takes its time to write, like a busy disk.
+type slowBackend struct {
+	backend
+}
+
+func (b slowBackend) put(pairs []kvPair) error {
+	time.Sleep(10 * time.Millisecond)
+	return b.backend.put(pairs)
+}
+
+// A UUID registered in upper case by the legacy handler is the same record for the API, and for lookups.
+func TestUUIDsAreCanonical(t *testing.T) {
+	const (
+		key   = "a2e76fcd-9360-4f6d-a924-00000000000a"
+		upper = "A2E76FCD-9360-4F6D-A924-00000000000A"
+		token = "s3cret"
+	)
+	store := openMemoryStore(t)
+	handler := NewHandler(store, WithAdminToken(token))
+	if rec := apiRequest(handler, http.MethodGet, "/register?name=Resident+One&key="+upper, ""); rec.Code != http.StatusOK {
+		t.Fatalf("register = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := apiRequest(handler, http.MethodGet, "/api/v1/avatars/"+key, ""); rec.Code != http.StatusOK {
+		t.Errorf("GET of an avatar registered in upper case = %d, want 200", rec.Code)
+	}
+	rec := apiRequest(handler, http.MethodPut, "/api/v1/avatars/"+key, `{"name":"Resident Renamed"}`, "Authorization", "Bearer "+token)
+	if rec.Code != http.StatusOK {
+		t.Errorf("PUT of an avatar registered in upper case = %d, want 200 (not a new record)", rec.Code)
+	}
+	for _, query := range []string{key, upper, "{" + upper + "}"} {
+		if record, err := store.Lookup(query); err != nil || record.UUID != key || record.AvatarName != "Resident Renamed" {
+			t.Errorf("Lookup(%q) = %+v, %v", query, record, err)
+		}
+	}
+	if _, err := store.Lookup("Resident One"); err == nil {
+		t.Error("the old name is still there")
+	}
+	if err := store.Delete(AvatarUUID{AvatarName: "Resident Renamed", UUID: upper}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(key); err == nil {
+		t.Error("Delete() with an upper-case UUID left the record behind")
+	}
+}
@@ -0,0 +1,77 @@
+// The KV backends.
+// Every backend lives in its own file (backend_*.go) and registers itself in `backends` from an
+// init() function, so adding a new one never requires touching the rest of the code.
+// Backends just store opaque values under string keys; everything else (JSON, Bloom filter,
+// coalescing lookups...) is done by the Store, the same way for all of them.
+package gosl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// errKeyNotFound is what backends return from get() when there is nothing stored under a key.
+var errKeyNotFound = errors.New("key not found")
+
+// kvPair is a key and its value, to be written together with others in a single batch.
+type kvPair struct {
+	key   string
+	value []byte
+}
+
+// backend is what each KV store must implement.
+type backend interface {
+	// get returns the value stored under key, or errKeyNotFound.
+	get(key string) ([]byte, error)
+	// put writes all pairs in a single transaction (or batch), i.e. either all or none get written.
+	put(pairs []kvPair) error
+	// delete removes the keys; keys that do not exist are not an error.
+	delete(keys []string) error
+	// scan calls fn for every key starting with prefix ("" means all keys), in (byte-wise) key order,
+	// until fn returns false; migrations rely on the order to resume. fn may call get(), but not put() or delete().
+	scan(prefix string, fn func(key string, value []byte) bool) error
+	// close flushes everything to disk and closes the database.
+	close() error
+}
+
+// compacter is implemented by backends which benefit from some housekeeping after a big import.
+type compacter interface {
+	compact() error
+}
+
+// snapshotter is implemented by backends which can go through a consistent, point-in-time copy
+// of the whole database while it keeps being written to; backups use it when available (scan
+// may or may not see writes which happen while it runs). Keys come in no particular order, and
+// if fn returns an error, snapshot stops and returns it.
+type snapshotter interface {
+	snapshot(fn func(key string, value []byte) error) error
+}
+
+// readOnlyBackend is implemented by backends which may refuse all writes, e.g. mmap databases
+// which have been built already; put() and delete() return errors wrapping ErrReadOnly.
+type readOnlyBackend interface {
+	readOnly() bool
+}
+
+// backends has the constructors for all backends, indexed by the name used in Config.Database.
+var backends = map[string]func(config Config) (backend, error){}
+
+// Backends returns the names of all available backends, sorted alphabetically.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// openBackend opens the backend named in the configuration.
+func openBackend(config Config) (backend, error) {
+	open, ok := backends[config.Database]
+	if !ok {
+		return nil, fmt.Errorf("unknown database type %q, must be one of %v", config.Database, Backends())
+	}
+	return open(config)
+}
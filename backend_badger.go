@@ -0,0 +1,161 @@
+// Badger v4 backend.
+package gosl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	backends["badger"] = openBadger
+}
+
+// badgerBackend wraps a Badger database.
+type badgerBackend struct {
+	db *badger.DB
+}
+
+// openBadger opens (or creates) a Badger database.
+// Badger v3 - fully rewritten configuration (much simpler!!) (gwyneth 20211026)
+func openBadger(config Config) (backend, error) {
+	var opt badger.Options
+	if config.NoMemory {
+		// use disk; note that unlike the others, Badger generates its own filenames,
+		// we can only pass a _directory_... (gwyneth 20211027)
+		if err := os.Mkdir(config.Path(), 0700); err != nil && !os.IsExist(err) {
+			return nil, err
+		}
+		opt = badger.DefaultOptions(config.Path())
+		log.Debugf("entering disk mode, Opt is %+v\n", opt)
+	} else {
+		// Use only memory
+		opt = badger.LSMOnlyOptions("").WithInMemory(true).WithLevelSizeMultiplier(1).WithNumMemtables(1)
+		log.Debugf("entering memory-only mode, Opt is %+v\n", opt)
+	}
+	// common config
+	opt = opt.WithLogger(log).WithLoggingLevel(badger.ERROR) // set the internal logger to our own logger
+	db, err := badger.Open(opt)
+	if err != nil {
+		return nil, err
+	}
+	return &badgerBackend{db: db}, nil
+}
+
+func (b *badgerBackend) get(key string) ([]byte, error) {
+	var data []byte
+	err := b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) || errors.Is(err, badger.ErrEmptyKey) {
+		return nil, errKeyNotFound
+	}
+	return data, err
+}
+
+// put uses a WriteBatch, which splits huge imports into as many transactions as needed;
+// we used to have to keep the batches small for Badger, or it would run out of memory.
+func (b *badgerBackend) put(pairs []kvPair) error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, pair := range pairs {
+		if err := wb.Set([]byte(pair.key), pair.value); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+func (b *badgerBackend) delete(keys []string) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		for _, key := range keys {
+			if err := txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *badgerBackend) scan(prefix string, fn func(key string, value []byte) bool) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if !fn(string(it.Item().Key()), value) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// badgerBitDelete is how Badger marks deleted keys in a backup (it's not exported).
+const badgerBitDelete = 1 << 0
+
+// snapshot reads Badger's own Backup stream, which is consistent as of when it started, and gives us
+// the latest version of each key. The stream is a sequence of protobuf-encoded KVLists, each one
+// preceded by its length (see badger.DB.Load); all versions of a key come together, newest first.
+func (b *badgerBackend) snapshot(fn func(key string, value []byte) error) error {
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := b.db.Backup(pw, 0)
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close() // if we stop early, this makes Backup() fail, and return.
+
+	br := bufio.NewReaderSize(pr, 64<<10)
+	var buf []byte
+	var previous []byte
+	now := uint64(time.Now().Unix())
+	for {
+		var size uint64
+		if err := binary.Read(br, binary.LittleEndian, &size); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if uint64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		if _, err := io.ReadFull(br, buf[:size]); err != nil {
+			return err
+		}
+		list := &pb.KVList{}
+		if err := proto.Unmarshal(buf[:size], list); err != nil {
+			return err
+		}
+		for _, kv := range list.Kv {
+			if string(kv.Key) == string(previous) {
+				continue // an older version.
+			}
+			previous = kv.Key
+			if len(kv.Meta) > 0 && kv.Meta[0]&badgerBitDelete != 0 || kv.ExpiresAt != 0 && kv.ExpiresAt <= now {
+				continue
+			}
+			if err := fn(string(kv.Key), kv.Value); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (b *badgerBackend) close() error {
+	return b.db.Close()
+}
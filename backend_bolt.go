@@ -0,0 +1,279 @@
+// BoltDB backend, using etcd's maintained fork (bbolt).
+// Everything lives in a single file, which suits shared hosting much better than Badger's
+// directory full of value logs. Names and UUIDs go into separate buckets, so each B+ tree only
+// has one kind of key; scan merges both, so that callers still see all keys in order.
+package gosl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	bolterrors "go.etcd.io/bbolt/errors"
+)
+
+func init() {
+	backends["boltdb"] = openBolt
+}
+
+// Bucket names; which one a key goes to depends only on the key, see boltBucket().
+var (
+	boltNamesBucket	= []byte("names")
+	boltUUIDsBucket	= []byte("uuids")
+)
+
+// boltScanChunk is how many entries scan reads per transaction. Read transactions are not kept open
+// while fn runs, since fn may call get(), and nesting read transactions can deadlock bbolt when a
+// write needs to grow (and remap) the file in the meantime.
+const boltScanChunk = 1000
+
+// boltPutChunk is the most keys put writes in one transaction. bbolt only splits nodes when committing,
+// so, within a transaction, every key inserted into a node moves everything after it; with the 200000 keys
+// of an import batch, that was quadratic, and most of the time went into memmove.
+const boltPutChunk = 10000
+
+// boltMinFill is how full pages must be, on average, for compact() not to bother.
+const boltMinFill = 0.7
+
+// boltOptions are the same for the database and for the copy made by compact().
+var boltOptions = &bolt.Options{
+	Timeout:		5 * time.Second,		// the file is locked while open; without this, a second process would just hang.
+	FreelistType:	bolt.FreelistMapType,	// much faster than the default for big databases.
+}
+
+// boltBackend wraps a bbolt database, which is a single file.
+type boltBackend struct {
+	db		*bolt.DB
+	path	string
+	mutex	sync.RWMutex	// compact() replaces db; everything else just reads it.
+}
+
+// openBolt opens (or creates) a bbolt database, and its buckets.
+func openBolt(config Config) (backend, error) {
+	db, err := bolt.Open(config.Path(), 0600, boltOptions)
+	if errors.Is(err, bolterrors.ErrTimeout) {
+		return nil, fmt.Errorf("%s is being used by another process: %w", config.Path(), err)
+	} else if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltNamesBucket, boltUUIDsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltBackend{db: db, path: config.Path()}, nil
+}
+
+// view and update run a transaction while holding the mutex, so that compact() does not pull
+// the database from under it.
+func (b *boltBackend) view(fn func(tx *bolt.Tx) error) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.db.View(fn)
+}
+
+func (b *boltBackend) update(fn func(tx *bolt.Tx) error) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.db.Update(fn)
+}
+
+// boltBucket returns the bucket for a key: UUIDs go to one, and everything else (i.e. names) to the other.
+func boltBucket(tx *bolt.Tx, key string) *bolt.Bucket {
+	if isValidUUID(key) {
+		return tx.Bucket(boltUUIDsBucket)
+	}
+	return tx.Bucket(boltNamesBucket)
+}
+
+// get uses a read-only transaction, so lookups never wait for imports (or each other).
+func (b *boltBackend) get(key string) ([]byte, error) {
+	var data []byte
+	err := b.view(func(tx *bolt.Tx) error {
+		value := boltBucket(tx, key).Get([]byte(key))
+		if value == nil {
+			return errKeyNotFound
+		}
+		data = bytes.Clone(value) // only valid during the transaction.
+		return nil
+	})
+	return data, err
+}
+
+// put sorts the batch by bucket and key, so that each node only ever gets keys appended (or inserted
+// close to its end), and writes it in transactions of up to boltPutChunk keys; a single record
+// (name and UUID) is still a single transaction. The sort is stable, so, if a key is in the batch
+// more than once, the last one still wins.
+func (b *boltBackend) put(pairs []kvPair) error {
+	type boltPair struct {
+		uuid	bool	// i.e. the bucket.
+		kvPair
+	}
+	sorted := make([]boltPair, len(pairs))
+	for i, pair := range pairs {
+		sorted[i] = boltPair{isValidUUID(pair.key), pair}
+	}
+	slices.SortStableFunc(sorted, func(a, b boltPair) int {
+		if a.uuid != b.uuid {
+			if a.uuid {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a.key, b.key)
+	})
+	for chunk := range slices.Chunk(sorted, boltPutChunk) {
+		err := b.update(func(tx *bolt.Tx) error {
+			names, uuids := tx.Bucket(boltNamesBucket), tx.Bucket(boltUUIDsBucket)
+			for _, pair := range chunk {
+				bucket := names
+				if pair.uuid {
+					bucket = uuids
+				}
+				if err := bucket.Put([]byte(pair.key), pair.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *boltBackend) delete(keys []string) error {
+	return b.update(func(tx *bolt.Tx) error {
+		for _, key := range keys {
+			if err := boltBucket(tx, key).Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// scan reads boltScanChunk entries at a time, merging both buckets in key order; no key is ever
+// in both. Each chunk starts right after the last key of the previous one.
+func (b *boltBackend) scan(prefix string, fn func(key string, value []byte) bool) error {
+	from, skipFrom := []byte(prefix), false
+	for {
+		chunk := make([]kvPair, 0, boltScanChunk)
+		err := b.view(func(tx *bolt.Tx) error {
+			cursors := [2]*bolt.Cursor{tx.Bucket(boltNamesBucket).Cursor(), tx.Bucket(boltUUIDsBucket).Cursor()}
+			var keys, values [2][]byte
+			for i, cursor := range cursors {
+				keys[i], values[i] = cursor.Seek(from)
+				if skipFrom && bytes.Equal(keys[i], from) {
+					keys[i], values[i] = cursor.Next()
+				}
+			}
+			for len(chunk) < boltScanChunk {
+				next := -1 // the cursor with the smallest key which still has the prefix.
+				for i := range keys {
+					if keys[i] != nil && bytes.HasPrefix(keys[i], []byte(prefix)) && (next < 0 || bytes.Compare(keys[i], keys[next]) < 0) {
+						next = i
+					}
+				}
+				if next < 0 {
+					break
+				}
+				chunk = append(chunk, kvPair{string(keys[next]), bytes.Clone(values[next])})
+				keys[next], values[next] = cursors[next].Next()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, pair := range chunk {
+			if !fn(pair.key, pair.value) {
+				return nil
+			}
+		}
+		if len(chunk) < boltScanChunk {
+			return nil
+		}
+		from, skipFrom = []byte(chunk[len(chunk)-1].key), true
+	}
+}
+
+// snapshot goes through both buckets in a single read-only transaction, which always sees the
+// database as it was when it started, no matter what gets written meanwhile.
+func (b *boltBackend) snapshot(fn func(key string, value []byte) error) error {
+	return b.view(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltNamesBucket, boltUUIDsBucket} {
+			err := tx.Bucket(name).ForEach(func(key, value []byte) error {
+				return fn(string(key), bytes.Clone(value))
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// compact rewrites the whole database into a new file, with full pages. Keys which are not inserted
+// in order (and a CSV file can be sorted by name or by UUID, but not both) leave pages half empty,
+// which makes the file about twice as big as it needs to be. It takes a few seconds even for a
+// small database, so it only does it if the pages are less than boltMinFill full.
+func (b *boltBackend) compact() error {
+	var inUse, allocated int
+	err := b.view(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltNamesBucket, boltUUIDsBucket} {
+			stats := tx.Bucket(name).Stats()
+			inUse += stats.BranchInuse + stats.LeafInuse
+			allocated += stats.BranchAlloc + stats.LeafAlloc
+		}
+		return nil
+	})
+	if err != nil || allocated == 0 || float64(inUse) >= boltMinFill*float64(allocated) {
+		return err
+	}
+	log.Debugf("compacting %s, since its pages are only %.0f%% full\n", b.path, 100*float64(inUse)/float64(allocated))
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	compactedPath := b.path + ".compact"
+	os.Remove(compactedPath) // left behind by a crash, maybe.
+	compacted, err := bolt.Open(compactedPath, 0600, boltOptions)
+	if err != nil {
+		return err
+	}
+	err = bolt.Compact(compacted, b.db, 64<<20)
+	if closeErr := compacted.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(compactedPath)
+		return err
+	}
+	if err = b.db.Close(); err != nil {
+		return err
+	}
+	renameErr := os.Rename(compactedPath, b.path)
+	// Whatever happened, we need the database back (if the rename failed, it's just not compacted).
+	if b.db, err = bolt.Open(b.path, 0600, boltOptions); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+func (b *boltBackend) close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,99 @@
+// Checks that the bbolt backend, which keeps names and UUIDs in separate buckets, still scans them in order,
+// and that sorting big batches before writing them does not change what gets written.
+package gosl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBoltScanOrder(t *testing.T) {
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+	config.Database = "boltdb"
+	db, err := openBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.close()
+	// More than boltScanChunk keys, so that scans have to go across several transactions.
+	var pairs []kvPair
+	for i := range boltScanChunk {
+		pairs = append(pairs,
+			kvPair{fmt.Sprintf("Resident %04d", i), []byte("name")},
+			kvPair{fmt.Sprintf("%08x-9360-4f6d-a924-000000000001", i), []byte("uuid")})
+	}
+	if err := db.put(pairs); err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	err = db.scan("", func(key string, value []byte) bool {
+		if _, err := db.get(key); err != nil { // scan must allow this.
+			t.Errorf("get(%q) during scan: %v", key, err)
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != len(pairs) || !sort.StringsAreSorted(keys) {
+		t.Errorf("scan returned %d keys (want %d), sorted: %v", len(keys), len(pairs), sort.StringsAreSorted(keys))
+	}
+
+	count := 0
+	err = db.scan("Resident 01", func(key string, value []byte) bool {
+		if !strings.HasPrefix(key, "Resident 01") {
+			t.Errorf("scan with prefix returned %q", key)
+		}
+		count++
+		return true
+	})
+	if err != nil || count != 100 {
+		t.Errorf("scan with prefix returned %d keys (want 100), %v", count, err)
+	}
+}
+
+// put sorts big batches, and writes them in several transactions; the last value for a key must still win,
+// and the caller's batch must not be reordered.
+func TestBoltPut(t *testing.T) {
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+	config.Database = "boltdb"
+	db, err := openBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.close()
+	var pairs []kvPair
+	for i := boltPutChunk; i >= 0; i-- {
+		pairs = append(pairs,
+			kvPair{fmt.Sprintf("Resident %05d", i), []byte("old")},
+			kvPair{fmt.Sprintf("%08x-9360-4f6d-a924-000000000001", i), []byte("uuid")})
+	}
+	pairs = append(pairs, kvPair{"Resident 00000", []byte("new")}, kvPair{fmt.Sprintf("Resident %05d", boltPutChunk), []byte("new")})
+	first := pairs[0].key
+	if err := db.put(pairs); err != nil {
+		t.Fatal(err)
+	}
+	if pairs[0].key != first {
+		t.Errorf("put() reordered the batch, which now starts with %q", pairs[0].key)
+	}
+	for _, test := range []struct{ key, want string }{
+		{"Resident 00000", "new"},
+		{fmt.Sprintf("Resident %05d", boltPutChunk), "new"},
+		{"Resident 05000", "old"},
+		{"00001388-9360-4f6d-a924-000000000001", "uuid"},
+	} {
+		if value, err := db.get(test.key); err != nil || string(value) != test.want {
+			t.Errorf("get(%q) = %q, %v; want %q", test.key, value, err, test.want)
+		}
+	}
+	count := 0
+	if err := db.scan("", func(string, []byte) bool { count++; return true }); err != nil || count != 2*(boltPutChunk+1) {
+		t.Errorf("scan() found %d keys, %v; want %d", count, err, 2*(boltPutChunk+1))
+	}
+}
@@ -0,0 +1,113 @@
+// BuntDB backend.
+package gosl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+func init() {
+	backends["buntdb"] = openBuntDB
+}
+
+// buntDBBackend wraps a BuntDB database, which is a single file.
+type buntDBBackend struct {
+	db *buntdb.DB
+}
+
+// openBuntDB opens (or creates) a BuntDB database.
+func openBuntDB(config Config) (backend, error) {
+	db, err := buntdb.Open(config.Path())
+	if err != nil {
+		return nil, err
+	}
+	return &buntDBBackend{db: db}, nil
+}
+
+func (b *buntDBBackend) get(key string) ([]byte, error) {
+	var data string
+	err := b.db.View(func(tx *buntdb.Tx) error {
+		var err error
+		data, err = tx.Get(key)
+		return err
+	})
+	if errors.Is(err, buntdb.ErrNotFound) {
+		return nil, errKeyNotFound
+	}
+	return []byte(data), err
+}
+
+func (b *buntDBBackend) put(pairs []kvPair) error {
+	return b.db.Update(func(tx *buntdb.Tx) error {
+		for _, pair := range pairs {
+			if _, _, err := tx.Set(pair.key, string(pair.value), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *buntDBBackend) delete(keys []string) error {
+	return b.db.Update(func(tx *buntdb.Tx) error {
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// scan does not use AscendKeys() with a pattern, since avatar names might have '*' or '?' in them.
+func (b *buntDBBackend) scan(prefix string, fn func(key string, value []byte) bool) error {
+	return b.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", prefix, func(key, value string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			return fn(key, []byte(value))
+		})
+	})
+}
+
+// snapshot reads what BuntDB's Save() writes, which is a consistent copy of the whole database,
+// in the same format as its append-only file: one "set key value" command per key, in RESP
+// (the Redis protocol), e.g. "*3\r\n$3\r\nset\r\n$3\r\nkey\r\n$5\r\nvalue\r\n".
+func (b *buntDBBackend) snapshot(fn func(key string, value []byte) error) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(b.db.Save(pw))
+	}()
+	defer pr.Close() // if we stop early, this makes Save() fail, and return.
+
+	br := bufio.NewReaderSize(pr, 64<<10)
+	for {
+		args, err := readRESPArray(br, 512<<20)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading BuntDB snapshot: %w", err)
+		}
+		if len(args) < 3 || !strings.EqualFold(string(args[0]), "set") {
+			continue // Save() only writes "set"s, but who knows.
+		}
+		if err := fn(string(args[1]), args[2]); err != nil {
+			return err
+		}
+	}
+}
+
+// compact rewrites the append-only file, which grows a lot during imports.
+func (b *buntDBBackend) compact() error {
+	return b.db.Shrink()
+}
+
+func (b *buntDBBackend) close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,89 @@
+// LevelDB backend.
+package gosl
+
+import (
+	"errors"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func init() {
+	backends["leveldb"] = openLevelDB
+}
+
+// levelDBBackend wraps a LevelDB database, which is a directory.
+type levelDBBackend struct {
+	db *leveldb.DB
+}
+
+// openLevelDB opens (or creates) a LevelDB database.
+func openLevelDB(config Config) (backend, error) {
+	db, err := leveldb.OpenFile(config.Path(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBBackend{db: db}, nil
+}
+
+func (b *levelDBBackend) get(key string) ([]byte, error) {
+	data, err := b.db.Get([]byte(key), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, errKeyNotFound
+	}
+	return data, err
+}
+
+func (b *levelDBBackend) put(pairs []kvPair) error {
+	batch := new(leveldb.Batch)
+	for _, pair := range pairs {
+		batch.Put([]byte(pair.key), pair.value)
+	}
+	return b.db.Write(batch, nil)
+}
+
+func (b *levelDBBackend) delete(keys []string) error {
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete([]byte(key))
+	}
+	return b.db.Write(batch, nil)
+}
+
+func (b *levelDBBackend) scan(prefix string, fn func(key string, value []byte) bool) error {
+	iter := b.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		// the iterator reuses its buffers, so we have to copy the value.
+		if !fn(string(iter.Key()), append([]byte(nil), iter.Value()...)) {
+			break
+		}
+	}
+	return iter.Error()
+}
+
+// snapshot iterates over a LevelDB snapshot, which does not change while we go through it.
+func (b *levelDBBackend) snapshot(fn func(key string, value []byte) error) error {
+	snap, err := b.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+	iter := snap.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := fn(string(iter.Key()), append([]byte(nil), iter.Value()...)); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// compact takes ages on a freshly imported database, but makes lookups much faster afterwards.
+func (b *levelDBBackend) compact() error {
+	return b.db.CompactRange(util.Range{Start: nil, Limit: nil})
+}
+
+func (b *levelDBBackend) close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,167 @@
+// In-memory backend: just a map, for tests and for tiny deployments which can afford to keep
+// everything in RAM (Badger's InMemory mode does that too, but it drags the whole of Badger along).
+// Without MemorySnapshot, nothing ever touches the disk, not even the Bloom filter; with it, the
+// database is loaded from Path() when opened, and saved there after imports and when closed.
+// The snapshot is in the same format as backups, so it can be restored into any other backend,
+// and a backup can be used as a snapshot.
+package gosl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+func init() {
+	backends["memory"] = openMemory
+}
+
+// memoryBackend is a map protected by a mutex. Values are copied on the way in and on the way
+// out, so that nobody can change them behind our back.
+type memoryBackend struct {
+	data		map[string][]byte
+	mutex		sync.RWMutex
+	snapshotTo	string	// where to save the snapshot, if anywhere.
+}
+
+// diskless is true for stores which must not write anything at all to disk, i.e. in-memory
+// databases without a snapshot; the Store then skips the Bloom filter files, migration checkpoints, etc.
+func (c Config) diskless() bool {
+	return c.Database == "memory" && !c.MemorySnapshot
+}
+
+// openMemory creates an empty database, or loads it from the snapshot, if there is one.
+func openMemory(config Config) (backend, error) {
+	b := &memoryBackend{data: make(map[string][]byte)}
+	if !config.MemorySnapshot {
+		return b, nil
+	}
+	b.snapshotTo = config.Path()
+	f, err := os.Open(b.snapshotTo)
+	if os.IsNotExist(err) {
+		return b, nil // it will be there once we save it.
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// The checksum is only checked at the end, but nobody sees the map until it's all good.
+	info, err := readBackup(f, func(key string, value []byte) error {
+		b.data[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not load snapshot %s: %w", b.snapshotTo, err)
+	}
+	log.Debugf("loaded %d keys from snapshot %s (taken %v)\n", info.Keys, b.snapshotTo, info.Created)
+	return b, nil
+}
+
+func (b *memoryBackend) get(key string) ([]byte, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	value, ok := b.data[key]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	return bytes.Clone(value), nil
+}
+
+func (b *memoryBackend) put(pairs []kvPair) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, pair := range pairs {
+		b.data[pair.key] = bytes.Clone(pair.value)
+	}
+	return nil
+}
+
+func (b *memoryBackend) delete(keys []string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, key := range keys {
+		delete(b.data, key)
+	}
+	return nil
+}
+
+// pairs returns every key starting with prefix, and its value, sorted by key.
+// Values are never changed in place, so sharing them is fine.
+func (b *memoryBackend) pairs(prefix string) []kvPair {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	var pairs []kvPair
+	for key, value := range b.data {
+		if strings.HasPrefix(key, prefix) {
+			pairs = append(pairs, kvPair{key, value})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+	return pairs
+}
+
+// scan goes through a sorted copy of the matching keys, so that fn can do whatever it likes meanwhile.
+func (b *memoryBackend) scan(prefix string, fn func(key string, value []byte) bool) error {
+	for _, pair := range b.pairs(prefix) {
+		if !fn(pair.key, bytes.Clone(pair.value)) {
+			break
+		}
+	}
+	return nil
+}
+
+// snapshot is just as easy: the copy is taken while holding the lock.
+func (b *memoryBackend) snapshot(fn func(key string, value []byte) error) error {
+	for _, pair := range b.pairs("") {
+		if err := fn(pair.key, bytes.Clone(pair.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compact saves the snapshot (if any), since it runs after imports, migrations and restores.
+func (b *memoryBackend) compact() error {
+	return b.save()
+}
+
+func (b *memoryBackend) close() error {
+	return b.save()
+}
+
+// save writes the snapshot atomically, via a temporary file.
+func (b *memoryBackend) save() error {
+	if b.snapshotTo == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(b.snapshotTo), 0700); err != nil {
+		return err
+	}
+	tmp := b.snapshotTo + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := writeBackup(context.Background(), f, "memory", b.snapshot)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, b.snapshotTo)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not save snapshot %s: %w", b.snapshotTo, err)
+	}
+	log.Debugf("saved %d keys to snapshot %s\n", info.Keys, b.snapshotTo)
+	return nil
+}
@@ -0,0 +1,64 @@
+// Checks that in-memory stores leave nothing on disk, unless asked to keep a snapshot.
+package gosl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	config := DefaultConfig()
+	config.Database = "memory"
+	config.Dir = filepath.Join(t.TempDir(), "nowhere")
+	config.BloomCapacity = 1000
+	store, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv := "a2e76fcd-9360-4f6d-a924-000000000001,Resident One\na2e76fcd-9360-4f6d-a924-000000000002,Resident Two\n"
+	if count, err := store.ImportReader(context.Background(), strings.NewReader(csv)); err != nil || count != 2 {
+		t.Fatalf("ImportReader() = %d, %v", count, err)
+	}
+	if avatar, err := store.Lookup("Resident Two"); err != nil || avatar.UUID != "a2e76fcd-9360-4f6d-a924-000000000002" {
+		t.Errorf("Lookup() = %+v, %v", avatar, err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(config.Dir); !os.IsNotExist(err) {
+		t.Errorf("%s was created (%v)", config.Dir, err)
+	}
+
+	// With a snapshot, the data survives reopening the store.
+	config.Dir = t.TempDir()
+	config.MemorySnapshot = true
+	store, err = Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Insert(AvatarUUID{"Resident One", "a2e76fcd-9360-4f6d-a924-000000000001", "Production"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(config.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if info, err := VerifyBackup(f); err != nil || info.Keys != 2 || info.Database != "memory" {
+		t.Errorf("VerifyBackup() on the snapshot = %+v, %v", info, err)
+	}
+	store, err = Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if avatar, err := store.Lookup("a2e76fcd-9360-4f6d-a924-000000000001"); err != nil || avatar.AvatarName != "Resident One" {
+		t.Errorf("Lookup() after reopening = %+v, %v", avatar, err)
+	}
+}
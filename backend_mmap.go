@@ -0,0 +1,623 @@
+// Read-only, memory-mapped backend, for mirrors which only ever answer lookups.
+// The whole database is a single immutable file: every key and value, sorted by key, followed by
+// an index with the offset of each one. Opening it just maps it into memory, so a FastCGI process
+// starts instantly, and lookups are a binary search over pages which the kernel loads (and drops)
+// as it sees fit; there are no caches, memtables or compaction threads eating our RAM.
+//
+// The file is built by whichever process creates it, with import, migrate or restore. Each batch
+// is sorted and written into a 'run', in the same format, and all runs are merged into the final
+// file only when the import (or migration, or restore) finishes; until then, reads look at the runs,
+// newest first, and then at the file. While it is being built, there is a marker file next to it, so
+// that a build which got interrupted is not mistaken for a finished database: it opens as writable,
+// with the runs written so far, and an import or a resumed migration just carries on. Once built,
+// it is read-only: to change anything, build a new one (e.g. elsewhere) and copy it over.
+//
+// The file format is:
+//
+//	"GOSLMMAP" + version (uint32) + 0 (uint32) + number of keys (uint64) + index offset (uint64)
+//	for each key, in key order: uvarint key length, key, uvarint value length, value
+//	the index: the offset of each key (uint64)
+//
+// All integers are little-endian.
+package gosl
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/mmap"
+)
+
+func init() {
+	backends["mmap"] = openMmap
+}
+
+const (
+	mmapMagic		= "GOSLMMAP"
+	mmapVersion		= 1
+	mmapHeaderSize	= len(mmapMagic) + 4 + 4 + 8 + 8
+	// mmapScanChunk is how many keys scan reads at a time; the lock is not held while fn runs.
+	mmapScanChunk	= 1000
+)
+
+// mmapBackend wraps the file, and, while it is being built, the runs which are not merged into it yet.
+type mmapBackend struct {
+	path		string
+	mutex		sync.RWMutex	// merging replaces table; everything else just reads it.
+	table		*mmapTable		// nil until there is something in the database.
+	writable	bool			// only if this process created the database, or is carrying on with building it.
+	runs		[]*mmapTable	// sorted runs, oldest first, waiting to be merged.
+}
+
+// openMmap maps an existing database, or gets ready to build a new one, or to carry on building one,
+// if there is a build marker, or a checkpoint of a migration into it.
+func openMmap(config Config) (backend, error) {
+	b := &mmapBackend{path: config.Path()}
+	_, err := os.Stat(b.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	exists := err == nil
+	b.writable = !exists || fileExists(b.buildMarker()) || fileExists(migrationCheckpointPath(config))
+	if exists {
+		if b.table, err = openMmapTable(b.path); err != nil {
+			return nil, err
+		}
+	}
+	if !b.writable || !fileExists(b.buildMarker()) {
+		// Without a marker, runs can only be left over from older versions, which merged them when closing.
+		os.RemoveAll(b.runsDir())
+		return b, nil
+	}
+	if b.runs, err = openMmapRuns(b.runsDir()); err != nil {
+		b.close()
+		return nil, err
+	}
+	log.Noticef("%s was not finished; carrying on with building it, from %d runs\n", b.path, len(b.runs))
+	return b, nil
+}
+
+// openMmapRuns opens the runs of an interrupted build, oldest first; a run which was being written
+// when the build was interrupted never got its name, and is thrown away.
+func openMmapRuns(dir string) ([]*mmapTable, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var runs []*mmapTable
+	for _, entry := range entries { // sorted by name, i.e. oldest first.
+		filename := filepath.Join(dir, entry.Name())
+		if !strings.HasPrefix(entry.Name(), "run-") || strings.HasSuffix(entry.Name(), ".tmp") {
+			os.Remove(filename)
+			continue
+		}
+		run, err := openMmapTable(filename)
+		if err != nil {
+			for _, run := range runs {
+				run.close()
+			}
+			return nil, fmt.Errorf("cannot carry on building the mmap database: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// fileExists is true if there is something at filename.
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// runsDir is where the runs go while the database is being built.
+func (b *mmapBackend) runsDir() string {
+	return b.path + ".runs"
+}
+
+// buildMarker is there from the first batch until the database is built, i.e. until compact() merges the runs.
+func (b *mmapBackend) buildMarker() string {
+	return b.path + ".building"
+}
+
+// errReadOnly is what everything that tries to change a database which has been built already gets.
+func (b *mmapBackend) errReadOnly() error {
+	return fmt.Errorf("%w: %s is an mmap database, which cannot be changed once built; build a new one with import, migrate or restore instead", ErrReadOnly, b.path)
+}
+
+func (b *mmapBackend) readOnly() bool {
+	return !b.writable
+}
+
+// put sorts the batch and writes it as a new run; if a key is repeated, the last value wins.
+func (b *mmapBackend) put(pairs []kvPair) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.readOnly() {
+		return b.errReadOnly()
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(b.runsDir(), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(b.buildMarker(), nil, 0600); err != nil {
+		return err
+	}
+	sorted := slices.Clone(pairs)
+	slices.SortStableFunc(sorted, func(a, b kvPair) int {
+		return strings.Compare(a.key, b.key)
+	})
+	unique := sorted[:0]
+	for i, pair := range sorted {
+		if i+1 < len(sorted) && sorted[i+1].key == pair.key {
+			continue // superseded by the next one.
+		}
+		unique = append(unique, pair)
+	}
+	// Runs are what an interrupted build carries on from (and what a migration checkpoint counts on),
+	// so they must be on the disk, and complete, before put returns.
+	filename := filepath.Join(b.runsDir(), fmt.Sprintf("run-%06d", len(b.runs)))
+	if err := writeMmapTable(filename+".tmp", []mmapSource{&mmapPairsSource{pairs: unique}}, true); err != nil {
+		os.Remove(filename + ".tmp")
+		return err
+	}
+	if err := os.Rename(filename+".tmp", filename); err != nil {
+		os.Remove(filename + ".tmp")
+		return err
+	}
+	run, err := openMmapTable(filename)
+	if err != nil {
+		return err
+	}
+	b.runs = append(b.runs, run)
+	return nil
+}
+
+// delete is never possible: runs have no way to say that a key is gone.
+func (b *mmapBackend) delete(keys []string) error {
+	if b.readOnly() {
+		return b.errReadOnly()
+	}
+	return fmt.Errorf("%s is still being built, and keys cannot be deleted from an mmap database", b.path)
+}
+
+// tables returns the table (if there is one) and the runs, oldest first: everything that was put so far.
+// Reads go through all of them, rather than merging them, which would copy the whole database every
+// time something is read after a write. The caller must hold the read lock.
+func (b *mmapBackend) tables() []*mmapTable {
+	if b.table == nil {
+		return b.runs
+	}
+	return append([]*mmapTable{b.table}, b.runs...)
+}
+
+// get looks in the newest run first, since its value replaces those in older runs and in the table.
+func (b *mmapBackend) get(key string) ([]byte, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, table := range slices.Backward(b.tables()) {
+		i, found, err := table.search(key)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			_, value, err := table.record(i)
+			return value, err
+		}
+	}
+	return nil, errKeyNotFound
+}
+
+// errMmapChunkFull stops merging when scan has enough keys for now.
+var errMmapChunkFull = errors.New("chunk full")
+
+// scan reads mmapScanChunk keys at a time, so that it does not hold the lock while fn runs.
+// Each chunk starts right after the last key of the previous one.
+func (b *mmapBackend) scan(prefix string, fn func(key string, value []byte) bool) error {
+	from, skipFrom := prefix, false
+	for {
+		chunk := make([]kvPair, 0, mmapScanChunk)
+		err := func() error {
+			b.mutex.RLock()
+			defer b.mutex.RUnlock()
+			var sources []mmapSource
+			for _, table := range b.tables() {
+				i, found, err := table.search(from)
+				if err != nil {
+					return err
+				}
+				if found && skipFrom {
+					i++
+				}
+				sources = append(sources, &mmapTableSource{table: table, i: i})
+			}
+			err := mergeMmapSources(sources, func(key string, value []byte) error {
+				if !strings.HasPrefix(key, prefix) || len(chunk) == mmapScanChunk {
+					return errMmapChunkFull
+				}
+				chunk = append(chunk, kvPair{key, value})
+				return nil
+			})
+			if errors.Is(err, errMmapChunkFull) {
+				return nil
+			}
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+		for _, pair := range chunk {
+			if !fn(pair.key, pair.value) {
+				return nil
+			}
+		}
+		if len(chunk) < mmapScanChunk {
+			return nil
+		}
+		from, skipFrom = chunk[len(chunk)-1].key, true
+	}
+}
+
+// compact merges the runs into the final file, which finishes building it; Import, MigrateTo and
+// Restore call it when they finish, and only if they do.
+func (b *mmapBackend) compact() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.merge(); err != nil {
+		return err
+	}
+	if err := os.Remove(b.buildMarker()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// close leaves the runs of an unfinished build where they are, for whoever carries on with it.
+func (b *mmapBackend) close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var err error
+	for _, table := range b.tables() {
+		if closeErr := table.close(); err == nil {
+			err = closeErr
+		}
+	}
+	b.table, b.runs = nil, nil
+	return err
+}
+
+// merge writes the current table (if any) and all runs into a new file, and maps it instead of
+// the old one. Keys in newer runs replace those in older ones, and in the old table.
+// The caller must hold the write lock.
+func (b *mmapBackend) merge() error {
+	if len(b.runs) == 0 {
+		return nil
+	}
+	log.Debugf("merging %d runs into %s\n", len(b.runs), b.path)
+	var sources []mmapSource
+	for _, table := range b.tables() {
+		sources = append(sources, &mmapTableSource{table: table})
+	}
+	tmp := b.path + ".tmp"
+	if err := writeMmapTable(tmp, sources, true); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// The old table must be unmapped before it is replaced (Windows would not even allow it otherwise).
+	if b.table != nil {
+		b.table.close()
+		b.table = nil
+	}
+	renameErr := os.Rename(tmp, b.path)
+	// Whatever happened, we need the table back (if the rename failed, it's just the old one, and
+	// the runs are still there to be merged next time).
+	table, err := openMmapTable(b.path)
+	if errors.Is(err, os.ErrNotExist) && renameErr != nil {
+		return renameErr // there was nothing before.
+	}
+	if err != nil {
+		return err
+	}
+	b.table = table
+	if renameErr != nil {
+		os.Remove(tmp)
+		return renameErr
+	}
+	for _, run := range b.runs {
+		run.close()
+	}
+	b.runs = nil
+	return os.RemoveAll(b.runsDir())
+}
+
+// mmapTable is a memory-mapped database file.
+type mmapTable struct {
+	r			*mmap.ReaderAt
+	count		int
+	indexOffset	int64
+}
+
+// openMmapTable maps a file and checks its header; it does not read anything else, so it is
+// instant no matter how big the file is. Offsets are checked as they are used.
+func openMmapTable(filename string) (*mmapTable, error) {
+	r, err := mmap.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	t := &mmapTable{r: r}
+	header := make([]byte, mmapHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil || string(header[:len(mmapMagic)]) != mmapMagic {
+		r.Close()
+		return nil, fmt.Errorf("%s is not an mmap database", filename)
+	}
+	if version := binary.LittleEndian.Uint32(header[len(mmapMagic):]); version != mmapVersion {
+		r.Close()
+		return nil, fmt.Errorf("%s has format version %d, but this version of gosl-basics only knows %d", filename, version, mmapVersion)
+	}
+	count := binary.LittleEndian.Uint64(header[len(mmapMagic)+8:])
+	t.indexOffset = int64(binary.LittleEndian.Uint64(header[len(mmapMagic)+16:]))
+	if t.indexOffset < int64(mmapHeaderSize) || count > uint64(r.Len())/8 || t.indexOffset+8*int64(count) != int64(r.Len()) {
+		r.Close()
+		return nil, fmt.Errorf("%s is truncated or corrupted", filename)
+	}
+	t.count = int(count)
+	return t, nil
+}
+
+func (t *mmapTable) close() error {
+	return t.r.Close()
+}
+
+// uvarintAt reads a uvarint at off, and returns it and the offset right after it.
+func (t *mmapTable) uvarintAt(off int64) (uint64, int64, error) {
+	var buf [binary.MaxVarintLen64]byte
+	n, _ := t.r.ReadAt(buf[:], off) // reading less is fine near the end.
+	value, size := binary.Uvarint(buf[:n])
+	if size <= 0 || off+int64(size) > t.indexOffset {
+		return 0, 0, fmt.Errorf("corrupted mmap database: bad length at offset %d", off)
+	}
+	return value, off + int64(size), nil
+}
+
+// bytesAt reads n bytes of data at off.
+func (t *mmapTable) bytesAt(off int64, n uint64) ([]byte, error) {
+	if n > uint64(t.indexOffset-off) {
+		return nil, fmt.Errorf("corrupted mmap database: %d bytes at offset %d go past the data", n, off)
+	}
+	buf := make([]byte, n)
+	_, err := t.r.ReadAt(buf, off)
+	return buf, err
+}
+
+// keyAt returns the i-th key, and the offset of its value.
+func (t *mmapTable) keyAt(i int) (string, int64, error) {
+	var entry [8]byte
+	if _, err := t.r.ReadAt(entry[:], t.indexOffset+8*int64(i)); err != nil {
+		return "", 0, err
+	}
+	off := int64(binary.LittleEndian.Uint64(entry[:]))
+	if off < int64(mmapHeaderSize) || off >= t.indexOffset {
+		return "", 0, fmt.Errorf("corrupted mmap database: key #%d is at offset %d", i, off)
+	}
+	length, off, err := t.uvarintAt(off)
+	if err != nil {
+		return "", 0, err
+	}
+	key, err := t.bytesAt(off, length)
+	return string(key), off + int64(length), err
+}
+
+// record returns the i-th key and its value.
+func (t *mmapTable) record(i int) (string, []byte, error) {
+	key, off, err := t.keyAt(i)
+	if err != nil {
+		return "", nil, err
+	}
+	length, off, err := t.uvarintAt(off)
+	if err != nil {
+		return "", nil, err
+	}
+	value, err := t.bytesAt(off, length)
+	return key, value, err
+}
+
+// search returns the position of the first key which is not before key, and whether it is key itself.
+func (t *mmapTable) search(key string) (int, bool, error) {
+	var err error
+	i := sort.Search(t.count, func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var k string
+		k, _, err = t.keyAt(i)
+		return k >= key
+	})
+	if err != nil || i == t.count {
+		return i, false, err
+	}
+	k, _, err := t.keyAt(i)
+	return i, k == key, err
+}
+
+// writeMmapTable merges the sources (oldest first) into a new file; when a key is in more than
+// one, the newest wins. The index is written into a temporary file first, and then appended, so
+// that building a huge database does not need memory for all offsets. Unless sync is set, the file
+// is left for the kernel to write whenever it likes.
+func writeMmapTable(filename string, sources []mmapSource, sync bool) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	index, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(index.Name())
+	defer index.Close()
+
+	w := bufio.NewWriterSize(f, 64<<10)
+	iw := bufio.NewWriterSize(index, 64<<10)
+	w.Write(make([]byte, mmapHeaderSize)) // written for real at the end.
+	offset := int64(mmapHeaderSize)
+	count := 0
+	var lengths [binary.MaxVarintLen64]byte
+	var entry [8]byte
+	err = mergeMmapSources(sources, func(key string, value []byte) error {
+		binary.LittleEndian.PutUint64(entry[:], uint64(offset))
+		iw.Write(entry[:])
+		for _, data := range [][]byte{[]byte(key), value} {
+			n, _ := w.Write(lengths[:binary.PutUvarint(lengths[:], uint64(len(data)))])
+			m, _ := w.Write(data)
+			offset += int64(n + m)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = iw.Flush(); err != nil {
+		return err
+	}
+	if _, err = index.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, index); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	header := make([]byte, mmapHeaderSize)
+	copy(header, mmapMagic)
+	binary.LittleEndian.PutUint32(header[len(mmapMagic):], mmapVersion)
+	binary.LittleEndian.PutUint64(header[len(mmapMagic)+8:], uint64(count))
+	binary.LittleEndian.PutUint64(header[len(mmapMagic)+16:], uint64(offset))
+	if _, err = f.WriteAt(header, 0); err != nil {
+		return err
+	}
+	if sync {
+		if err = f.Sync(); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// mmapSource is something sorted to be merged: the old table, a run, or a batch being written as a run.
+type mmapSource interface {
+	// next returns the next pair, or io.EOF.
+	next() (kvPair, error)
+}
+
+type mmapTableSource struct {
+	table	*mmapTable
+	i		int
+}
+
+func (s *mmapTableSource) next() (kvPair, error) {
+	if s.i >= s.table.count {
+		return kvPair{}, io.EOF
+	}
+	key, value, err := s.table.record(s.i)
+	s.i++
+	return kvPair{key, value}, err
+}
+
+// mmapPairsSource is a batch, already sorted, with no repeated keys.
+type mmapPairsSource struct {
+	pairs	[]kvPair
+}
+
+func (s *mmapPairsSource) next() (kvPair, error) {
+	if len(s.pairs) == 0 {
+		return kvPair{}, io.EOF
+	}
+	pair := s.pairs[0]
+	s.pairs = s.pairs[1:]
+	return pair, nil
+}
+
+// mmapHead is the next pair from one of the sources being merged; age is the source's position.
+type mmapHead struct {
+	pair	kvPair
+	age		int
+}
+
+// mmapHeap keeps the heads in key order; for the same key, the newest source comes first.
+type mmapHeap []mmapHead
+
+func (h mmapHeap) Len() int {
+	return len(h)
+}
+
+func (h mmapHeap) Less(i, j int) bool {
+	if h[i].pair.key != h[j].pair.key {
+		return h[i].pair.key < h[j].pair.key
+	}
+	return h[i].age > h[j].age
+}
+
+func (h mmapHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *mmapHeap) Push(x any) {
+	*h = append(*h, x.(mmapHead))
+}
+
+func (h *mmapHeap) Pop() any {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
+
+// mergeMmapSources calls fn for every key in the sources, in key order, with its newest value.
+func mergeMmapSources(sources []mmapSource, fn func(key string, value []byte) error) error {
+	h := make(mmapHeap, 0, len(sources))
+	for age, source := range sources {
+		pair, err := source.next()
+		if err == io.EOF {
+			continue
+		} else if err != nil {
+			return err
+		}
+		h = append(h, mmapHead{pair, age})
+	}
+	heap.Init(&h)
+	last := "" // keys are never empty.
+	for h.Len() > 0 {
+		head := h[0]
+		if head.pair.key != last { // otherwise, an older value for the key we just wrote.
+			if err := fn(head.pair.key, head.pair.value); err != nil {
+				return err
+			}
+			last = head.pair.key
+		}
+		pair, err := sources[head.age].next()
+		if err == io.EOF {
+			heap.Pop(&h)
+			continue
+		} else if err != nil {
+			return err
+		}
+		h[0] = mmapHead{pair, head.age}
+		heap.Fix(&h, 0)
+	}
+	return nil
+}
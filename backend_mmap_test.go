@@ -0,0 +1,158 @@
+// Checks that mmap databases are built correctly from several batches, even when the build is interrupted, and are read-only afterwards.
+package gosl
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMmapBackend(t *testing.T) {
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+	b, err := openMmap(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.get("anything"); err != errKeyNotFound {
+		t.Errorf("get() on an empty database: %v", err)
+	}
+	// Two batches, out of order, where the second one replaces some keys of the first.
+	for _, batch := range [][]int{{5, 3, 1, 4, 2}, {2, 7, 6}} {
+		var pairs []kvPair
+		for _, i := range batch {
+			pairs = append(pairs, kvPair{fmt.Sprintf("key %d", i), []byte(fmt.Sprintf("value %d from batch %v", i, batch))})
+		}
+		if err := b.put(pairs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(b backend, want string) {
+		t.Helper()
+		if value, err := b.get("key 2"); err != nil || string(value) != "value 2 from batch [2 7 6]" {
+			t.Errorf("get(\"key 2\") = %q, %v", value, err)
+		}
+		if value, err := b.get("key 5"); err != nil || string(value) != "value 5 from batch [5 3 1 4 2]" {
+			t.Errorf("get(\"key 5\") = %q, %v", value, err)
+		}
+		if _, err := b.get("key 9"); err != errKeyNotFound {
+			t.Errorf("get(\"key 9\"): %v", err)
+		}
+		var keys []string
+		if err := b.scan("key ", func(key string, value []byte) bool {
+			keys = append(keys, key)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(keys) != want {
+			t.Errorf("scan() = %v", keys)
+		}
+	}
+	check(b, "[key 1 key 2 key 3 key 4 key 5 key 6 key 7]")
+	// Reading does not merge anything: writing and reading in turns must not copy the whole database each time.
+	if _, err := os.Stat(config.Path()); !os.IsNotExist(err) {
+		t.Errorf("reading merged the runs: %v", err)
+	}
+	if err := b.put([]kvPair{{"key 8", []byte("value 8")}}); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := b.get("key 8"); err != nil || string(value) != "value 8" {
+		t.Errorf("get(\"key 8\") right after put() = %q, %v", value, err)
+	}
+	// It can still be written to by the same process, even after being merged.
+	if err := b.(*mmapBackend).compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.put([]kvPair{{"key 2", []byte("value 2 from batch [2 7 6]")}}); err != nil {
+		t.Fatal(err)
+	}
+	// Closing does not finish the build: whoever opens it next carries on from the runs.
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err = openMmap(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(b, "[key 1 key 2 key 3 key 4 key 5 key 6 key 7 key 8]")
+	if !b.(*mmapBackend).writable || len(b.(*mmapBackend).runs) != 1 {
+		t.Errorf("an unfinished build reopened with writable %v, and %d runs", b.(*mmapBackend).writable, len(b.(*mmapBackend).runs))
+	}
+	if err := b.(*mmapBackend).compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(config.Path() + ".building"); !os.IsNotExist(err) {
+		t.Errorf("the build marker is still there after compact(): %v", err)
+	}
+
+	b, err = openMmap(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(b, "[key 1 key 2 key 3 key 4 key 5 key 6 key 7 key 8]")
+	if value, err := b.get("key 8"); err != nil || string(value) != "value 8" {
+		t.Errorf("get(\"key 8\") after reopening = %q, %v", value, err)
+	}
+	if err := b.put([]kvPair{{"key 9", []byte("value 9")}}); err == nil {
+		t.Error("put() into a database which had been built already should fail")
+	}
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(config.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.Path(), data[:len(data)-3], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openMmap(config); err == nil {
+		t.Error("a truncated database should not open")
+	}
+}
+
+// Scanning goes through the table and the runs at the same time, in chunks, with the newest value for each key.
+func TestMmapBackendScanRuns(t *testing.T) {
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+	b, err := openMmap(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+	const keys = 2*mmapScanChunk + 10
+	for batch := range 3 {
+		var pairs []kvPair
+		for i := batch; i < keys; i += 2 { // batches 0 and 2 have the same keys, but for key 0.
+			pairs = append(pairs, kvPair{fmt.Sprintf("key %05d", i), []byte(fmt.Sprint(batch))})
+		}
+		if err := b.put(pairs); err != nil {
+			t.Fatal(err)
+		}
+		if batch == 0 {
+			if err := b.(*mmapBackend).compact(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	n := 0
+	err = b.scan("key ", func(key string, value []byte) bool {
+		want, batch := fmt.Sprintf("key %05d", n), 2-n%2
+		if n == 0 {
+			batch = 0 // batch 2 starts at 2.
+		}
+		if key != want || string(value) != fmt.Sprint(batch) {
+			t.Fatalf("scan() returned %q = %q, want %q = %d", key, value, want, batch)
+		}
+		n++
+		return true
+	})
+	if err != nil || n != keys {
+		t.Errorf("scan() went through %d keys, want %d: %v", n, keys, err)
+	}
+}
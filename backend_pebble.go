@@ -0,0 +1,217 @@
+// Pebble backend, i.e. CockroachDB's RocksDB-inspired LSM tree, written in Go.
+// Small writes go through batches, like in LevelDB; big ones (i.e. import blocks) are sorted and
+// written straight into an SST file, which Pebble then links into the LSM tree as it is. That skips
+// both the write-ahead log and the memtable, and leaves nothing for compactions to rewrite later.
+package gosl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cockroachdb/pebble/v2"
+	"github.com/cockroachdb/pebble/v2/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/v2/sstable"
+	"github.com/cockroachdb/pebble/v2/vfs"
+)
+
+func init() {
+	backends["pebble"] = openPebble
+}
+
+// pebbleIngestThreshold is how many pairs put() needs to get to write an SST file instead of a batch.
+// Ingesting has a fixed cost (it waits for the memtable to be flushed, if it overlaps), so it is
+// only worth it for big batches.
+const pebbleIngestThreshold = 10000
+
+// pebbleIngestPrefix is the start of the names of the temporary SST files; anything with it which
+// is still in the database directory when it is opened was left behind by a crash.
+const pebbleIngestPrefix = "gosl-ingest-"
+
+// pebbleBackend wraps a Pebble database, which is a directory.
+type pebbleBackend struct {
+	db		*pebble.DB
+	path	string
+}
+
+// pebbleLogger sends Pebble's messages to our own logs. Pebble is quite chatty, so what it
+// considers information is just debugging for us.
+type pebbleLogger struct{}
+
+func (pebbleLogger) Infof(format string, args ...any) {
+	log.Debugf("[pebble] "+format, args...)
+}
+
+func (pebbleLogger) Errorf(format string, args ...any) {
+	log.Errorf("[pebble] "+format, args...)
+}
+
+func (pebbleLogger) Fatalf(format string, args ...any) {
+	log.Fatalf("[pebble] "+format, args...)
+}
+
+// openPebble opens (or creates) a Pebble database.
+func openPebble(config Config) (backend, error) {
+	db, err := pebble.Open(config.Path(), &pebble.Options{Logger: pebbleLogger{}})
+	if err != nil {
+		return nil, err
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(config.Path(), pebbleIngestPrefix+"*"))
+	for _, leftover := range leftovers {
+		os.Remove(leftover)
+	}
+	return &pebbleBackend{db: db, path: config.Path()}, nil
+}
+
+func (b *pebbleBackend) get(key string) ([]byte, error) {
+	value, closer, err := b.db.Get([]byte(key))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return nil, errKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return bytes.Clone(value), nil // only valid until closer is closed.
+}
+
+// put writes small batches in a single (synced) batch, and big ones by ingesting an SST file.
+func (b *pebbleBackend) put(pairs []kvPair) error {
+	if len(pairs) >= pebbleIngestThreshold {
+		return b.ingest(pairs)
+	}
+	batch := b.db.NewBatch()
+	defer batch.Close()
+	for _, pair := range pairs {
+		if err := batch.Set([]byte(pair.key), pair.value, nil); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+// ingest writes pairs into a new SST file in the database directory (so that Pebble can just
+// hard-link it), and ingests it. SST files must be sorted, without repeated keys, so pairs are
+// sorted first; when a key is repeated, the last value wins, just as it would in a batch.
+// Ingested files always go above everything already in the database, so they overwrite older values.
+func (b *pebbleBackend) ingest(pairs []kvPair) error {
+	sorted := slices.Clone(pairs)
+	slices.SortStableFunc(sorted, func(a, b kvPair) int {
+		return strings.Compare(a.key, b.key)
+	})
+
+	f, err := os.CreateTemp(b.path, pebbleIngestPrefix+"*.sst")
+	if err != nil {
+		return err
+	}
+	filename := f.Name()
+	f.Close()
+	defer os.Remove(filename) // Pebble usually removes it itself, but not if anything fails.
+
+	file, err := vfs.Default.Create(filename, vfs.WriteCategoryUnspecified)
+	if err != nil {
+		return err
+	}
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(file), sstable.WriterOptions{TableFormat: b.db.TableFormat()})
+	for i, pair := range sorted {
+		if i+1 < len(sorted) && sorted[i+1].key == pair.key {
+			continue // superseded by the next one.
+		}
+		if err := w.Set([]byte(pair.key), pair.value); err != nil {
+			w.Close()
+			return fmt.Errorf("could not write %s: %w", filename, err)
+		}
+	}
+	// Closing the writer also syncs and closes the file.
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("could not write %s: %w", filename, err)
+	}
+	return b.db.Ingest(context.Background(), []string{filename})
+}
+
+func (b *pebbleBackend) delete(keys []string) error {
+	batch := b.db.NewBatch()
+	defer batch.Close()
+	for _, key := range keys {
+		if err := batch.Delete([]byte(key), nil); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+func (b *pebbleBackend) scan(prefix string, fn func(key string, value []byte) bool) error {
+	options := &pebble.IterOptions{LowerBound: []byte(prefix)}
+	if end := prefixEnd(prefix); end != "" { // an empty (but not nil) upper bound would be before everything.
+		options.UpperBound = []byte(end)
+	}
+	iter, err := b.db.NewIter(options)
+	if err != nil {
+		return err
+	}
+	for iter.First(); iter.Valid(); iter.Next() {
+		value, err := iter.ValueAndErr()
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		// the iterator reuses its buffers, so we have to copy the value.
+		if !fn(string(iter.Key()), bytes.Clone(value)) {
+			break
+		}
+	}
+	return iter.Close()
+}
+
+// snapshot iterates over a Pebble snapshot, which does not change while we go through it.
+func (b *pebbleBackend) snapshot(fn func(key string, value []byte) error) error {
+	snap := b.db.NewSnapshot()
+	defer snap.Close()
+	iter, err := snap.NewIter(nil)
+	if err != nil {
+		return err
+	}
+	for iter.First(); iter.Valid(); iter.Next() {
+		value, err := iter.ValueAndErr()
+		if err == nil {
+			err = fn(string(iter.Key()), bytes.Clone(value))
+		}
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+// compact flushes the memtable, and compacts the whole key range, so that lookups after a big
+// import do not have to go through many overlapping files. Ingested files are mostly in the right
+// place already, so this is fairly quick.
+func (b *pebbleBackend) compact() error {
+	if err := b.db.Flush(); err != nil {
+		return err
+	}
+	iter, err := b.db.NewIter(nil)
+	if err != nil {
+		return err
+	}
+	var first, last []byte
+	if iter.First() {
+		first = bytes.Clone(iter.Key())
+	}
+	if iter.Last() {
+		last = append(bytes.Clone(iter.Key()), 0) // the end of the range is exclusive.
+	}
+	if err := iter.Close(); err != nil || first == nil {
+		return err
+	}
+	return b.db.Compact(context.Background(), first, last, true)
+}
+
+func (b *pebbleBackend) close() error {
+	return b.db.Close()
+}
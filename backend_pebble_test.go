@@ -0,0 +1,62 @@
+// Checks that big batches, which go through SST ingestion, behave just like small ones.
+package gosl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPebbleIngest(t *testing.T) {
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+	b, err := openPebble(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+
+	// A small batch first, so that ingestion has to overwrite it.
+	if err := b.put([]kvPair{{"key 00000", []byte("old")}}); err != nil {
+		t.Fatal(err)
+	}
+	// In reverse order, with a repeated key, whose last value must win.
+	var pairs []kvPair
+	for i := pebbleIngestThreshold; i >= 0; i-- {
+		pairs = append(pairs, kvPair{fmt.Sprintf("key %05d", i), []byte("new")})
+	}
+	pairs = append(pairs, kvPair{"key 00001", []byte("newest")})
+	if err := b.put(pairs); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{"key 00000": "new", "key 00001": "newest", "key 00002": "new"} {
+		if value, err := b.get(key); err != nil || string(value) != want {
+			t.Errorf("get(%q) = %q, %v; want %q", key, value, err, want)
+		}
+	}
+	var previous string
+	count := 0
+	err = b.scan("key ", func(key string, value []byte) bool {
+		if key <= previous {
+			t.Errorf("scan: %q after %q", key, previous)
+		}
+		previous = key
+		count++
+		return true
+	})
+	if err != nil || count != pebbleIngestThreshold+1 {
+		t.Errorf("scan found %d keys (%v), want %d", count, err, pebbleIngestThreshold+1)
+	}
+	entries, err := os.ReadDir(filepath.Join(config.Dir, config.DatabaseName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), pebbleIngestPrefix) {
+			t.Errorf("temporary file %s was left behind", entry.Name())
+		}
+	}
+}
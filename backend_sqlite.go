@@ -0,0 +1,364 @@
+// SQLite backend, using a pure-Go (cgo-free) driver, so it cross-compiles like everything else.
+// Unlike the other backends, the data is not kept as opaque JSON, but in tables that anyone can
+// query with the sqlite3 command-line tool, e.g.:
+//
+//	SELECT grid, count(*) FROM avatars GROUP BY grid;
+//	SELECT name, uuid FROM avatars WHERE name_normalised LIKE 'gwyneth %';
+//
+// `avatars` has what is stored under each UUID, i.e. the current name and grid of every avatar;
+// `names` has what is stored under each name, which is usually the same, except for old names of
+// avatars who changed them (which still point to their UUID).
+// The Store only ever stores avatar records under their name or UUID, and that's all this backend
+// accepts. Older versions, however, sometimes wrote records whose name (or UUID) is not the key
+// they are stored under — say, an empty name — and those are stored as if they had the right one.
+package gosl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	backends["sqlite"] = openSQLite
+}
+
+// sqliteSchemaVersion goes into PRAGMA user_version, for future changes to the schema.
+const sqliteSchemaVersion = 1
+
+// sqliteSchema is created when the database is new.
+const sqliteSchema = `
+CREATE TABLE avatars (
+	uuid			TEXT PRIMARY KEY,
+	name			TEXT NOT NULL,
+	name_normalised	TEXT NOT NULL COLLATE NOCASE,	-- lower case, single spaces (see normaliseName); NOCASE lets LIKE use the index.
+	grid			TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX avatars_name_normalised ON avatars (name_normalised);
+CREATE INDEX avatars_grid ON avatars (grid);
+CREATE TABLE names (
+	name			TEXT PRIMARY KEY,
+	uuid			TEXT NOT NULL,
+	grid			TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX names_uuid ON names (uuid);
+`
+
+// sqliteScanChunk is how many rows scan reads from each table per query; the query is not kept
+// open while fn runs, since fn may call get().
+const sqliteScanChunk = 1000
+
+// sqliteBackend wraps a SQLite database, which is a single file (plus its write-ahead log).
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+// openSQLite opens (or creates) a SQLite database, in WAL mode, so that lookups do not wait for writes.
+func openSQLite(config Config) (backend, error) {
+	dsn := "file:" + (&url.URL{Path: config.Path()}).EscapedPath() +
+		"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	b := &sqliteBackend{db: db}
+	if err = b.createSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not set up SQLite database %q: %w", config.Path(), err)
+	}
+	return b, nil
+}
+
+// createSchema creates the tables if the database is new, and refuses databases from the future.
+func (b *sqliteBackend) createSchema() error {
+	var version int
+	if err := b.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	switch version {
+	case sqliteSchemaVersion:
+		return nil
+	case 0:
+		tx, err := b.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err = tx.Exec(sqliteSchema); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", sqliteSchemaVersion)); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	return fmt.Errorf("unknown schema version %d (this version of gosl-basics only knows %d)", version, sqliteSchemaVersion)
+}
+
+// normaliseName is what goes into name_normalised: lower case, with single spaces.
+func normaliseName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// sqliteTable says where a key lives; like boltBucket(), it depends only on the key.
+func sqliteTable(key string) string {
+	if isValidUUID(key) {
+		return "avatars"
+	}
+	return "names"
+}
+
+// sqliteValue encodes a row the same way the Store encodes its records.
+func sqliteValue(name, uuid, grid string) []byte {
+	value, _ := json.Marshal(AvatarUUID{AvatarName: name, UUID: uuid, Grid: grid}) // cannot fail with just strings.
+	return value
+}
+
+func (b *sqliteBackend) get(key string) ([]byte, error) {
+	var name, uuid, grid string
+	var err error
+	if sqliteTable(key) == "avatars" {
+		uuid = key
+		err = b.db.QueryRow("SELECT name, grid FROM avatars WHERE uuid = ?", key).Scan(&name, &grid)
+	} else {
+		name = key
+		err = b.db.QueryRow("SELECT uuid, grid FROM names WHERE name = ?", key).Scan(&uuid, &grid)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return sqliteValue(name, uuid, grid), nil
+}
+
+// put writes everything in a single transaction, using prepared statements; a whole import
+// batch (BatchBlock records) is a single transaction.
+func (b *sqliteBackend) put(pairs []kvPair) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // does nothing after Commit().
+	putAvatar, err := tx.Prepare(`INSERT INTO avatars (uuid, name, name_normalised, grid) VALUES (?, ?, ?, ?)
+		ON CONFLICT (uuid) DO UPDATE SET name = excluded.name, name_normalised = excluded.name_normalised, grid = excluded.grid`)
+	if err != nil {
+		return err
+	}
+	defer putAvatar.Close()
+	putName, err := tx.Prepare(`INSERT INTO names (name, uuid, grid) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET uuid = excluded.uuid, grid = excluded.grid`)
+	if err != nil {
+		return err
+	}
+	defer putName.Close()
+	for _, pair := range pairs {
+		var record AvatarUUID
+		if err := json.Unmarshal(pair.value, &record); err != nil {
+			return fmt.Errorf("SQLite can only store avatar records, and the value for %q is not one: %w", pair.key, err)
+		}
+		// The key is what the record is found by, so that's what wins.
+		if sqliteTable(pair.key) == "avatars" {
+			if record.UUID != pair.key {
+				log.Warningf("record under %q has UUID %q; storing it under its key\n", pair.key, record.UUID)
+				record.UUID = pair.key
+			}
+			_, err = putAvatar.Exec(record.UUID, record.AvatarName, normaliseName(record.AvatarName), record.Grid)
+		} else {
+			if record.AvatarName != pair.key {
+				log.Warningf("record under %q has name %q; storing it under its key\n", pair.key, record.AvatarName)
+				record.AvatarName = pair.key
+			}
+			_, err = putName.Exec(record.AvatarName, record.UUID, record.Grid)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (b *sqliteBackend) delete(keys []string) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, key := range keys {
+		column := "name"
+		if sqliteTable(key) == "avatars" {
+			column = "uuid"
+		}
+		if _, err := tx.Exec("DELETE FROM "+sqliteTable(key)+" WHERE "+column+" = ?", key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sqliteCursor reads one table in key order, sqliteScanChunk rows at a time.
+type sqliteCursor struct {
+	db			*sql.DB
+	table		string
+	query		string	// takes the last key read, and the range of keys with the prefix (?3 only if there is an upper limit).
+	from, to	string	// the range; to is empty if there is no upper limit.
+	after		string
+	buffer		[]kvPair
+	finished	bool
+}
+
+// newSQLiteCursor returns a cursor for every key in the table starting with prefix. BINARY collation
+// (the default) compares bytes, so the order is the same as for the other backends.
+func newSQLiteCursor(db *sql.DB, table string, prefix string) *sqliteCursor {
+	key := "name"
+	if table == "avatars" {
+		key = "uuid"
+	}
+	c := &sqliteCursor{db: db, table: table, from: prefix, to: prefixEnd(prefix)}
+	// Both limits must be plain comparisons, so that SQLite can use them to search the index.
+	where := fmt.Sprintf("%s > ?1 AND %s >= ?2", key, key)
+	if c.to != "" {
+		where += fmt.Sprintf(" AND %s < ?3", key)
+	}
+	c.query = fmt.Sprintf("SELECT name, uuid, grid FROM %s WHERE %s ORDER BY %s LIMIT %d", table, where, key, sqliteScanChunk)
+	return c
+}
+
+// prefixEnd returns the first string after all those starting with prefix, or "" if there is none
+// (i.e. the prefix is empty, or all 0xff).
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// next returns the next row, or nil if there are no more.
+func (c *sqliteCursor) next() (*kvPair, error) {
+	if len(c.buffer) == 0 && !c.finished {
+		args := []any{c.after, c.from}
+		if c.to != "" {
+			args = append(args, c.to)
+		}
+		rows, err := c.db.Query(c.query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name, uuid, grid string
+			if err := rows.Scan(&name, &uuid, &grid); err != nil {
+				return nil, err
+			}
+			key := name
+			if c.table == "avatars" {
+				key = uuid
+			}
+			c.buffer = append(c.buffer, kvPair{key, sqliteValue(name, uuid, grid)})
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		c.finished = len(c.buffer) < sqliteScanChunk
+		if len(c.buffer) > 0 {
+			c.after = c.buffer[len(c.buffer)-1].key
+		}
+	}
+	if len(c.buffer) == 0 {
+		return nil, nil
+	}
+	pair := &c.buffer[0]
+	c.buffer = c.buffer[1:]
+	return pair, nil
+}
+
+// scan merges both tables, in key order; no key is ever in both.
+func (b *sqliteBackend) scan(prefix string, fn func(key string, value []byte) bool) error {
+	cursors := [2]*sqliteCursor{newSQLiteCursor(b.db, "names", prefix), newSQLiteCursor(b.db, "avatars", prefix)}
+	var heads [2]*kvPair
+	for i, cursor := range cursors {
+		var err error
+		if heads[i], err = cursor.next(); err != nil {
+			return err
+		}
+	}
+	for {
+		next := -1
+		for i := range heads {
+			if heads[i] != nil && (next < 0 || heads[i].key < heads[next].key) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return nil
+		}
+		if !fn(heads[next].key, heads[next].value) {
+			return nil
+		}
+		var err error
+		if heads[next], err = cursors[next].next(); err != nil {
+			return err
+		}
+	}
+}
+
+// snapshot reads both tables in a single read transaction; in WAL mode, it sees the database as it
+// was when the transaction started, while everybody else keeps writing.
+func (b *sqliteBackend) snapshot(fn func(key string, value []byte) error) error {
+	tx, err := b.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"names", "avatars"} {
+		rows, err := tx.Query("SELECT name, uuid, grid FROM " + table)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name, uuid, grid string
+			if err = rows.Scan(&name, &uuid, &grid); err != nil {
+				break
+			}
+			key := name
+			if table == "avatars" {
+				key = uuid
+			}
+			if err = fn(key, sqliteValue(name, uuid, grid)); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compact updates the statistics the query planner uses (which matters after a big import),
+// and moves everything from the write-ahead log into the database file.
+func (b *sqliteBackend) compact() error {
+	if _, err := b.db.Exec("PRAGMA optimize"); err != nil {
+		return err
+	}
+	_, err := b.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
+
+func (b *sqliteBackend) close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,69 @@
+// Checks that the SQLite backend keeps the KV semantics (order, stale names) on top of its tables.
+package gosl
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestSQLiteBackend(t *testing.T) {
+	config := DefaultConfig()
+	config.Dir = t.TempDir()
+	config.Database = "sqlite"
+	config.BloomFilter = false
+	store, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	db := store.db.(*sqliteBackend)
+
+	// More than sqliteScanChunk avatars, so that scans need several queries on each table.
+	for i := range sqliteScanChunk + 10 {
+		if err := store.Insert(AvatarUUID{fmt.Sprintf("Resident %04d", i), fmt.Sprintf("%08x-9360-4f6d-a924-000000000001", i), "Production"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A name change leaves the old name behind, pointing to the same UUID.
+	if err := store.Insert(AvatarUUID{"Someone Else", "00000001-9360-4f6d-a924-000000000001", "Agni"}); err != nil {
+		t.Fatal(err)
+	}
+	if record, err := store.Lookup("Resident 0001"); err != nil || record.UUID != "00000001-9360-4f6d-a924-000000000001" {
+		t.Errorf("old name: got %+v, %v", record, err)
+	}
+
+	var keys []string
+	if err := db.scan("", func(key string, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := 2*(sqliteScanChunk+10) + 1; len(keys) != want || !sort.StringsAreSorted(keys) {
+		t.Errorf("scan returned %d keys (want %d), sorted: %v", len(keys), want, sort.StringsAreSorted(keys))
+	}
+	count := 0
+	if err := db.scan("Resident 10", func(string, []byte) bool { count++; return true }); err != nil || count != 10 {
+		t.Errorf("scan with prefix returned %d keys (want 10), %v", count, err)
+	}
+
+	// The whole point: the data can be queried with SQL.
+	var name, grid string
+	err = db.db.QueryRow("SELECT name, grid FROM avatars WHERE name_normalised LIKE 'someone %'").Scan(&name, &grid)
+	if err != nil || name != "Someone Else" || grid != "Agni" {
+		t.Errorf("SQL query returned %q, %q, %v", name, grid, err)
+	}
+
+	// Anything which is not an avatar record is refused...
+	if err := db.put([]kvPair{{"Somebody", []byte("not JSON")}}); err == nil {
+		t.Error("put() accepted something which is not an avatar record")
+	}
+	// ... but records under some other name, which older versions wrote, are stored under their key.
+	if err := db.put([]kvPair{{"Somebody", []byte(`{"name":"Nobody","key":"00000001-9360-4f6d-a924-000000000001"}`)}}); err != nil {
+		t.Errorf("put() refused a record under somebody else's name: %v", err)
+	}
+	if record, err := store.Lookup("Somebody"); err != nil || record.AvatarName != "Somebody" {
+		t.Errorf("record stored under somebody else's name: got %+v, %v", record, err)
+	}
+}
@@ -0,0 +1,329 @@
+// Online backups, and restoring them into any backend.
+// Unlike Export(), a backup has every key and value exactly as they are in the database, and it is
+// taken from a consistent snapshot (for the backends which can do that), so it can be made while
+// the server is running and being written to.
+//
+// The file format is our own, so that a backup from Badger can be restored into LevelDB, and so on:
+//
+//	"GOSLBKUP" + version (uint32, big-endian)
+//	then, gzip'ed:
+//	  a line of JSON with the metadata (see BackupInfo)
+//	  for each key: uvarint key length, key, uvarint value length, value
+//	  uvarint 0 (no key is empty, so this marks the end)
+//	  uvarint number of keys
+//	  SHA-256 of everything above, from the JSON line onwards
+//
+// Restore() reads the whole backup and checks the count and the checksum before writing anything,
+// so that a corrupted (or truncated) backup never gets half-restored.
+package gosl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	backupMagic		= "GOSLBKUP"
+	backupVersion	= 1
+	// Sanity limits, so that a corrupted length does not make us allocate gigabytes.
+	maxBackupKeyLength		= 64 << 10
+	maxBackupValueLength	= 16 << 20
+)
+
+// ErrCorruptedBackup is returned (wrapped) when a backup file fails verification.
+var ErrCorruptedBackup = errors.New("corrupted backup")
+
+// BackupInfo describes a backup; everything but Keys comes from the metadata at its start.
+type BackupInfo struct {
+	Version		int			`json:"version"`
+	Created		time.Time	`json:"created"`
+	Database	string		`json:"database"`	// the backend it was taken from.
+	Keys		int			`json:"-"`			// how many keys it has.
+}
+
+// Backup writes a backup of the whole database to w, and returns what was written.
+// Backends which support it are read from a point-in-time snapshot, so the server can keep
+// running (and writing) meanwhile; the others are scanned as they are.
+func (s *Store) Backup(ctx context.Context, w io.Writer) (BackupInfo, error) {
+	return writeBackup(ctx, w, s.config.Database, func(writeRecord func(key string, value []byte) error) error {
+		if snap, ok := s.db.(snapshotter); ok {
+			return snap.snapshot(writeRecord)
+		}
+		var writeErr error
+		err := s.db.scan("", func(key string, value []byte) bool {
+			writeErr = writeRecord(key, value)
+			return writeErr == nil
+		})
+		if err == nil {
+			err = writeErr
+		}
+		return err
+	})
+}
+
+// writeBackup writes a backup of whatever each() goes through, which calls writeRecord for every
+// key, and stops (returning the error) if it fails; database is just for the metadata.
+func writeBackup(ctx context.Context, w io.Writer, database string, each func(writeRecord func(key string, value []byte) error) error) (BackupInfo, error) {
+	info := BackupInfo{Version: backupVersion, Created: time.Now().UTC(), Database: database}
+	header := make([]byte, len(backupMagic)+4)
+	copy(header, backupMagic)
+	binary.BigEndian.PutUint32(header[len(backupMagic):], backupVersion)
+	if _, err := w.Write(header); err != nil {
+		return info, err
+	}
+	zw := gzip.NewWriter(w)
+	checksum := sha256.New()
+	bw := bufio.NewWriterSize(io.MultiWriter(zw, checksum), 64<<10)
+
+	metadata, err := json.Marshal(info)
+	if err != nil {
+		return info, err
+	}
+	bw.Write(metadata)
+	bw.WriteByte('\n')
+
+	var lengths [binary.MaxVarintLen64]byte
+	writeRecord := func(key string, value []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bw.Write(lengths[:binary.PutUvarint(lengths[:], uint64(len(key)))])
+		bw.WriteString(key)
+		bw.Write(lengths[:binary.PutUvarint(lengths[:], uint64(len(value)))])
+		_, err := bw.Write(value) // bufio remembers the first error, so checking the last write is enough.
+		info.Keys++
+		return err
+	}
+	if err = each(writeRecord); err != nil {
+		return info, err
+	}
+
+	bw.Write(lengths[:binary.PutUvarint(lengths[:], 0)])
+	bw.Write(lengths[:binary.PutUvarint(lengths[:], uint64(info.Keys))])
+	if err = bw.Flush(); err != nil {
+		return info, err
+	}
+	// The checksum goes straight into gzip, since it is not part of what it checks.
+	if _, err = zw.Write(checksum.Sum(nil)); err != nil {
+		return info, err
+	}
+	return info, zw.Close()
+}
+
+// VerifyBackup reads a whole backup and checks its format, count and checksum, without writing anything.
+func VerifyBackup(r io.Reader) (BackupInfo, error) {
+	return readBackup(r, nil)
+}
+
+// Restore restores the backup in filename into this store, which must be empty.
+// The backup is verified first, and then read again to be written in batches of BatchBlock keys;
+// it does not matter which backend it was taken from.
+func (s *Store) Restore(ctx context.Context, filename string) (BackupInfo, error) {
+	if fi, err := os.Stat(filename); err != nil {
+		return BackupInfo{}, err
+	} else if !fi.Mode().IsRegular() {
+		return BackupInfo{}, fmt.Errorf("%s is not a regular file; backups are read twice, so they cannot be restored from a pipe", filename)
+	}
+	verify := func() (BackupInfo, error) {
+		f, err := os.Open(filename)
+		if err != nil {
+			return BackupInfo{}, err
+		}
+		defer f.Close()
+		return VerifyBackup(f)
+	}
+	info, err := verify()
+	if err != nil {
+		return info, err
+	}
+	if empty, err := s.isEmpty(); err != nil {
+		return info, err
+	} else if !empty {
+		return info, fmt.Errorf("%s (%s) is not empty; restore into a new database", s.config.Path(), s.config.Database)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+	if err = s.beginBloomBatch(); err != nil {
+		return info, err
+	}
+	defer s.saveBloomFilter()
+	batch := make([]kvPair, 0, s.config.BatchBlock)
+	keys := make([]string, 0, s.config.BatchBlock)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.db.put(batch); err != nil {
+			return err
+		}
+		s.bloomAddBatch(keys...)
+		batch, keys = batch[:0], keys[:0]
+		return nil
+	}
+	count := 0
+	_, err = readBackup(f, func(key string, value []byte) error {
+		batch = append(batch, kvPair{key, value})
+		keys = append(keys, key)
+		count++
+		if len(batch) < s.config.BatchBlock {
+			return nil
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		log.Infof("restored %d keys so far\n", count)
+		return ctx.Err()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// Since the backup had been verified, this is not about the backup, but about us.
+		return info, fmt.Errorf("restore stopped after %d keys, the database is incomplete: %w", count, err)
+	}
+	if c, ok := s.db.(compacter); ok {
+		checkErr(c.compact())
+	}
+	return info, nil
+}
+
+// readBackup reads a backup, calling fn (if not nil) for each key, and checks everything
+// once it gets to the end. Note that fn gets called before the checksum is checked!
+func readBackup(r io.Reader, fn func(key string, value []byte) error) (BackupInfo, error) {
+	var info BackupInfo
+	corrupted := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrCorruptedBackup, fmt.Sprintf(format, args...))
+	}
+	header := make([]byte, len(backupMagic)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return info, corrupted("no header: %v", err)
+	}
+	if string(header[:len(backupMagic)]) != backupMagic {
+		return info, corrupted("this is not a gosl-basics backup")
+	}
+	if version := binary.BigEndian.Uint32(header[len(backupMagic):]); version != backupVersion {
+		return info, fmt.Errorf("backup format version %d is not supported (only %d is)", version, backupVersion)
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return info, corrupted("%v", err)
+	}
+	defer zr.Close()
+	zbr := bufio.NewReaderSize(zr, 64<<10)
+	br := &hashingReader{r: zbr, hash: sha256.New()}
+
+	metadata, err := br.readLine()
+	if err != nil {
+		return info, corrupted("no metadata: %v", err)
+	}
+	if err = json.Unmarshal(metadata, &info); err != nil {
+		return info, corrupted("invalid metadata: %v", err)
+	}
+	readUvarint := func() (uint64, error) {
+		return binary.ReadUvarint(br)
+	}
+	readBytes := func(n uint64) ([]byte, error) {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(br, buf)
+		return buf, err
+	}
+	count := 0
+	for {
+		keyLength, err := readUvarint()
+		if err != nil {
+			return info, corrupted("truncated after %d keys: %v", count, err)
+		}
+		if keyLength == 0 {
+			break
+		}
+		if keyLength > maxBackupKeyLength {
+			return info, corrupted("key #%d is %d bytes long", count+1, keyLength)
+		}
+		key, err := readBytes(keyLength)
+		if err != nil {
+			return info, corrupted("truncated after %d keys: %v", count, err)
+		}
+		valueLength, err := readUvarint()
+		if err == nil && valueLength > maxBackupValueLength {
+			return info, corrupted("value for key #%d is %d bytes long", count+1, valueLength)
+		}
+		var value []byte
+		if err == nil {
+			value, err = readBytes(valueLength)
+		}
+		if err != nil {
+			return info, corrupted("truncated after %d keys: %v", count, err)
+		}
+		count++
+		if fn != nil {
+			if err := fn(string(key), value); err != nil {
+				return info, err
+			}
+		}
+	}
+	expected, err := readUvarint()
+	if err != nil {
+		return info, corrupted("no key count: %v", err)
+	}
+	if expected != uint64(count) {
+		return info, corrupted("it should have %d keys, but it has %d", expected, count)
+	}
+	// The checksum itself is read directly, so that it does not get hashed.
+	checksum := make([]byte, sha256.Size)
+	if _, err = io.ReadFull(zbr, checksum); err != nil {
+		return info, corrupted("no checksum at the end: %v", err)
+	}
+	if !bytes.Equal(checksum, br.hash.Sum(nil)) {
+		return info, corrupted("checksum mismatch")
+	}
+	// Reading to the end also makes gzip check its own CRC.
+	if trailing, err := io.Copy(io.Discard, zbr); err != nil {
+		return info, corrupted("%v", err)
+	} else if trailing > 0 {
+		return info, corrupted("%d unexpected bytes after the checksum", trailing)
+	}
+	info.Keys = count
+	return info, nil
+}
+
+// hashingReader hashes exactly what is read through it, unlike io.TeeReader under a bufio.Reader,
+// which would also hash whatever bufio reads ahead.
+type hashingReader struct {
+	r		*bufio.Reader
+	hash	hash.Hash
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	return n, err
+}
+
+func (h *hashingReader) ReadByte() (byte, error) {
+	b, err := h.r.ReadByte()
+	if err == nil {
+		h.hash.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (h *hashingReader) readLine() ([]byte, error) {
+	line, err := h.r.ReadBytes('\n')
+	h.hash.Write(line)
+	return line, err
+}
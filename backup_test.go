@@ -0,0 +1,179 @@
+// Checks that backups from every backend can be restored into another one, and that corrupted or failed ones are caught.
+package gosl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	openStore := func(database, name string) *Store {
+		config := DefaultConfig()
+		config.Database = database
+		config.Dir = dir
+		config.DatabaseName = name
+		config.BatchBlock = 2
+		config.BloomCapacity = 1000
+		store, err := Open(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+	ctx := context.Background()
+	for _, database := range []string{"badger", "leveldb", "buntdb", "boltdb", "sqlite", "pebble", "memory"} {
+		t.Run(database, func(t *testing.T) {
+			source := openStore(database, "source-"+database)
+			for i := 1; i <= 5; i++ {
+				record := AvatarUUID{fmt.Sprintf("Resident %d", i), fmt.Sprintf("a2e76fcd-9360-4f6d-a924-%012d", i), "Production"}
+				if err := source.Insert(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Deleted keys must not come back from the dead.
+			if err := source.Delete(AvatarUUID{AvatarName: "Resident 3", UUID: "a2e76fcd-9360-4f6d-a924-000000000003"}); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			info, err := source.Backup(ctx, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Keys != 8 {
+				t.Errorf("backup has %d keys, want 8", info.Keys)
+			}
+			if verified, err := VerifyBackup(bytes.NewReader(buf.Bytes())); err != nil || verified.Keys != 8 || verified.Database != database {
+				t.Errorf("VerifyBackup() = %+v, %v", verified, err)
+			}
+			// Flipping any byte (here, somewhere in the middle) must be noticed.
+			corrupted := bytes.Clone(buf.Bytes())
+			corrupted[len(corrupted)/2] ^= 0x55
+			if _, err := VerifyBackup(bytes.NewReader(corrupted)); !errors.Is(err, ErrCorruptedBackup) {
+				t.Errorf("corrupted backup: got %v, want ErrCorruptedBackup", err)
+			}
+			if _, err := VerifyBackup(bytes.NewReader(buf.Bytes()[:buf.Len()-10])); !errors.Is(err, ErrCorruptedBackup) {
+				t.Errorf("truncated backup: got %v, want ErrCorruptedBackup", err)
+			}
+
+			// Restore into a different backend.
+			filename := filepath.Join(dir, database+".backup")
+			if err := os.WriteFile(filename, buf.Bytes(), 0600); err != nil {
+				t.Fatal(err)
+			}
+			other := map[string]string{"badger": "leveldb", "leveldb": "buntdb", "buntdb": "boltdb", "boltdb": "sqlite", "sqlite": "pebble", "pebble": "memory", "memory": "badger"}[database]
+			destination := openStore(other, "restored-"+database)
+			if _, err := destination.Restore(ctx, filename); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := destination.Lookup("Resident 5"); err != nil {
+				t.Errorf("Lookup() after restoring: %v", err)
+			}
+			if _, err := destination.Lookup("Resident 3"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("deleted avatar was restored: %v", err)
+			}
+			if report, err := destination.Check(ctx); err != nil || !report.OK() || report.Keys != 8 {
+				t.Errorf("Check() after restoring: %+v, %v", report, err)
+			}
+			if _, err := destination.Restore(ctx, filename); err == nil {
+				t.Error("restoring into a non-empty database should fail")
+			}
+		})
+	}
+}
+
+func TestAdminBackup(t *testing.T) {
+	config := DefaultConfig()
+	config.Database = "memory"
+	config.BloomFilter = false
+	store, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Insert(AvatarUUID{"Resident 1", "a2e76fcd-9360-4f6d-a924-000000000001", "Production"}); err != nil {
+		t.Fatal(err)
+	}
+	get := func(handler http.Handler, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/backup", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	if w := get(NewHandler(store), "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("without an admin token configured: got %d, want 404", w.Code)
+	}
+	handler := NewHandler(store, WithAdminToken("secret"))
+	if w := get(handler, "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("with the wrong token: got %d, want 401", w.Code)
+	}
+	w := get(handler, "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("with the right token: got %d, want 200", w.Code)
+	}
+	if info, err := VerifyBackup(w.Body); err != nil || info.Keys != 2 {
+		t.Errorf("VerifyBackup() = %+v, %v", info, err)
+	}
+}
+
+// failingScanBackend fails half-way through any scan; it also hides the snapshots of the backend, so that backups scan.
+type failingScanBackend struct {
+	backend
+}
+
+func (b failingScanBackend) scan(prefix string, fn func(key string, value []byte) bool) error {
+	b.backend.scan(prefix, func(key string, value []byte) bool {
+		fn(key, value)
+		return false
+	})
+	return errors.New("disk on fire")
+}
+
+// A backup which fails after it started must be cut short, and must not take the whole process down with it
+// (FastCGI has nothing to recover a panic).
+func TestAdminBackupFails(t *testing.T) {
+	store := openMemoryStore(t)
+	for i := range 10 {
+		if err := store.Insert(AvatarUUID{fmt.Sprintf("Resident %d", i), fmt.Sprintf("a2e76fcd-9360-4f6d-a924-%012d", i), "Production"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.db = failingScanBackend{store.db}
+	handler := NewHandler(store, WithAdminToken("secret"))
+
+	// httptest.ResponseRecorder cannot close the connection, like FastCGI.
+	if rec := apiRequest(handler, http.MethodGet, "/api/v1/admin/backup", "", "Authorization", "Bearer secret"); rec.Code == http.StatusOK {
+		if _, err := VerifyBackup(rec.Body); err == nil {
+			t.Error("VerifyBackup() accepted a failed backup")
+		}
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/admin/backup", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err = io.ReadAll(resp.Body); err == nil {
+		t.Error("the body of a failed backup ended normally")
+	}
+}
@@ -0,0 +1,179 @@
+// Benchmarks for every backend, on synthetic data; this is where the table in the README comes from.
+//
+//	go test -run '^$' -bench Import -benchtime 1x
+//	go test -run '^$' -bench Lookup -benchtime 20000x
+//
+// BenchmarkImport reports the disk size of the database after the import; BenchmarkLookup reports
+// the median and 99th percentile of single lookups, on top of the mean (ns/op).
+package gosl
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+var benchAvatars = flag.Int("bench.avatars", 100000, "how many avatars to import for the benchmarks")
+
+// syntheticAvatars returns n avatars with unique names, always the same ones, in random order (always the same one, too).
+func syntheticAvatars(n int) []AvatarUUID {
+	random := rand.New(rand.NewPCG(20211030, 1))
+	avatars := make([]AvatarUUID, n)
+	for i, number := range random.Perm(n) {
+		avatars[i] = AvatarUUID{
+			AvatarName:	fmt.Sprintf("Avatar%07d %s", number, []string{"Resident", "Linden", "Babbage", "Lane"}[number%4]),
+			UUID:		fmt.Sprintf("%08x-%04x-4%03x-a%03x-%012x", random.Uint32(), random.IntN(1<<16), random.IntN(1<<12), random.IntN(1<<12), random.Int64N(1<<48)),
+			Grid:		"Production",
+		}
+	}
+	return avatars
+}
+
+// syntheticCSV returns the avatars as a CSV file, as if it came from W-Hat; if sorted, lines are sorted by UUID.
+func syntheticCSV(avatars []AvatarUUID, sorted bool) []byte {
+	if sorted {
+		avatars = slices.Clone(avatars)
+		slices.SortFunc(avatars, func(a, b AvatarUUID) int { return strings.Compare(a.UUID, b.UUID) })
+	}
+	var buf bytes.Buffer
+	for _, avatar := range avatars {
+		fmt.Fprintf(&buf, "%s,%s\n", avatar.UUID, avatar.AvatarName)
+	}
+	return buf.Bytes()
+}
+
+// quietLog keeps the log at ERROR while b runs, which is what gosl-basics uses by default;
+// otherwise, writing a debug message for every lookup would be measured, too.
+func quietLog(b *testing.B) {
+	level := logging.GetLevel("gosl")
+	logging.SetLevel(logging.ERROR, "gosl")
+	b.Cleanup(func() { logging.SetLevel(level, "gosl") })
+}
+
+// benchBackends are all backends which keep something on disk; memory is just a map.
+func benchBackends() []string {
+	var databases []string
+	for _, database := range Backends() {
+		if database != "memory" {
+			databases = append(databases, database)
+		}
+	}
+	return databases
+}
+
+// benchConfig returns the default configuration, for a database in dir.
+func benchConfig(database string, dir string) Config {
+	config := DefaultConfig()
+	config.Database = database
+	config.Dir = dir
+	return config
+}
+
+// benchImport imports data into a new database in dir, and closes it.
+func benchImport(b *testing.B, config Config, data []byte) {
+	b.Helper()
+	store, err := Open(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err = store.ImportReader(context.Background(), bytes.NewReader(data)); err != nil {
+		b.Fatal(err)
+	}
+	if err = store.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// diskUsage returns the size of everything in dir, except for the Bloom filter, which is the
+// same size for every backend (and depends on BloomCapacity, not on what was imported).
+func diskUsage(b *testing.B, dir string) int64 {
+	b.Helper()
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasSuffix(path, ".bloom") {
+			return err
+		}
+		info, err := entry.Info()
+		if err == nil {
+			size += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return size
+}
+
+// BenchmarkImport imports *benchAvatars avatars, in random order and sorted, into each backend, with the defaults.
+func BenchmarkImport(b *testing.B) {
+	quietLog(b)
+	avatars := syntheticAvatars(*benchAvatars)
+	for _, order := range []string{"shuffled", "sorted"} {
+		data := syntheticCSV(avatars, order == "sorted")
+		for _, database := range benchBackends() {
+			b.Run(database+"/"+order, func(b *testing.B) {
+				var size int64
+				for range b.N {
+					b.StopTimer()
+					dir := b.TempDir()
+					b.StartTimer()
+					benchImport(b, benchConfig(database, dir), data)
+					b.StopTimer()
+					size = diskUsage(b, dir)
+					b.StartTimer()
+				}
+				b.ReportMetric(float64(size)/1e6, "MB-on-disk")
+			})
+		}
+	}
+}
+
+// BenchmarkLookup looks up avatar names picked at random, one at a time, through Store.Lookup(),
+// in a database which has been opened again after the import, and warmed up.
+func BenchmarkLookup(b *testing.B) {
+	quietLog(b)
+	avatars := syntheticAvatars(*benchAvatars)
+	data := syntheticCSV(avatars, false)
+	for _, database := range benchBackends() {
+		b.Run(database, func(b *testing.B) {
+			config := benchConfig(database, b.TempDir())
+			benchImport(b, config, data)
+			store, err := Open(config)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer store.Close()
+			random := rand.New(rand.NewPCG(1, 2))
+			for range min(len(avatars), 10000) {
+				store.Lookup(avatars[random.IntN(len(avatars))].AvatarName)
+			}
+
+			durations := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := range b.N {
+				name := avatars[random.IntN(len(avatars))].AvatarName
+				start := time.Now()
+				record, err := store.Lookup(name)
+				durations[i] = time.Since(start)
+				if err != nil || record.AvatarName != name {
+					b.Fatalf("Lookup(%q) = %+v, %v", name, record, err)
+				}
+			}
+			b.StopTimer()
+			slices.Sort(durations)
+			b.ReportMetric(float64(durations[len(durations)/2].Nanoseconds()), "p50-ns")
+			b.ReportMetric(float64(durations[len(durations)*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Bloom filter over all avatar names and UUIDs stored in the KV database.
+// About half of all queries are for names that are not in the database at all, and each of those
+// used to cost a full backend lookup (plus an error in the logs); the filter allows us to
+// answer 'definitely not here' without touching the backend.
+//
+// The filter is persisted next to the database (`<databaseName>.bloom`); names added after the
+// last full save are appended to a small journal (`<databaseName>.bloom.journal`) so that we
+// never have to rewrite the whole filter on every single insert.
+// Imports (and restores, and migrations) only save the filter at the end, so, while they run, there is
+// a marker (`<databaseName>.bloom.dirty`) next to it; if it is still there when starting, the import
+// never finished, the filter on disk is missing keys, and it gets rebuilt.
+package gosl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// bloomFilename returns the path of the persisted filter, which lives next to the database.
+func (s *Store) bloomFilename() string {
+	return s.config.Path() + ".bloom"
+}
+
+// bloomJournalFilename returns the path of the journal with the keys added since the last save.
+func (s *Store) bloomJournalFilename() string {
+	return s.config.Path() + ".bloom.journal"
+}
+
+// bloomDirtyFilename returns the path of the marker which says that the filter on disk is not to be trusted.
+func (s *Store) bloomDirtyFilename() string {
+	return s.config.Path() + ".bloom.dirty"
+}
+
+// errBloomDirty is why the filter on disk gets rebuilt when the dirty marker is found.
+var errBloomDirty = errors.New("an import, restore or migration did not finish, so it may be missing keys")
+
+// loadBloomFilter reads the persisted filter from disk and replays the journal on top of it.
+// If there is no filter on disk yet, it is rebuilt from whatever is already stored on the database;
+// we cannot simply start with an empty filter, or we would report existing entries as missing.
+func (s *Store) loadBloomFilter() {
+	if !s.config.BloomFilter {
+		log.Debug("Bloom filter disabled by configuration")
+		return
+	}
+	time_start := time.Now()
+	filter := bloom.NewWithEstimates(s.config.BloomCapacity, s.config.BloomFalsePositive)
+	if s.config.diskless() {
+		// Nothing on disk, and nothing to save; whatever is in the database (i.e. nothing) goes in.
+		checkErr(s.rebuildBloomFilter(filter))
+		s.bloomMutex.Lock()
+		s.bloomFilter = filter
+		s.bloomMutex.Unlock()
+		return
+	}
+
+	f, err := os.Open(s.bloomFilename())
+	if _, dirtyErr := os.Stat(s.bloomDirtyFilename()); err == nil && dirtyErr == nil {
+		f.Close()
+		err = errBloomDirty
+	}
+	if err != nil {
+		if errors.Is(err, errBloomDirty) {
+			log.Warningf("not using Bloom filter %q, rebuilding it — %v\n", s.bloomFilename(), err)
+		} else if !os.IsNotExist(err) {
+			log.Errorf("could not open Bloom filter %q, rebuilding it — error was: %v\n", s.bloomFilename(), err)
+		} else {
+			log.Infof("no Bloom filter found at %q, rebuilding it from the %s database\n", s.bloomFilename(), s.config.Database)
+		}
+		if err = s.rebuildBloomFilter(filter); err != nil {
+			log.Errorf("could not rebuild Bloom filter, lookups will always go to the database — error was: %v\n", err)
+			return
+		}
+	} else {
+		_, err = filter.ReadFrom(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			log.Errorf("corrupted Bloom filter %q, rebuilding it — error was: %v\n", s.bloomFilename(), err)
+			filter = bloom.NewWithEstimates(s.config.BloomCapacity, s.config.BloomFalsePositive)
+			if err = s.rebuildBloomFilter(filter); err != nil {
+				log.Errorf("could not rebuild Bloom filter, lookups will always go to the database — error was: %v\n", err)
+				return
+			}
+		}
+	}
+	// Replay the journal, if any; after a rebuild, everything in it is already in the filter.
+	if journal, err := os.Open(s.bloomJournalFilename()); err == nil {
+		scanner := bufio.NewScanner(journal)
+		replayed := 0
+		for scanner.Scan() {
+			filter.AddString(scanner.Text())
+			replayed++
+		}
+		checkErr(scanner.Err())
+		journal.Close()
+		log.Debugf("replayed %d journal entries into the Bloom filter\n", replayed)
+	}
+
+	s.bloomMutex.Lock()
+	s.bloomFilter = filter
+	s.bloomMutex.Unlock()
+
+	// Fold the journal into the filter on disk, so that it does not grow forever.
+	s.saveBloomFilter()
+	log.Infof("Bloom filter ready (≈%d entries) in %v\n", filter.ApproximatedSize(), time.Since(time_start))
+}
+
+// saveBloomFilter writes the full filter to disk (atomically, via a temporary file) and truncates the journal.
+func (s *Store) saveBloomFilter() {
+	s.bloomMutex.RLock()
+	defer s.bloomMutex.RUnlock()
+	if s.bloomFilter == nil || s.config.diskless() {
+		return
+	}
+	tmpFilename := s.bloomFilename() + ".tmp"
+	f, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Errorf("could not save Bloom filter to %q: %v\n", tmpFilename, err)
+		return
+	}
+	w := bufio.NewWriter(f)
+	if _, err = s.bloomFilter.WriteTo(w); err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Errorf("could not save Bloom filter to %q: %v\n", tmpFilename, err)
+		os.Remove(tmpFilename)
+		return
+	}
+	if err = os.Rename(tmpFilename, s.bloomFilename()); err != nil {
+		log.Errorf("could not rename Bloom filter %q to %q: %v\n", tmpFilename, s.bloomFilename(), err)
+		return
+	}
+	if err = os.Remove(s.bloomJournalFilename()); err != nil && !os.IsNotExist(err) {
+		checkErr(err)
+	}
+	// The filter on disk has everything now, even if an import had been interrupted.
+	if err = os.Remove(s.bloomDirtyFilename()); err != nil && !os.IsNotExist(err) {
+		checkErr(err)
+	}
+	log.Debugf("Bloom filter saved to %q\n", s.bloomFilename())
+}
+
+// bloomMayContain returns false only if the item is definitely *not* in the database.
+// If the filter is disabled, it always returns true.
+func (s *Store) bloomMayContain(searchItem string) bool {
+	s.bloomMutex.RLock()
+	defer s.bloomMutex.RUnlock()
+	if s.bloomFilter == nil {
+		return true
+	}
+	return s.bloomFilter.TestString(searchItem)
+}
+
+// bloomAdd adds freshly written keys to the filter, and appends them to the journal on disk.
+// Used for single writes; imports use bloomAddBatch() and save the whole filter at the end (see beginBloomBatch).
+func (s *Store) bloomAdd(keys ...string) {
+	s.bloomMutex.Lock()
+	defer s.bloomMutex.Unlock()
+	if s.bloomFilter == nil {
+		return
+	}
+	for _, key := range keys {
+		s.bloomFilter.AddString(key)
+	}
+	if s.config.diskless() {
+		return
+	}
+	journal, err := os.OpenFile(s.bloomJournalFilename(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Errorf("could not open Bloom filter journal %q: %v\n", s.bloomJournalFilename(), err)
+		return
+	}
+	defer journal.Close()
+	for _, key := range keys {
+		if _, err = journal.WriteString(key + "\n"); err != nil {
+			log.Errorf("could not write to Bloom filter journal %q: %v\n", s.bloomJournalFilename(), err)
+			return
+		}
+	}
+}
+
+// beginBloomBatch leaves the dirty marker on disk; it must be called before writing anything which
+// only goes into the filter with bloomAddBatch(), so that, if we get killed before the filter is saved,
+// it will be rebuilt.
+func (s *Store) beginBloomBatch() error {
+	s.bloomMutex.RLock()
+	defer s.bloomMutex.RUnlock()
+	if s.bloomFilter == nil || s.config.diskless() {
+		return nil
+	}
+	f, err := os.OpenFile(s.bloomDirtyFilename(), os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not mark the Bloom filter as out of date: %w", err)
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("could not mark the Bloom filter as out of date: %w", err)
+	}
+	return f.Close()
+}
+
+// bloomAddBatch adds keys to the in-memory filter only; the caller must have called beginBloomBatch()
+// before writing, and is responsible for calling saveBloomFilter() once it is done, whatever happens.
+func (s *Store) bloomAddBatch(keys ...string) {
+	s.bloomMutex.Lock()
+	defer s.bloomMutex.Unlock()
+	if s.bloomFilter == nil {
+		return
+	}
+	for _, key := range keys {
+		s.bloomFilter.AddString(key)
+	}
+}
+
+// rebuildBloomFilter goes through all keys on the database and adds them to the filter.
+// This is slow for big databases, but only happens once, when there is no filter on disk.
+func (s *Store) rebuildBloomFilter(filter *bloom.BloomFilter) error {
+	count := 0
+	err := s.db.scan("", func(key string, value []byte) bool {
+		filter.AddString(key)
+		count++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	log.Debugf("added %d existing key(s) to the Bloom filter\n", count)
+	return nil
+}
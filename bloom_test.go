@@ -0,0 +1,190 @@
+// Checks that the Bloom filter survives restarts (journal, rebuilds, interrupted imports), and never hides what is on the database.
+package gosl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// crashingReader returns whatever is in r, and then, instead of io.EOF, calls crash and fails.
+type crashingReader struct {
+	r     io.Reader
+	crash func()
+}
+
+var errCrash = errors.New("killed")
+
+func (cr *crashingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if err == io.EOF {
+		cr.crash()
+		return n, errCrash
+	}
+	return n, err
+}
+
+// An import that gets killed half-way leaves the old filter on disk; opening the store again must not
+// trust it, or everything imported so far would be reported as missing.
+func TestBloomFilterInterruptedImport(t *testing.T) {
+	config := DefaultConfig()
+	config.Database = "boltdb"
+	config.Dir = t.TempDir()
+	config.BatchBlock = 100
+	config.BloomCapacity = 1000
+	store, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Insert(AvatarUUID{"Resident 0", "a2e76fcd-9360-4f6d-a924-000000000000", "Production"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Close(); err != nil { // the filter on disk now has Resident 0, and nothing else.
+		t.Fatal(err)
+	}
+
+	if store, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	// The process gets killed after reading this many records, i.e. in the middle of a batch.
+	const records = 1050
+	var csv strings.Builder
+	for i := 1; i <= records; i++ {
+		fmt.Fprintf(&csv, "a2e76fcd-9360-4f6d-a924-%012d,Resident %d\n", i, i)
+	}
+	// When the process gets killed, whatever Bloom files are on disk at that moment stay there;
+	// nothing that happens afterwards (such as deferred saves) gets to run.
+	bloomFiles := []string{store.bloomFilename(), store.bloomJournalFilename(), store.bloomDirtyFilename()}
+	onDisk := make(map[string][]byte)
+	crash := func() {
+		for _, filename := range bloomFiles {
+			if data, err := os.ReadFile(filename); err == nil {
+				onDisk[filename] = data
+			}
+		}
+	}
+	if _, err = store.ImportReader(context.Background(), &crashingReader{strings.NewReader(csv.String()), crash}); !errors.Is(err, errCrash) {
+		t.Fatalf("ImportReader() = %v, want the crash", err)
+	}
+	if err = store.db.close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range bloomFiles {
+		if data, ok := onDisk[filename]; ok {
+			err = os.WriteFile(filename, data, 0600)
+		} else {
+			err = os.Remove(filename)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := onDisk[store.bloomDirtyFilename()]; !ok {
+		t.Error("there was no dirty marker while importing")
+	}
+
+	if store, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	// Whatever made it to the database must be found; the last, unfinished batch never did.
+	committed := records / config.BatchBlock * config.BatchBlock
+	for i := 0; i <= records; i++ {
+		name := fmt.Sprintf("Resident %d", i)
+		record, err := store.Lookup(name)
+		if found := err == nil && record.AvatarName == name; found != (i <= committed) {
+			t.Errorf("after the crash, Lookup(%q) = %+v, %v", name, record, err)
+		}
+	}
+	if _, err := os.Stat(store.bloomDirtyFilename()); !os.IsNotExist(err) {
+		t.Errorf("the dirty marker is still there after rebuilding the filter: %v", err)
+	}
+}
+
+// bloomTestConfig is a small database on disk, so that the filter gets saved next to it.
+func bloomTestConfig(t *testing.T) Config {
+	config := DefaultConfig()
+	config.Database = "boltdb"
+	config.Dir = t.TempDir()
+	config.BloomCapacity = 1000
+	return config
+}
+
+// Single inserts only go to the journal; if the process gets killed, replaying it must bring them back.
+func TestBloomFilterJournal(t *testing.T) {
+	config := bloomTestConfig(t)
+	store, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Close(); err != nil { // an empty filter on disk.
+		t.Fatal(err)
+	}
+	if store, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	record := AvatarUUID{"Resident One", "a2e76fcd-9360-4f6d-a924-000000000001", "Production"}
+	if err = store.Insert(record); err != nil {
+		t.Fatal(err)
+	}
+	if journal, err := os.ReadFile(store.bloomJournalFilename()); err != nil || string(journal) != record.AvatarName+"\n"+record.UUID+"\n" {
+		t.Errorf("journal after Insert() = %q, %v", journal, err)
+	}
+	if err = store.db.close(); err != nil { // killed, so the filter is never saved.
+		t.Fatal(err)
+	}
+
+	if store, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, item := range []string{record.AvatarName, record.UUID} {
+		if found, err := store.Lookup(item); err != nil || found != record {
+			t.Errorf("after replaying the journal, Lookup(%q) = %+v, %v", item, found, err)
+		}
+	}
+	if _, err := os.Stat(store.bloomJournalFilename()); !os.IsNotExist(err) {
+		t.Errorf("the journal was not folded into the filter: %v", err)
+	}
+}
+
+// Without a filter on disk, or with a broken one, it is rebuilt from the database, and keeps answering misses.
+func TestBloomFilterRebuild(t *testing.T) {
+	record := AvatarUUID{"Resident One", "a2e76fcd-9360-4f6d-a924-000000000001", "Production"}
+	for damage, spoil := range map[string]func(filename string) error{
+		"missing":   os.Remove,
+		"corrupted": func(filename string) error { return os.WriteFile(filename, []byte("not a Bloom filter"), 0600) },
+	} {
+		t.Run(damage, func(t *testing.T) {
+			config := bloomTestConfig(t)
+			store, err := Open(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = store.Insert(record); err != nil {
+				t.Fatal(err)
+			}
+			if err = store.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err = spoil(store.bloomFilename()); err != nil {
+				t.Fatal(err)
+			}
+
+			if store, err = Open(config); err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if found, err := store.Lookup(record.AvatarName); err != nil || found != record {
+				t.Errorf("after rebuilding the filter, Lookup(%q) = %+v, %v", record.AvatarName, found, err)
+			}
+			if _, err := store.Lookup("Nobody Here"); !errors.Is(err, ErrNotFound) || store.Stats().BloomRejected != 1 {
+				t.Errorf("Lookup() of an unknown name = %v, with %d rejected by the filter", err, store.Stats().BloomRejected)
+			}
+		})
+	}
+}
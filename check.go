@@ -0,0 +1,94 @@
+// Consistency checks for the whole database; this is what `gosl-basics check` runs.
+package gosl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// maxCheckProblems is how many problems Check() describes; after that, it just counts them.
+const maxCheckProblems = 100
+
+// CheckReport is what Check() found.
+type CheckReport struct {
+	Keys			int			// everything in the database.
+	Avatars			int			// records stored under their UUID.
+	Names			int			// records stored under their name.
+	ProblemCount	int			// how many problems were found...
+	Problems		[]string	// ... and the first maxCheckProblems of them, in plain English.
+}
+
+// OK is true if nothing was wrong.
+func (r CheckReport) OK() bool {
+	return r.ProblemCount == 0
+}
+
+// problem records a problem found by Check().
+func (r *CheckReport) problem(format string, args ...any) {
+	r.ProblemCount++
+	if len(r.Problems) < maxCheckProblems {
+		r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+	}
+}
+
+// Check goes through every entry in the database and makes sure that:
+//   - it can be decoded;
+//   - it is stored either under its avatar's name or under its UUID, and that the other one exists, too,
+//     and points back to the same avatar;
+//   - the Bloom filter knows about it (otherwise, lookups for it would fail!).
+//
+// Problems with the data are in the report; the error is only for not being able to read the database
+// (or the context being cancelled), in which case the report is incomplete.
+// It reads the whole database, and is meant to be run while nothing else is writing to it.
+func (s *Store) Check(ctx context.Context) (CheckReport, error) {
+	var report CheckReport
+	if err := s.Ping(); err != nil {
+		return report, err
+	}
+	var lookupErr error
+	err := s.db.scan("", func(key string, value []byte) bool {
+		report.Keys++
+		var record AvatarUUID
+		if err := json.Unmarshal(value, &record); err != nil {
+			report.problem("undecodable record under %q: %v", key, err)
+			return ctx.Err() == nil
+		}
+		if !s.bloomMayContain(key) {
+			report.problem("%q is missing from the Bloom filter; delete %s to have it rebuilt", key, s.bloomFilename())
+		}
+		var other string // the key under which the same record should also be.
+		switch key {
+		case record.UUID:
+			report.Avatars++
+			other = record.AvatarName
+		case record.AvatarName:
+			report.Names++
+			other = record.UUID
+		default:
+			report.problem("record for %q [%s] is stored under %q", record.AvatarName, record.UUID, key)
+			return ctx.Err() == nil
+		}
+		otherValue, err := s.db.get(other)
+		if errors.Is(err, errKeyNotFound) {
+			report.problem("%q is stored under %q, but not under %q", record.AvatarName, key, other)
+			return ctx.Err() == nil
+		} else if err != nil {
+			lookupErr = err
+			return false
+		}
+		var otherRecord AvatarUUID
+		if err := json.Unmarshal(otherValue, &otherRecord); err == nil && otherRecord.UUID != record.UUID {
+			report.problem("%q [%s] is stored under %q, which belongs to %q [%s]", record.AvatarName, record.UUID, other, otherRecord.AvatarName, otherRecord.UUID)
+		} // if it could not be decoded, we'll find out when we get there.
+		return ctx.Err() == nil
+	})
+	if err == nil {
+		err = lookupErr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return report, err
+}
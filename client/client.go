@@ -0,0 +1,309 @@
+// Package client is a typed Go client for the HTTP API of a remote gosl-basics server,
+// so that other Go services do not have to build URLs by hand and parse plain-text replies.
+//
+//	c := client.New("https://name2key.example.com")	// or wherever it is mounted under FastCGI
+//	avatar, err := c.Name2Key(ctx, "Some Resident")
+//	if errors.Is(err, client.ErrNotFound) { ... }
+//
+// It only uses the standard library, i.e. it does not pull in any of the database backends.
+// Requests that fail with 429 or 5xx (or do not get through at all) are retried with exponential backoff.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiPrefix is where the API lives on the server, relative to BaseURL.
+const apiPrefix = "/api/v1"
+
+// maxBatch is the most items that the server accepts per batch lookup; Lookup() splits bigger ones.
+const maxBatch = 1000
+
+// ErrNotFound is returned when the avatar name or UUID is not known to the server.
+var ErrNotFound = errors.New("avatar not found")
+
+// Avatar is an avatar record, as stored by the server.
+type Avatar struct {
+	Name	string	`json:"name"`
+	Key		string	`json:"key"`
+	Grid	string	`json:"grid"`	// "Production" for the main Second Life grid.
+}
+
+// Result is the answer for one item of a batch lookup.
+type Result struct {
+	Query	string	`json:"query"`	// what was asked for, name or UUID.
+	Found	bool	`json:"found"`
+	Avatar
+}
+
+// Health is what the server replies to a health check.
+type Health struct {
+	Status		string	`json:"status"`	// "ok" or "unavailable".
+	Database	string	`json:"database"`
+	Error		string	`json:"error,omitempty"`
+}
+
+// Stats are the server's counters since it started.
+type Stats struct {
+	Database		string			`json:"database"`
+	Uptime			time.Duration	`json:"uptime"`
+	Lookups			uint64			`json:"lookups"`
+	Hits			uint64			`json:"hits"`
+	Misses			uint64			`json:"misses"`
+	BloomRejected	uint64			`json:"bloomRejected"`
+	Coalesced		uint64			`json:"coalesced"`
+	Errors			uint64			`json:"errors"`
+	Inserts			uint64			`json:"inserts"`
+	Deletes			uint64			`json:"deletes"`
+	Imported		uint64			`json:"imported"`
+}
+
+// Error is returned when the server replies with an error status (other than a plain 'not found').
+type Error struct {
+	StatusCode	int
+	Message		string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gosl server replied %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client talks to one gosl-basics server. Change the fields before using it, not afterwards;
+// after that, it is safe for concurrent use.
+type Client struct {
+	BaseURL			string			// e.g. "http://localhost:3000", or the FastCGI mount point.
+	HTTPClient		*http.Client	// http.DefaultClient if nil.
+	SigningSecret	string			// must match the server's, if it requires signed writes.
+	AdminToken		string			// sent with writes, if set; for servers with an admin token but no signing secret.
+	MaxRetries		int				// how many times to retry on 429, 5xx or network errors; 0 means no retries.
+	MinBackoff		time.Duration	// wait before the first retry; doubles on each retry...
+	MaxBackoff		time.Duration	// ... up to this.
+}
+
+// New returns a client for the server at baseURL, with sensible defaults for retries.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:	baseURL,
+		HTTPClient:	&http.Client{Timeout: 30 * time.Second},
+		MaxRetries:	3,
+		MinBackoff:	100 * time.Millisecond,
+		MaxBackoff:	5 * time.Second,
+	}
+}
+
+// Name2Key returns the record for an avatar name, or ErrNotFound.
+func (c *Client) Name2Key(ctx context.Context, name string) (Avatar, error) {
+	var avatar Avatar
+	err := c.do(ctx, http.MethodGet, "/avatars?"+url.Values{"name": {name}}.Encode(), nil, nil, true, &avatar)
+	return avatar, err
+}
+
+// Key2Name returns the record for an avatar UUID, or ErrNotFound.
+func (c *Client) Key2Name(ctx context.Context, key string) (Avatar, error) {
+	var avatar Avatar
+	err := c.do(ctx, http.MethodGet, "/avatars/"+url.PathEscape(strings.TrimSpace(key)), nil, nil, true, &avatar)
+	return avatar, err
+}
+
+// Lookup looks up many avatar names and/or UUIDs at once; the results are in the same order.
+// Items which are not found just have Found set to false. Big batches are split into several requests.
+func (c *Client) Lookup(ctx context.Context, items []string) ([]Result, error) {
+	results := make([]Result, 0, len(items))
+	for start := 0; start < len(items); start += maxBatch {
+		chunk := items[start:min(start+maxBatch, len(items))]
+		body, err := json.Marshal(chunk)
+		if err != nil {
+			return results, err
+		}
+		var chunkResults []Result
+		if err = c.do(ctx, http.MethodPost, "/lookup", body, nil, true, &chunkResults); err != nil {
+			return results, err
+		}
+		results = append(results, chunkResults...)
+	}
+	return results, nil
+}
+
+// Register creates or replaces the record for an avatar, signing the request if SigningSecret is set
+// (and sending AdminToken, if that is set), and returns the record as stored by the server.
+// Servers with neither a signing secret nor an admin token refuse it.
+func (c *Client) Register(ctx context.Context, avatar Avatar) (Avatar, error) {
+	avatar.Name, avatar.Key = strings.TrimSpace(avatar.Name), strings.TrimSpace(avatar.Key)
+	body, err := json.Marshal(avatar)
+	if err != nil {
+		return avatar, err
+	}
+	var stored Avatar
+	sign := func(req *http.Request) {
+		c.sign(req, avatar.Name, avatar.Key)
+	}
+	err = c.do(ctx, http.MethodPut, "/avatars/"+url.PathEscape(avatar.Key), body, sign, true, &stored)
+	return stored, err
+}
+
+// Health checks whether the server and its database are answering. It is not retried, since
+// a health check is supposed to tell what is happening right now; if the server replies 503,
+// both the Health and an *Error are returned.
+func (c *Client) Health(ctx context.Context) (Health, error) {
+	var health Health
+	err := c.do(ctx, http.MethodGet, "/health", nil, nil, false, &health)
+	return health, err
+}
+
+// Stats returns the server's counters.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	err := c.do(ctx, http.MethodGet, "/stats", nil, nil, true, &stats)
+	return stats, err
+}
+
+// Backup downloads a backup of the whole database into w, and returns its size; the server must have
+// an admin token, and this must be it. It is never retried (w may already have part of it), and it is
+// not limited by HTTPClient's timeout, since big databases take a while; use the context instead.
+// The backup is not verified here, but `gosl-basics restore` will do that.
+func (c *Client) Backup(ctx context.Context, adminToken string, w io.Writer) (int64, error) {
+	httpClient := http.Client{}
+	if c.HTTPClient != nil {
+		httpClient = *c.HTTPClient
+	}
+	httpClient.Timeout = 0
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.BaseURL, "/")+apiPrefix+"/admin/backup", nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, err = c.decode(resp, nil)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
+
+// sign adds the admin token and the signature headers, the same way as gosl.Sign() does on the server.
+func (c *Client) sign(req *http.Request, name string, key string) {
+	if c.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	}
+	if c.SigningSecret == "" {
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(c.SigningSecret))
+	mac.Write([]byte(timestamp + "\n" + name + "\n" + key))
+	req.Header.Set("X-Gosl-Timestamp", timestamp)
+	req.Header.Set("X-Gosl-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// do sends a request to the API (retrying if allowed) and decodes the JSON reply into result.
+// The body is kept as bytes, since each attempt needs a fresh reader (and a fresh signature).
+func (c *Client) do(ctx context.Context, method string, path string, body []byte, sign func(*http.Request), retry bool, result any) error {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	endpoint := strings.TrimSuffix(c.BaseURL, "/") + apiPrefix + path
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if sign != nil {
+			sign(req)
+		}
+		resp, err := httpClient.Do(req)
+		var retryAfter time.Duration
+		if err == nil {
+			retryAfter, err = c.decode(resp, result)
+		}
+		if err == nil || !retry || attempt >= c.MaxRetries || !retryable(err) {
+			return err
+		}
+		wait := max(c.backoff(attempt), retryAfter)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// decode reads the reply; errors become *Error (or ErrNotFound), and Retry-After, if any, is returned, too.
+func (c *Client) decode(resp *http.Response, result any) (time.Duration, error) {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if err = json.Unmarshal(data, result); err != nil {
+			return 0, fmt.Errorf("could not decode reply from gosl server: %w", err)
+		}
+		return 0, nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, ErrNotFound
+	}
+	// the health check replies 503 with a Health, which is still worth returning.
+	_ = json.Unmarshal(data, result)
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+		message = apiErr.Error
+	}
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	return retryAfter, &Error{StatusCode: resp.StatusCode, Message: message}
+}
+
+// retryable says whether an error is worth trying again: 429, 5xx, and network errors.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrNotFound) {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) // couldn't connect, connection reset, etc.
+}
+
+// backoff returns how long to wait before retry number attempt+1: exponential, capped, with jitter,
+// so that lots of clients failing at the same time do not all come back at the same time.
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.MinBackoff << attempt
+	if wait <= 0 || (c.MaxBackoff > 0 && wait > c.MaxBackoff) {
+		wait = c.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
@@ -0,0 +1,172 @@
+// Tests the client against the real handler, backed by a real (temporary) store.
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gosl "git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics/client"
+)
+
+const (
+	testSecret = "correct horse battery staple"
+	testName   = "Some Resident"
+	testKey    = "a2e76fcd-9360-4f6d-a924-000000000001"
+)
+
+// newTestServer opens an in-memory store and serves it; wrap, if not nil, goes in
+// front of the real handler (to inject failures).
+func newTestServer(t *testing.T, wrap func(http.Handler) http.Handler) (*httptest.Server, *client.Client) {
+	t.Helper()
+	config := gosl.DefaultConfig()
+	config.Database = "memory"
+	config.BloomCapacity = 1000
+	store, err := gosl.Open(config)
+	if err != nil {
+		t.Fatalf("could not open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	var handler http.Handler = gosl.NewHandler(store, gosl.WithSigningSecret(testSecret))
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c := client.New(server.URL + "/mounted/somewhere") // like under FastCGI.
+	c.SigningSecret = testSecret
+	c.MinBackoff, c.MaxBackoff = time.Millisecond, 10*time.Millisecond
+	return server, c
+}
+
+func TestRegisterAndLookup(t *testing.T) {
+	_, c := newTestServer(t, nil)
+	ctx := context.Background()
+
+	if _, err := c.Name2Key(ctx, testName); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("Name2Key before registering: got %v, want ErrNotFound", err)
+	}
+	stored, err := c.Register(ctx, client.Avatar{Name: testName, Key: testKey, Grid: "Production"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if stored.Name != testName || stored.Key != testKey {
+		t.Errorf("Register returned %+v", stored)
+	}
+	avatar, err := c.Name2Key(ctx, testName)
+	if err != nil || avatar.Key != testKey || avatar.Grid != "Production" {
+		t.Errorf("Name2Key: got %+v, %v", avatar, err)
+	}
+	avatar, err = c.Key2Name(ctx, testKey)
+	if err != nil || avatar.Name != testName {
+		t.Errorf("Key2Name: got %+v, %v", avatar, err)
+	}
+
+	results, err := c.Lookup(ctx, []string{testName, "Nobody Here", testKey})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(results) != 3 || !results[0].Found || results[1].Found || !results[2].Found || results[2].Name != testName {
+		t.Errorf("Lookup: got %+v", results)
+	}
+}
+
+func TestSigning(t *testing.T) {
+	_, c := newTestServer(t, nil)
+	ctx := context.Background()
+	for _, secret := range []string{"", "wrong secret"} {
+		c.SigningSecret = secret
+		_, err := c.Register(ctx, client.Avatar{Name: testName, Key: testKey})
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Register with secret %q: got %v, want 401", secret, err)
+		}
+	}
+	if _, err := c.Name2Key(ctx, testName); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("unsigned registration went through anyway: %v", err)
+	}
+}
+
+func TestHealthAndStats(t *testing.T) {
+	_, c := newTestServer(t, nil)
+	ctx := context.Background()
+
+	health, err := c.Health(ctx)
+	if err != nil || health.Status != "ok" || health.Database != "memory" {
+		t.Errorf("Health: got %+v, %v", health, err)
+	}
+	c.Name2Key(ctx, testName)
+	stats, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.Lookups != 1 || stats.Misses != 1 || stats.Database != "memory" {
+		t.Errorf("Stats: got %+v", stats)
+	}
+}
+
+// failFirst replies with status to the first n requests, then lets them through.
+func failFirst(n int32, status int, attempts *atomic.Int32) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) <= n {
+				http.Error(w, "try again later", status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable} {
+		var attempts atomic.Int32
+		_, c := newTestServer(t, failFirst(2, status, &attempts))
+		if _, err := c.Register(context.Background(), client.Avatar{Name: testName, Key: testKey}); err != nil {
+			t.Errorf("%d: Register failed despite retries: %v", status, err)
+		}
+		if attempts.Load() != 3 {
+			t.Errorf("%d: got %d attempts, want 3", status, attempts.Load())
+		}
+	}
+
+	// no retries for client errors...
+	var attempts atomic.Int32
+	_, c := newTestServer(t, failFirst(5, http.StatusBadRequest, &attempts))
+	if _, err := c.Stats(context.Background()); err == nil || attempts.Load() != 1 {
+		t.Errorf("400: got %v after %d attempts, want an error after 1", err, attempts.Load())
+	}
+
+	// ... and giving up after MaxRetries.
+	attempts.Store(0)
+	_, c = newTestServer(t, failFirst(100, http.StatusInternalServerError, &attempts))
+	var apiErr *client.Error
+	if _, err := c.Stats(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("500: got %v, want *client.Error with 500", err)
+	}
+	if attempts.Load() != int32(c.MaxRetries+1) {
+		t.Errorf("500: got %d attempts, want %d", attempts.Load(), c.MaxRetries+1)
+	}
+}
+
+func TestContextCancelsRetries(t *testing.T) {
+	var attempts atomic.Int32
+	_, c := newTestServer(t, failFirst(100, http.StatusServiceUnavailable, &attempts))
+	c.MaxRetries, c.MinBackoff, c.MaxBackoff = 100, time.Second, time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Stats(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled request took %v", elapsed)
+	}
+}
@@ -0,0 +1,889 @@
+// Subcommands. It used to be the combination of --server, --shell and --import that decided what
+// we were going to do, and if none was given, we'd silently become a FastCGI application and wait
+// forever for a web server to talk to us. Now each mode is its own command, with its own flags and help;
+// the old flags still work (see legacyFlags), but are deprecated.
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics/client"
+	"github.com/google/uuid"
+	flag "github.com/spf13/pflag"
+	"gitlab.com/cznic/readline"
+)
+
+// command is one of the things that gosl-basics can do.
+type command struct {
+	name	string
+	usage	string	// what comes after the command name, e.g. "[flags] <file>".
+	summary	string	// one line, for the list of commands.
+	help	string	// a paragraph, for `gosl-basics help <command>`.
+	chatty	bool	// may print progress to stdout (FastCGI must not, and neither should commands writing data to stdout).
+	flags	func(fs *flag.FlagSet)	// adds the command's own flags, on top of databaseFlags().
+	run		func(ctx context.Context, args []string) error
+}
+
+// exitCode can be returned by a command to exit with a specific code, after it has explained itself.
+type exitCode int
+
+func (code exitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(code))
+}
+
+// commands is filled in init(), since `help` needs to refer to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:		"serve",
+			usage:		"[flags]",
+			summary:	"run as a standalone web server (and, optionally, gRPC)",
+			help:		"Runs the standalone HTTP(S) server, on --port or wherever --listen says, until it gets SIGINT or SIGTERM.",
+			chatty:		true,
+			flags:		serverFlags,
+			run:		runServe,
+		},
+		{
+			name:		"fcgi",
+			usage:		"[flags]",
+			summary:	"run as a FastCGI application, under a web server",
+			help:		"Runs as a FastCGI application. This is meant to be started by your web server (e.g. Apache's mod_fcgid), which talks to it on stdin, unless --listen says otherwise.",
+			flags:		func(fs *flag.FlagSet) { listenFlag(fs) },
+			run:		runFastCGI,
+		},
+		{
+			name:		"shell",
+			usage:		"[flags]",
+			summary:	"interactive shell, to look up, add and delete avatars",
+			help:		"Starts an interactive shell; type `help` there to see what it can do.",
+			chatty:		true,
+			run:		runShellCommand,
+		},
+		{
+			name:		"import",
+			usage:		"[flags] <file>...",
+			summary:	"import CSV files (plain, gzip'ed or bzip2'ed) from W-Hat, or from export",
+			help:		"Imports one or more CSV files with UUID,name[,grid] on each line, which may be gzip'ed or bzip2'ed, like the ones from W-Hat (http://w-hat.com/#name2key). Use - for stdin.",
+			chatty:		true,
+			run:		runImport,
+		},
+		{
+			name:		"export",
+			usage:		"[flags] [file]",
+			summary:	"export the whole database as CSV",
+			help:		"Exports every avatar as a CSV line with UUID, name and grid, to a file (gzip'ed if its name ends in .gz) or to stdout. The result can be imported again.",
+			run:		runExport,
+		},
+		{
+			name:		"backup",
+			usage:		"[flags] [file]",
+			summary:	"back up the whole database, even while the server is running",
+			help:		"Writes a backup of the whole database, which can be restored into any database type, to a file or to stdout. With --url, it is downloaded from a running server (which must have adminToken set in its configuration, and so must we); otherwise, the database is opened directly, which only works if nothing else has it open.",
+			flags:		func(fs *flag.FlagSet) { fs.StringVar(&backupURL, "url", "", "Base URL of a running server, e.g. http://localhost:3000") },
+			run:		runBackup,
+		},
+		{
+			name:		"restore",
+			usage:		"[flags] <file>",
+			summary:	"restore a backup into a new database",
+			help:		"Checks that a backup is complete and not corrupted, and then restores it into the configured database, which must be empty (use --database, --dir and --databaseName to choose it). With --verify, it only checks the backup.",
+			chatty:		true,
+			flags:		func(fs *flag.FlagSet) { fs.BoolVar(&restoreVerifyOnly, "verify", false, "Only check the backup, without restoring it") },
+			run:		runRestore,
+		},
+		{
+			name:		"migrate",
+			usage:		"[flags] --to-database <type>",
+			summary:	"copy everything into another database type (or location)",
+			help:		"Copies every record from the configured database into a new one, e.g. from Badger to LevelDB, without going back to the original W-Hat file (so nothing registered in the meantime gets lost). Writes are batched (--batchblock), and the number of keys on both sides is checked at the end. If it gets interrupted, just run it again, and it will continue where it stopped.",
+			chatty:		true,
+			flags:		migrateFlags,
+			run:		runMigrate,
+		},
+		{
+			name:		"check",
+			usage:		"[flags]",
+			summary:	"check the database for inconsistencies",
+			help:		"Reads the whole database and checks that every record can be read, is stored under both the avatar's name and UUID, and is known to the Bloom filter. Exits with 1 if anything is wrong.",
+			chatty:		true,
+			run:		runCheck,
+		},
+		{
+			name:		"stats",
+			usage:		"[flags]",
+			summary:	"show how many avatars there are, or a running server's counters",
+			help:		"Counts the avatars in the database, or, with --url, shows the counters of a running server (which is the only way to get them while the server has the database open).",
+			chatty:		true,
+			flags:		func(fs *flag.FlagSet) { fs.StringVar(&statsURL, "url", "", "Base URL of a running server, e.g. http://localhost:3000") },
+			run:		runStats,
+		},
+		{
+			name:		"resolve",
+			usage:		"[flags] <file>",
+			summary:	"look up every name or UUID in a file, and write the results as CSV or JSON Lines",
+			help:		"Looks up every name or UUID in a file (one per line, or a column of a CSV file; use - for stdin), and writes the results as CSV or JSON Lines. Exits with 1 if any were not found, and 2 if it could not finish.",
+			flags:		resolveFlags,
+			run:		runResolve,
+		},
+		{
+			name:		"config",
+			usage:		"[flags] [show|check]",
+			summary:	"show the configuration, and where each setting comes from",
+			help:		"Shows the value of every setting (except secrets) and where it comes from: a flag, a GOSL_* environment variable, the configuration file, or the default. With check, it only checks whether the configuration makes sense. Either way, it exits with 1 if it doesn't.",
+			flags:		serverFlags,
+			run:		runConfig,
+		},
+		{
+			name:		"help",
+			usage:		"[command]",
+			summary:	"show this list, or the help for a command",
+			help:		"Lists all commands or, with the name of a command, shows what it does and its flags.",
+			run:		runHelp,
+		},
+	}
+}
+
+// findCommand returns the command with this name, or nil.
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// selectCommand figures out which command to run, and parses its flags.
+// It also returns the command's arguments, since, for the deprecated flags, these come from the flags.
+func selectCommand(args []string) (*command, *flag.FlagSet, []string) {
+	args = commandFirst(args)
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd := findCommand(args[0])
+		if cmd == nil {
+			unknownCommand(args[0])
+		}
+		fs := cmd.flagSet()
+		parseFlags(fs, args[1:])
+		return cmd, fs, fs.Args()
+	}
+
+	// No command, so this is the old way of doing things.
+	fs := legacyFlags()
+	parseFlags(fs, args)
+	if fs.NArg() > 0 {
+		// That was never allowed; it's probably a typo in the name of a command, after some flags.
+		unknownCommand(fs.Arg(0))
+	}
+	switch {
+	case goslConfig.resolveFilename != "":
+		return findCommand("resolve"), fs, []string{goslConfig.resolveFilename}
+	case goslConfig.isServer:
+		return findCommand("serve"), fs, fs.Args()
+	case goslConfig.isShell:
+		return findCommand("shell"), fs, fs.Args()
+	case goslConfig.importFilename != "" && isTerminal(os.Stdin):
+		// This used to import and then wait for FastCGI, which nobody running it in a terminal wants.
+		filename := goslConfig.importFilename
+		goslConfig.importFilename = ""
+		return findCommand("import"), fs, []string{filename}
+	}
+	return findCommand("fcgi"), fs, fs.Args()
+}
+
+// commandFirst moves the command name to the front, if there are flags before it, as in
+// `gosl-basics --config c.ini config check`; the command's flag set knows all of them anyway.
+// Without a command name, args are returned as they are: that's the legacy way (see legacyFlags).
+func commandFirst(args []string) []string {
+	// The flags are just looked at, to know which ones take a value; they are parsed for real afterwards.
+	saved := goslConfig
+	defer func() { goslConfig = saved }()
+	fs := legacyFlags()
+	fs.SetInterspersed(false)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 || findCommand(fs.Arg(0)) == nil {
+		return args
+	}
+	i := len(args) - fs.NArg()
+	if i == 0 {
+		return args
+	}
+	return slices.Concat(args[i:i+1], args[:i], args[i+1:])
+}
+
+// unknownCommand explains what went wrong, and exits.
+func unknownCommand(name string) {
+	fmt.Fprintf(os.Stderr, "%s: unknown command %q\n\n", programName, name)
+	printCommands(os.Stderr)
+	os.Exit(2)
+}
+
+// flagSet returns the flags for this command, with the usage message for --help.
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(programName+" "+cmd.name, flag.ContinueOnError)
+	if cmd.name != "help" {
+		databaseFlags(fs)
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n\n%s\n", programName, cmd.name, cmd.usage, cmd.help)
+		if fs.HasFlags() {
+			fmt.Fprintf(os.Stderr, "\nFlags:\n%s", fs.FlagUsages())
+		}
+	}
+	return fs
+}
+
+// parseFlags parses the command line, exiting for --help and for mistakes, like the standard flag package does.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\nRun `%s help` for usage.\n", programName, err, programName)
+		os.Exit(2)
+	}
+}
+
+// databaseFlags are understood by all commands (except help). Defaults come from the configuration file.
+func databaseFlags(fs *flag.FlagSet) {
+	fs.StringVar( &goslConfig.configFilename,	"config", goslConfig.configFilename, "Configuration filename, instead of looking for config.ini [extension defines type, INI by default]")
+	fs.StringVar( &goslConfig.myDir,			"dir", goslConfig.myDir, "Directory where database files are stored")
+	fs.StringVar( &goslConfig.database,		"database", goslConfig.database, "Database type " + fmt.Sprint(gosl.Backends()))
+	fs.StringVarP(&goslConfig.databaseName,	"databaseName", "n", goslConfig.databaseName, "Database file name")
+	fs.BoolVar(   &goslConfig.noMemory,		"nomemory", goslConfig.noMemory, "Attempt to use only disk to save memory on Badger (important for shared webservers)")
+	fs.BoolVar(   &goslConfig.memorySnapshot,	"snapshot", goslConfig.memorySnapshot, "With --database memory, load the database from its file when starting, and save it there when stopping")
+	fs.BoolVar(   &goslConfig.bloomFilter,	"bloom", goslConfig.bloomFilter, "Keep a Bloom filter of all names and UUIDs, to answer definite misses without touching the database")
+	fs.StringVarP(&goslConfig.logLevel,		"debug", "d", goslConfig.logLevel, "Logging level, e.g. one of [DEBUG | ERROR | NOTICE | INFO]")
+	fs.IntVarP(   &goslConfig.loopBatch,		"loopbatch", "l", goslConfig.loopBatch, "How many entries to skip when emitting debug messages in a tight loop. Only useful when importing huge databases with high logging levels. Set to 1 if you wish to see logs for all entries.")
+	fs.IntVarP(   &goslConfig.BATCH_BLOCK,	"batchblock", "b", goslConfig.BATCH_BLOCK, "How many entries to write to the database as a block; the bigger, the faster, but the more memory it consumes.")
+}
+
+// listenFlag is shared by serve and fcgi, and so is the base path, which goes with it.
+func listenFlag(fs *flag.FlagSet) {
+	fs.StringVar( &goslConfig.listen,			"listen", goslConfig.listen, "Listen on \"unix:/path/to/socket\", on sockets passed by \"systemd\", or on a TCP address (default: port for serve, stdin for fcgi)")
+	fs.StringVar( &goslConfig.basePath,		"basepath", goslConfig.basePath, "Where the web server mounts us, e.g. \"/examples/gosl-basics\"; routes must then come right after it (default: the root for serve, the end of the path for fcgi)")
+}
+
+func serverFlags(fs *flag.FlagSet) {
+	fs.StringVarP(&goslConfig.myPort,			"port", "p", goslConfig.myPort, "Server port")
+	listenFlag(fs)
+	fs.StringVar( &goslConfig.grpcListen,		"grpc", goslConfig.grpcListen, "Also serve gRPC on this TCP address or \"unix:/path/to/socket\"")
+	fs.StringVar( &goslConfig.respListen,		"resp", goslConfig.respListen, "Also serve the Redis protocol (RESP) on this TCP address or \"unix:/path/to/socket\"")
+	fs.StringVar( &goslConfig.tlsCertFile,	"tlscert", goslConfig.tlsCertFile, "TLS certificate file (reloaded automatically when it changes)")
+	fs.StringVar( &goslConfig.tlsKeyFile,		"tlskey", goslConfig.tlsKeyFile, "TLS key file")
+}
+
+func resolveFlags(fs *flag.FlagSet) {
+	fs.IntVar(    &goslConfig.resolveColumn,	"column", 0, "Read this column of a CSV file (1 is the first), instead of whole lines")
+	fs.BoolVar(   &goslConfig.resolveHeader,	"header", false, "Skip the first line (e.g. column titles)")
+	fs.StringVar( &goslConfig.resolveFormat,	"format", "csv", "Write results as \"csv\" or \"jsonl\"")
+	fs.StringVarP(&goslConfig.resolveOutput,	"output", "o", "", "Write results to this file instead of stdout")
+}
+
+// Where to migrate to; the defaults are the same as the source.
+var migrateTo struct {
+	database, dir, databaseName	string
+}
+
+func migrateFlags(fs *flag.FlagSet) {
+	fs.StringVar( &migrateTo.database,		"to-database", "", "Database type to migrate to " + fmt.Sprint(gosl.Backends()))
+	fs.StringVar( &migrateTo.dir,			"to-dir", "", "Directory for the new database (default: same as --dir)")
+	fs.StringVar( &migrateTo.databaseName,	"to-databaseName", "", "File name for the new database (default: same as --databaseName)")
+}
+
+// statsURL is where `stats --url` gets the counters from.
+var statsURL string
+
+// backupURL is where `backup --url` downloads the backup from.
+var backupURL string
+
+// restoreVerifyOnly is `restore --verify`.
+var restoreVerifyOnly bool
+
+// legacyFlags are the flags from before there were commands; the ones which chose the mode are deprecated.
+func legacyFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet(programName, flag.ContinueOnError)
+	databaseFlags(fs)
+	serverFlags(fs)
+	resolveFlags(fs)
+	fs.BoolVar(   &goslConfig.isServer,		"server", goslConfig.isServer, "Run as server on port " + goslConfig.myPort)
+	fs.BoolVar(   &goslConfig.isShell,		"shell", goslConfig.isShell, "Run as an interactive shell")
+	fs.StringVarP(&goslConfig.importFilename,	"import", "i", goslConfig.importFilename, "Import database from W-Hat (use the csv.bz2 versions)")
+	fs.StringVar( &goslConfig.resolveFilename,	"resolve", "", "Resolve the names and/or UUIDs in this file (\"-\" for stdin), and exit")
+	fs.MarkDeprecated("server", "use `" + programName + " serve` instead")
+	fs.MarkDeprecated("shell", "use `" + programName + " shell` instead")
+	fs.MarkDeprecated("import", "use `" + programName + " import <file>` instead (or importFilename in the configuration, to import before serving)")
+	fs.MarkDeprecated("resolve", "use `" + programName + " resolve <file>` instead")
+	fs.Usage = func() {
+		printCommands(os.Stderr)
+	}
+	return fs
+}
+
+// printCommands is the overall help.
+func printCommands(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags] [arguments]\n\nCommands:\n", programName)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun `%s help <command>` (or `%s <command> --help`) for its flags.\n", programName, programName)
+	fmt.Fprintln(w, "Without a command, it runs as FastCGI, unless the (deprecated) --server, --shell, --import or --resolve flags say otherwise.")
+}
+
+func runHelp(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		printCommands(os.Stdout)
+		return nil
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		printCommands(os.Stderr)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	cmd.flagSet().Usage()
+	return nil
+}
+
+// isTerminal is true if the file is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	return readline.IsTerminal(int(f.Fd()))
+}
+
+// noArguments complains about leftover arguments, which are usually a mistake (e.g. a missing --).
+func noArguments(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %q", args)
+	}
+	return nil
+}
+
+// openStore opens the database. It used to be opened on each request; now it stays open until the command finishes.
+func openStore() (*gosl.Store, error) {
+	return gosl.Open(storeConfig())
+}
+
+// openStoreAndImport is openStore and, if the configuration says so, imports into it before anything else,
+// which happens after the Bloom filter is loaded (or rebuilt), so that the import just adds to it.
+// Only the commands which serve or change the database (serve, fcgi, shell and import) do this;
+// nobody wants `stats` to spend minutes importing W-Hat's file first, nor `export` to write to the database.
+func openStoreAndImport(ctx context.Context) (*gosl.Store, error) {
+	store, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	// if importFilename isn't empty, this means we potentially have something to import.
+	if goslConfig.importFilename != "" {
+		log.Info("attempting to import", goslConfig.importFilename, "...")
+		if _, err := store.Import(ctx, goslConfig.importFilename); err != nil && ctx.Err() == nil {
+			log.Error("import failed:", err)
+		}
+		log.Info("database finished import.")
+		if ctx.Err() != nil {
+			log.Notice("shutdown requested during import, exiting")
+			checkErr(store.Close())
+			return nil, ctx.Err()
+		}
+	} else {
+		// it's not an error if there is no name2key database available for import (gwyneth 20211027)
+		log.Debug("no database configured for import — 🆗")
+	}
+	return store, nil
+}
+
+// handlerOptions configures the HTTP handler (and the gRPC service) from the configuration.
+func handlerOptions() []gosl.HandlerOption {
+	return []gosl.HandlerOption{
+		gosl.WithSigningSecret(goslConfig.signingSecret),
+		gosl.WithAdminToken(goslConfig.adminToken),
+		gosl.WithAccessLog(accessLog()),
+		gosl.WithRedactedNames(goslConfig.redactNames),
+	}
+}
+
+// testDatabase writes and reads some testing data. (common to all database types)
+// Note: this only works for shell/server; for FastCGI it's definitely overkill (gwyneth 20211106),
+// so we do it only for server/shell mode.
+func testDatabase(store *gosl.Store) error {
+	const testAvatarName = "Nobody Here"
+
+	log.Infof("%s started and logging is set up. Proceeding to test database (%s) at %q\n", programName, goslConfig.database, goslConfig.myDir)
+	// Read-only databases (e.g. mmap mirrors) can only be tested by reading from them.
+	if store.ReadOnly() {
+		if _, err := store.Lookup(testAvatarName); err != nil && !errors.Is(err, gosl.ErrNotFound) {
+			return err
+		}
+		log.Info("KV database seems fine (and read-only, so only lookups will work).")
+		return nil
+	}
+	// generate a random UUID (gwyneth2021103) (gwyneth 20211031)
+	testValue := gosl.AvatarUUID{AvatarName: testAvatarName, UUID: uuid.New().String(), Grid: "all grids"}
+	// The name gets overwritten, but the old UUID would be left behind, pointing at a name which is no longer its own.
+	if old, err := store.Lookup(testAvatarName); err == nil {
+		if err := store.Delete(gosl.AvatarUUID{UUID: old.UUID}); err != nil {
+			return err
+		}
+	}
+	if err := store.Insert(testValue); err != nil {
+		return err // something went VERY wrong
+	}
+	log.Debugf("%s SET %+v\n", goslConfig.database, testValue)
+	key, grid := store.Name2Key(testAvatarName)
+	log.Debugf("GET %q returned %q [grid %q]\n", testAvatarName, key, grid)
+	log.Info("KV database seems fine.")
+	return nil
+}
+
+func runServe(ctx context.Context, args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	store, err := openStoreAndImport(ctx)
+	if err != nil {
+		return err // we cannot proceed without a database.
+	}
+	defer func() {
+		checkErr(store.Close())
+	}()
+	if err := testDatabase(store); err != nil {
+		return err
+	}
+	// set up routing.
+	// NOTE(gwyneth): one function only because FastCGI seems to have problems with multiple handlers.
+	// This is now dealt with by our own router, which works the same way under both.
+	// Here, we are the web server, and get every request there is, so routes start at the root unless told otherwise.
+	handler := gosl.NewHandler(store, append(handlerOptions(), gosl.WithBasePath(cmp.Or(goslConfig.basePath, "/")))...)
+	http.Handle("/", handler)
+	log.Debug("directory for database:", goslConfig.myDir)
+	// Everything which needs to know when the signing secret or the admin token change.
+	targets := []gosl.Reconfigurable{handler.(gosl.Reconfigurable)}
+
+	tlsConfig, err := setupTLS(ctx)
+	if err != nil {
+		return err // if TLS was configured, we should not silently fall back to plain HTTP.
+	}
+	listeners, err := openListeners(false)
+	if err != nil {
+		return err // if it can't listen to all the above, then it has to abort anyway
+	}
+	if goslConfig.grpcListen != "" {
+		service, err := serveGRPC(ctx, store, tlsConfig)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, service)
+	}
+	if goslConfig.respListen != "" {
+		respServer, err := serveRESP(ctx, store, tlsConfig)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, respServer)
+	}
+	watchConfiguration(ctx, targets...)
+	if tlsConfig != nil {
+		log.Info("starting to run as HTTPS web server on", listenerNames(listeners))
+		if goslConfig.tlsRedirect != "" {
+			_, httpsPort, _ := net.SplitHostPort(listeners[0].Addr().String())
+			go serveRedirect(ctx, goslConfig.tlsRedirect, httpsPort)
+		}
+	} else {
+		log.Info("starting to run as web server on", listenerNames(listeners))
+	}
+	if err := serveHTTP(ctx, &http.Server{TLSConfig: tlsConfig}, listeners); err != nil {
+		return err
+	}
+	log.Info(programName, " shut down cleanly.")
+	return nil
+}
+
+// runFastCGI works like a charm thanks to http://www.dav-muz.net/blog/2013/09/how-to-use-go-and-fastcgi/
+func runFastCGI(ctx context.Context, args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	// Under a web server, stdin is a socket; if it's a terminal, someone just ran us by hand,
+	// and would otherwise be staring at a program which does nothing at all.
+	if goslConfig.listen == "" && isTerminal(os.Stdin) {
+		fmt.Fprintf(os.Stderr, "%s runs as a FastCGI application by default, which means that it is meant to be started by a web server.\n", programName)
+		fmt.Fprintf(os.Stderr, "You probably want `%s serve` (a standalone web server) or `%s shell` instead; `%s help` lists everything it can do.\n", programName, programName, programName)
+		return exitCode(2)
+	}
+	store, err := openStoreAndImport(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		checkErr(store.Close())
+	}()
+	listeners, err := openListeners(true)
+	if err != nil {
+		return err
+	}
+	log.Info("Starting to run as FastCGI on", listenerNames(listeners))
+	// The base path cannot be changed while running, so it's not among handlerOptions(), which reloading applies again.
+	handler := gosl.NewHandler(store, append(handlerOptions(), gosl.WithBasePath(goslConfig.basePath))...)
+	watchConfiguration(ctx, handler.(gosl.Reconfigurable))
+	if err := serveFastCGI(ctx, handler, listeners); err != nil {
+		log.Errorf("seems that we got an error from FCGI: %q\n", err)
+		return err
+	}
+	log.Info(programName, " shut down cleanly.")
+	return nil
+}
+
+func runShellCommand(ctx context.Context, args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	store, err := openStoreAndImport(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		checkErr(store.Close())
+	}()
+	if err := testDatabase(store); err != nil {
+		return err
+	}
+	log.Info("starting to run as interactive shell")
+	// never leaves until Ctrl-C or by typing `quit`. (gwyneth 20211106)
+	err = runShell(ctx, store)
+	log.Debug("interactive session finished.")
+	return err
+}
+
+func runImport(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("nothing to import; usage: import <file>...")
+	}
+	store, err := openStoreAndImport(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		checkErr(store.Close())
+	}()
+	for _, filename := range args {
+		start := time.Now()
+		var count int
+		if filename == "-" {
+			count, err = store.ImportReader(ctx, os.Stdin)
+		} else {
+			count, err = store.Import(ctx, filename)
+		}
+		fmt.Printf("imported %d records from %s in %v\n", count, filename, time.Since(start).Round(time.Millisecond))
+		if err != nil {
+			return fmt.Errorf("importing %s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("only one file, please; usage: export [file]")
+	}
+	filename := "-"
+	if len(args) == 1 {
+		filename = args[0]
+	}
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		checkErr(store.Close())
+	}()
+	count, err := exportTo(ctx, store, filename)
+	log.Infof("exported %d records to %s\n", count, filename)
+	return err
+}
+
+// exportTo exports the whole store to a file ("-" is stdout), gzip'ing it if the name ends in .gz.
+func exportTo(ctx context.Context, store *gosl.Store, filename string) (count int, err error) {
+	var w io.Writer = os.Stdout
+	if filename != "-" {
+		f, err := os.Create(filename)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		w = f
+		if strings.HasSuffix(filename, ".gz") {
+			zw := gzip.NewWriter(f)
+			defer func() {
+				if closeErr := zw.Close(); err == nil {
+					err = closeErr
+				}
+			}()
+			w = zw
+		}
+	}
+	return store.Export(ctx, w)
+}
+
+// runBackup writes a backup to a file or stdout. A file is written under a temporary name first,
+// and verified, so that whatever has the final name is always a complete backup.
+func runBackup(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("only one file, please; usage: backup [file]")
+	}
+	filename := "-"
+	if len(args) == 1 {
+		filename = args[0]
+	}
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if filename != "-" {
+		var err error
+		if f, err = os.Create(filename + ".tmp"); err != nil {
+			return err
+		}
+		defer os.Remove(f.Name()) // after the rename, this fails, which is fine.
+		defer f.Close()
+		w = f
+	}
+	start := time.Now()
+	if backupURL != "" {
+		if goslConfig.adminToken == "" {
+			return errors.New("--url needs adminToken in the [options] section of the configuration, the same as the server's")
+		}
+		size, err := client.New(backupURL).Backup(ctx, goslConfig.adminToken, w)
+		if errors.Is(err, client.ErrNotFound) {
+			return errors.New("the server does not have an admin token set, so it does not do backups")
+		} else if err != nil {
+			return err
+		}
+		log.Infof("downloaded %d bytes from %s in %v\n", size, backupURL, time.Since(start).Round(time.Millisecond))
+	} else {
+		store, err := gosl.Open(storeConfig())
+		if err != nil {
+			return err
+		}
+		info, err := store.Backup(ctx, w)
+		checkErr(store.Close())
+		if err != nil {
+			return err
+		}
+		log.Infof("backed up %d keys in %v\n", info.Keys, time.Since(start).Round(time.Millisecond))
+	}
+	if f == nil {
+		return nil
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	info, err := gosl.VerifyBackup(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("the backup just written does not verify: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), filename); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "backup of %d keys from %s, taken %v, written to %s\n", info.Keys, info.Database, info.Created.Local().Format(time.DateTime), filename)
+	return nil
+}
+
+// runRestore restores a backup into the configured database, after verifying it.
+func runRestore(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: restore <file>")
+	}
+	if restoreVerifyOnly {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := gosl.VerifyBackup(bufio.NewReader(f))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s is fine: %d keys from %s, taken %v\n", args[0], info.Keys, info.Database, info.Created.Local().Format(time.DateTime))
+		return nil
+	}
+	store, err := gosl.Open(storeConfig())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		checkErr(store.Close())
+	}()
+	start := time.Now()
+	info, err := store.Restore(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %d keys from a %s backup taken %v into %s (%s) in %v\n", info.Keys, info.Database,
+		info.Created.Local().Format(time.DateTime), storeConfig().Path(), goslConfig.database, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// runMigrate copies everything into a new database; if it gets interrupted, running it again resumes it.
+func runMigrate(ctx context.Context, args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	target := storeConfig()
+	if migrateTo.database == "" {
+		return errors.New("missing --to-database")
+	}
+	target.Database = migrateTo.database
+	if migrateTo.dir != "" {
+		target.Dir = migrateTo.dir
+	}
+	if migrateTo.databaseName != "" {
+		target.DatabaseName = migrateTo.databaseName
+	}
+	// Migrating into memory only makes sense if the result ends up somewhere.
+	if target.Database == "memory" {
+		target.MemorySnapshot = true
+	}
+	if filepath.Clean(target.Path()) == filepath.Clean(storeConfig().Path()) {
+		return fmt.Errorf("cannot migrate %s into itself; use --to-dir or --to-databaseName", target.Path())
+	}
+	source, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		checkErr(source.Close())
+	}()
+	destination, err := gosl.Open(target)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		checkErr(destination.Close())
+	}()
+
+	start := time.Now()
+	result, err := source.MigrateTo(ctx, destination)
+	if result.Skipped > 0 {
+		fmt.Printf("resumed an interrupted migration; %d keys had already been copied\n", result.Skipped)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Printf("migration interrupted after copying %d keys; run the same command again to resume it\n", result.Copied)
+		}
+		return err
+	}
+	fmt.Printf("migrated %d keys from %s (%s) to %s (%s) in %v; both have %d keys\n", result.Copied,
+		storeConfig().Path(), goslConfig.database, target.Path(), target.Database, time.Since(start).Round(time.Millisecond), result.DestinationKeys)
+	return nil
+}
+
+func runCheck(ctx context.Context, args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		checkErr(store.Close())
+	}()
+	report, err := store.Check(ctx)
+	if err != nil {
+		return err
+	}
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+	if len(report.Problems) < report.ProblemCount {
+		fmt.Printf("... and %d more.\n", report.ProblemCount - len(report.Problems))
+	}
+	fmt.Printf("%d keys: %d avatars stored under their UUID, %d under their name; %d problems found.\n",
+		report.Keys, report.Avatars, report.Names, report.ProblemCount)
+	if !report.OK() {
+		return exitCode(1)
+	}
+	return nil
+}
+
+func runStats(ctx context.Context, args []string) error {
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	if statsURL != "" {
+		stats, err := client.New(statsURL).Stats(ctx)
+		if err != nil {
+			return err
+		}
+		printStats(gosl.Stats(stats))
+		return nil
+	}
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		checkErr(store.Close())
+	}()
+	var avatars, names int
+	err = store.Scan("", func(key string, record gosl.AvatarUUID) bool {
+		if key == record.UUID {
+			avatars++
+		} else {
+			names++
+		}
+		return ctx.Err() == nil
+	})
+	if err != nil {
+		return err
+	}
+	var size int64
+	filepath.WalkDir(storeConfig().Path(), func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	fmt.Printf("database:       %s at %s (%.1f MB on disk)\n", goslConfig.database, storeConfig().Path(), float64(size)/(1<<20))
+	fmt.Printf("avatars:        %d\n", avatars)
+	fmt.Printf("names:          %d (more than avatars means that some changed names)\n", names)
+	return nil
+}
+
+// printStats prints a store's counters, for `stats --url` and for the shell.
+func printStats(stats gosl.Stats) {
+	fmt.Printf("database:       %s (up for %v)\n", stats.Database, stats.Uptime.Round(time.Second))
+	fmt.Printf("lookups:        %d (%d hits, %d misses, of which %d answered by the Bloom filter)\n",
+		stats.Lookups, stats.Hits, stats.Misses, stats.BloomRejected)
+	fmt.Printf("coalesced:      %d\n", stats.Coalesced)
+	fmt.Printf("errors:         %d\n", stats.Errors)
+	fmt.Printf("inserts:        %d\n", stats.Inserts)
+	fmt.Printf("deletes:        %d\n", stats.Deletes)
+	fmt.Printf("imported:       %d\n", stats.Imported)
+}
@@ -0,0 +1,105 @@
+// Checks how the command line picks a command: the new way, flags before the command name, and the old flags;
+// and which commands import importFilename before doing anything else.
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelectCommand(t *testing.T) {
+	defaults := goslConfig
+	for _, test := range []struct {
+		args    []string
+		command string
+		rest    []string
+		check   func() bool
+	}{
+		{[]string{"config", "check", "--config", "c.ini"}, "config", []string{"check"}, func() bool { return goslConfig.configFilename == "c.ini" }},
+		{[]string{"--config", "c.ini", "config", "check"}, "config", []string{"check"}, func() bool { return goslConfig.configFilename == "c.ini" }},
+		{[]string{"-d", "DEBUG", "--database", "memory", "serve", "--port", "3333"}, "serve", []string{}, func() bool {
+			return goslConfig.logLevel == "DEBUG" && goslConfig.database == "memory" && goslConfig.myPort == "3333"
+		}},
+		{[]string{"--port", "3333", "serve"}, "serve", []string{}, func() bool { return goslConfig.myPort == "3333" }},
+		{[]string{"--dir", "/tmp", "resolve", "names.txt"}, "resolve", []string{"names.txt"}, func() bool { return goslConfig.myDir == "/tmp" }},
+		// The deprecated flags.
+		{[]string{"--server", "--port", "3333"}, "serve", []string{}, func() bool { return goslConfig.myPort == "3333" }},
+		{[]string{"--shell"}, "shell", []string{}, nil},
+		{[]string{"--resolve", "names.txt"}, "resolve", []string{"names.txt"}, nil},
+		{[]string{"--database", "memory"}, "fcgi", []string{}, func() bool { return goslConfig.database == "memory" }},
+		{[]string{}, "fcgi", []string{}, nil},
+	} {
+		goslConfig = defaults
+		cmd, _, rest := selectCommand(test.args)
+		if cmd == nil || cmd.name != test.command || !slices.Equal(rest, test.rest) {
+			t.Errorf("selectCommand(%q) = %v, %q; want %s, %q", test.args, cmd, rest, test.command, test.rest)
+		} else if test.check != nil && !test.check() {
+			t.Errorf("selectCommand(%q) did not set the flags: %+v", test.args, goslConfig)
+		}
+	}
+	goslConfig = defaults
+}
+
+func TestCommandFirst(t *testing.T) {
+	for _, test := range []struct {
+		args, want []string
+	}{
+		{[]string{"serve", "--port", "3333"}, []string{"serve", "--port", "3333"}},
+		{[]string{"--config", "c.ini", "config", "check"}, []string{"config", "--config", "c.ini", "check"}},
+		{[]string{"-n", "serve", "stats"}, []string{"stats", "-n", "serve"}}, // "serve" is the database name here.
+		{[]string{"--server", "--port", "3333"}, []string{"--server", "--port", "3333"}},
+		{[]string{"--config", "c.ini", "nonsense"}, []string{"--config", "c.ini", "nonsense"}},
+		{[]string{"--no-such-flag", "serve"}, []string{"--no-such-flag", "serve"}},
+	} {
+		if got := commandFirst(test.args); !slices.Equal(got, test.want) {
+			t.Errorf("commandFirst(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestImportFilenameIsOptIn(t *testing.T) {
+	defaults := goslConfig
+	defer func() { goslConfig = defaults }()
+	dir := t.TempDir()
+	goslConfig = goslConfigOptions{}
+	if _, err := readConfiguration(configFile(t, ""), &goslConfig); err != nil {
+		t.Fatal(err)
+	}
+	goslConfig.database, goslConfig.myDir, goslConfig.bloomCapacity = "buntdb", dir, 1000
+	goslConfig.importFilename = filepath.Join(dir, "configured.csv")
+	extra := filepath.Join(dir, "extra.csv")
+	for filename, contents := range map[string]string{
+		goslConfig.importFilename:	"a2e76fcd-9360-4f6d-a924-000000000001,Resident One\n",
+		extra:						"a2e76fcd-9360-4f6d-a924-000000000002,Resident Two\n",
+	} {
+		if err := os.WriteFile(filename, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exported := func() string {
+		t.Helper()
+		filename := filepath.Join(dir, "export.csv")
+		if err := runExport(context.Background(), []string{filename}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if data := exported(); strings.Contains(data, "Resident") {
+		t.Errorf("export imported %s first:\n%s", goslConfig.importFilename, data)
+	}
+	if err := runImport(context.Background(), []string{extra}); err != nil {
+		t.Fatal(err)
+	}
+	if data := exported(); !strings.Contains(data, "Resident One") || !strings.Contains(data, "Resident Two") {
+		t.Errorf("import did not import both the configured file and its own:\n%s", data)
+	}
+}
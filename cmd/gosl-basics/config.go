@@ -0,0 +1,325 @@
+// Where each setting comes from, and whether it makes any sense. In order of precedence: flags on
+// the command line, GOSL_* environment variables (the section and the key, in upper case, joined by
+// underscores, e.g. GOSL_CONFIG_MYDIR or GOSL_OPTIONS_ADMINTOKEN), the configuration file, and the defaults.
+// viper is happy to turn "abc" into a port number of zero, or to ignore a misspelt [section], so we check
+// everything ourselves, and refuse to start if anything is wrong, instead of quietly running with the defaults.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+	"github.com/op/go-logging"
+	"github.com/spf13/cast"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// envPrefix starts the names of all environment variables which override the configuration file.
+const envPrefix = "GOSL"
+
+// settingFlags are the flags which override each setting.
+var settingFlags = map[string]string{
+	"config.BATCH_BLOCK":		"batchblock",
+	"config.loopBatch":			"loopbatch",
+	"config.myPort":			"port",
+	"config.myDir":				"dir",
+	"config.isServer":			"server",
+	"config.isShell":			"shell",
+	"config.database":			"database",
+	"config.databaseName":		"databaseName",
+	"config.listen":			"listen",
+	"config.basePath":			"basepath",
+	"config.grpcListen":		"grpc",
+	"config.respListen":		"resp",
+	"options.importFilename":	"import",
+	"options.noMemory":			"nomemory",
+	"options.memorySnapshot":	"snapshot",
+	"options.bloomFilter":		"bloom",
+	"tls.certFile":				"tlscert",
+	"tls.keyFile":				"tlskey",
+	"log.logLevel":				"debug",
+}
+
+// secretSettings are never shown, nor logged.
+var secretSettings = map[string]bool{
+	"options.signingSecret":	true,
+	"options.adminToken":		true,
+}
+
+// obsoleteSettings were in config.ini.sample at some point, but never did anything; they are still accepted.
+var obsoleteSettings = []string{
+	"BuntDB.dbNamePath",
+}
+
+// configSetting is one setting, as it was read by readConfiguration.
+type configSetting struct {
+	key		string
+	value	any
+}
+
+// loadedSettings are the settings read when starting, in order, for `config show`.
+var loadedSettings []configSetting
+
+// loadError is whatever was wrong with the configuration file or the environment when starting.
+var loadError error
+
+// configReader gets typed settings out of viper, remembering which ones it got, and what was wrong with them.
+type configReader struct {
+	v			*viper.Viper
+	settings	[]configSetting
+	errs		[]error
+}
+
+// newConfigReader also sets up v to look at the environment.
+func newConfigReader(v *viper.Viper) *configReader {
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	return &configReader{v: v}
+}
+
+// getSetting sets the default for key, and converts its value; if it can't, the error is remembered, and the default is used.
+// It's not a method because methods cannot have type parameters.
+func getSetting[T any](r *configReader, key string, defaultValue T, convert func(any) (T, error)) T {
+	r.v.SetDefault(key, defaultValue)
+	value, err := convert(r.v.Get(key))
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("%s (from %s): %w", key, settingSource(r.v, key), err))
+		value = defaultValue
+	}
+	r.settings = append(r.settings, configSetting{key, value})
+	return value
+}
+
+func (r *configReader) String(key string, defaultValue string) string {
+	return getSetting(r, key, defaultValue, cast.ToStringE)
+}
+
+func (r *configReader) Int(key string, defaultValue int) int {
+	return getSetting(r, key, defaultValue, cast.ToIntE)
+}
+
+func (r *configReader) Uint(key string, defaultValue uint) uint {
+	return getSetting(r, key, defaultValue, cast.ToUintE)
+}
+
+func (r *configReader) Float64(key string, defaultValue float64) float64 {
+	return getSetting(r, key, defaultValue, cast.ToFloat64E)
+}
+
+func (r *configReader) Bool(key string, defaultValue bool) bool {
+	return getSetting(r, key, defaultValue, cast.ToBoolE)
+}
+
+func (r *configReader) Duration(key string, defaultValue time.Duration) time.Duration {
+	return getSetting(r, key, defaultValue, cast.ToDurationE)
+}
+
+// Err complains about everything that could not be converted, and about settings in the file which
+// were never read, which are usually typos (viper does not care about upper and lower case, but we do not read [option]).
+func (r *configReader) Err() error {
+	known := make(map[string]bool)
+	for _, key := range obsoleteSettings {
+		known[strings.ToLower(key)] = true
+	}
+	for _, setting := range r.settings {
+		known[strings.ToLower(setting.key)] = true
+	}
+	errs := r.errs
+	keys := r.v.AllKeys()
+	slices.Sort(keys)
+	for _, key := range keys {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("%s (from %s): unknown setting", key, settingSource(r.v, key)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// envName is the environment variable for a setting, e.g. GOSL_CONFIG_MYDIR for config.myDir.
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// changedFlag is the flag which was given on the command line for this setting, or nil.
+func changedFlag(key string) *flag.Flag {
+	name, ok := settingFlags[key]
+	if !ok || commandLine == nil {
+		return nil
+	}
+	if f := commandLine.Lookup(name); f != nil && f.Changed {
+		return f
+	}
+	return nil
+}
+
+// settingSource says where v got the value of a setting from; flags are not v's business, see changedFlag.
+func settingSource(v *viper.Viper, key string) string {
+	if value, ok := os.LookupEnv(envName(key)); ok && value != "" { // viper ignores empty variables.
+		return "environment " + envName(key)
+	}
+	if v.InConfig(key) {
+		return filepath.Base(v.ConfigFileUsed())
+	}
+	return "default"
+}
+
+// configFileFrom finds --config on the command line, which we need before parsing it, since the
+// configuration file gives the defaults for all the other flags.
+func configFileFrom(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if filename, ok := strings.CutPrefix(arg, "--config="); ok {
+			return filename
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// configType is the type of a configuration file, from its extension; without one, it's INI.
+// A dot at the start of the name (e.g. `.goslrc`) or at its very end is not an extension.
+func configType(filename string) string {
+	if ext := filepath.Ext(strings.TrimLeft(filepath.Base(filename), ".")); len(ext) > 1 {
+		return strings.ToLower(ext[1:])
+	}
+	return "ini"
+}
+
+// validateConfiguration checks everything that has to make sense before starting, and returns all the problems at once.
+func validateConfiguration(config *goslConfigOptions) error {
+	var errs []error
+	invalid := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	if !slices.Contains(gosl.Backends(), config.database) {
+		invalid("config.database", "unknown database %q, must be one of %v", config.database, gosl.Backends())
+	}
+	if config.databaseName == "" {
+		invalid("config.databaseName", "cannot be empty")
+	}
+	if port, err := strconv.Atoi(config.myPort); err != nil || port < 1 || port > 65535 {
+		invalid("config.myPort", "invalid port %q, must be a number between 1 and 65535", config.myPort)
+	}
+	if config.basePath != "" && !strings.HasPrefix(config.basePath, "/") {
+		invalid("config.basePath", "must start with a slash, e.g. \"/examples/gosl-basics\", not %q", config.basePath)
+	}
+	if config.BATCH_BLOCK < 1 {
+		invalid("config.BATCH_BLOCK", "must be at least 1, not %d", config.BATCH_BLOCK)
+	}
+	if config.loopBatch < 1 {
+		invalid("config.loopBatch", "must be at least 1, not %d", config.loopBatch)
+	}
+	if config.shutdownTimeout < 0 {
+		invalid("config.shutdownTimeout", "cannot be negative (%v)", config.shutdownTimeout)
+	}
+	if config.socketMode != "" {
+		if mode, err := strconv.ParseUint(config.socketMode, 8, 32); err != nil || mode > 0777 {
+			invalid("config.socketMode", "invalid permissions %q, must be octal, e.g. 0660", config.socketMode)
+		}
+	}
+	if config.bloomFilter {
+		if config.bloomCapacity == 0 {
+			invalid("options.bloomCapacity", "must be more than 0")
+		}
+		if config.bloomFalsePositive <= 0 || config.bloomFalsePositive >= 1 {
+			invalid("options.bloomFalsePositive", "must be between 0 and 1, not %v", config.bloomFalsePositive)
+		}
+	}
+	if (config.tlsCertFile == "") != (config.tlsKeyFile == "") {
+		invalid("tls.certFile", "TLS needs both a certificate (%q) and a key (%q)", config.tlsCertFile, config.tlsKeyFile)
+	}
+	if _, ok := tlsVersions[config.tlsMinVersion]; !ok {
+		invalid("tls.minVersion", "unknown TLS version %q, must be one of 1.0, 1.1, 1.2, 1.3", config.tlsMinVersion)
+	}
+	if _, err := logging.LogLevel(config.logLevel); err != nil {
+		invalid("log.logLevel", "unknown log level %q, must be one of CRITICAL, ERROR, WARNING, NOTICE, INFO, DEBUG", config.logLevel)
+	}
+	if config.logFilename == "" {
+		invalid("log.Filename", "cannot be empty")
+	}
+	if !slices.Contains(logFormats, config.logFormat) {
+		invalid("log.logFormat", "unknown log format %q, must be one of %v", config.logFormat, logFormats)
+	}
+	if config.accessLogFilename != "" && filepath.Clean(config.accessLogFilename) == filepath.Clean(config.logFilename) {
+		invalid("log.accessLog", "cannot be the same file as log.Filename (%q)", config.logFilename)
+	}
+	for key, value := range map[string]int{"log.MaxSize": config.maxSize, "log.MaxBackups": config.maxBackups, "log.MaxAge": config.maxAge} {
+		if value < 0 {
+			invalid(key, "cannot be negative (%d)", value)
+		}
+	}
+	// Maps are not sorted, but error messages should be.
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// printConfigErrors explains what's wrong, one problem per line.
+func printConfigErrors(err error) {
+	fmt.Fprintf(os.Stderr, "%s: invalid configuration:\n\t%s\n", programName, strings.ReplaceAll(err.Error(), "\n", "\n\t"))
+}
+
+// runConfig is `config show` (the default) and `config check`.
+func runConfig(ctx context.Context, args []string) error {
+	what := "show"
+	if len(args) > 0 {
+		what, args = args[0], args[1:]
+	}
+	if err := noArguments(args); err != nil {
+		return err
+	}
+	switch what {
+	case "show":
+		showConfiguration()
+	case "check":
+	default:
+		return fmt.Errorf("unknown subcommand %q, must be show or check", what)
+	}
+	if err := errors.Join(loadError, validateConfiguration(&goslConfig)); err != nil {
+		printConfigErrors(err)
+		return exitCode(1)
+	}
+	if what == "check" {
+		fmt.Println("configuration OK")
+	}
+	return nil
+}
+
+// showConfiguration prints every setting, with its effective value, and where it came from.
+func showConfiguration() {
+	if filename := viper.ConfigFileUsed(); filename != "" {
+		fmt.Printf("# configuration file: %s\n", filename)
+	} else {
+		fmt.Println("# no configuration file")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, setting := range loadedSettings {
+		value, source := fmt.Sprint(setting.value), settingSource(viper.GetViper(), setting.key)
+		_, quoted := setting.value.(string)
+		if f := changedFlag(setting.key); f != nil {
+			value, source = f.Value.String(), "flag --"+f.Name
+		}
+		switch {
+		case secretSettings[setting.key] && value != "":
+			value = "********"
+		case quoted:
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.key, value, source)
+	}
+	checkErr(w.Flush())
+}
@@ -0,0 +1,138 @@
+// Checks where settings come from (file, environment or defaults), and which ones are refused.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// configFile writes contents to an INI file, and reads it into a new viper, the way reloadConfiguration does.
+func configFile(t *testing.T, contents string) *viper.Viper {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.ini")
+	if err := os.WriteFile(filename, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.NewWithOptions(viper.WithCodecRegistry(codecs()))
+	v.SetConfigFile(filename)
+	v.SetConfigType(configType(filename))
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestConfigType(t *testing.T) {
+	for filename, want := range map[string]string{
+		"config.ini":			"ini",
+		"c.JSON":				"json",
+		"/etc/gosl/config.yaml":	"yaml",
+		"/etc/gosl.d/config":	"ini",
+		"config.":				"ini",
+		".goslrc":				"ini",
+		"..goslrc.toml":		"toml",
+		"":						"ini",
+	} {
+		if got := configType(filename); got != want {
+			t.Errorf("configType(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
+
+func TestConfigFileFrom(t *testing.T) {
+	for _, test := range []struct {
+		args	[]string
+		want	string
+	}{
+		{[]string{"serve", "--config", "c.ini"}, "c.ini"},
+		{[]string{"--config=c.ini", "serve"}, "c.ini"},
+		{[]string{"serve", "--config"}, ""},
+		{[]string{"resolve", "--", "--config", "c.ini"}, ""},
+	} {
+		if got := configFileFrom(test.args); got != test.want {
+			t.Errorf("configFileFrom(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestValidateConfiguration(t *testing.T) {
+	var config goslConfigOptions
+	if _, err := readConfiguration(configFile(t, ""), &config); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateConfiguration(&config); err != nil {
+		t.Errorf("the defaults are not valid: %v", err)
+	}
+
+	config.myPort, config.basePath, config.logLevel, config.loopBatch = "70000", "examples", "LOUD", 0
+	err := validateConfiguration(&config)
+	if err == nil {
+		t.Fatal("validateConfiguration() accepted nonsense")
+	}
+	var keys []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		key, _, _ := strings.Cut(line, ":")
+		keys = append(keys, key)
+	}
+	if got, want := strings.Join(keys, " "), "config.basePath config.loopBatch config.myPort log.logLevel"; got != want {
+		t.Errorf("validateConfiguration() complained about %s, want %s:\n%v", got, want, err)
+	}
+}
+
+func TestReadConfiguration(t *testing.T) {
+	v := configFile(t, "[config]\nmyPort = 4000\nmyDir = /var/lib/gosl\n\n[options]\nadminToken = from-file\n")
+	t.Setenv(envName("config.myPort"), "5000")
+	t.Setenv(envName("options.adminToken"), "from-environment")
+	t.Setenv(envName("log.logLevel"), "") // empty variables are ignored.
+	var config goslConfigOptions
+	settings, err := readConfiguration(v, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.myPort != "5000" || config.adminToken != "from-environment" {
+		t.Errorf("the environment did not win over the file: port %q, admin token %q", config.myPort, config.adminToken)
+	}
+	if config.myDir != "/var/lib/gosl" || config.logLevel != "ERROR" {
+		t.Errorf("myDir = %q (from the file), logLevel = %q (the default)", config.myDir, config.logLevel)
+	}
+	for key, want := range map[string]string{
+		"config.myPort":		"environment GOSL_CONFIG_MYPORT",
+		"config.myDir":			"config.ini",
+		"config.database":		"default",
+		"log.logLevel":			"default",
+	} {
+		if got := settingSource(v, key); got != want {
+			t.Errorf("settingSource(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if len(settings) == 0 || settings[0].key != "config.BATCH_BLOCK" {
+		t.Errorf("readConfiguration() returned the settings %v", settings)
+	}
+}
+
+func TestReadConfigurationErrors(t *testing.T) {
+	v := configFile(t, "[config]\nmyPort = 3000\nloopBatch = lots\n\n[option]\nadminToken = misspelt\n")
+	t.Setenv(envName("config.BATCH_BLOCK"), "many")
+	var config goslConfigOptions
+	_, err := readConfiguration(v, &config)
+	if err == nil {
+		t.Fatal("readConfiguration() accepted settings which are not numbers, and an unknown section")
+	}
+	for _, want := range []string{
+		"config.loopBatch (from config.ini)",
+		"config.BATCH_BLOCK (from environment GOSL_CONFIG_BATCH_BLOCK)",
+		"option.admintoken (from config.ini): unknown setting",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("readConfiguration() error does not mention %q:\n%v", want, err)
+		}
+	}
+	// What could not be converted falls back to the default.
+	if config.loopBatch != 1000 || config.BATCH_BLOCK != 100000 {
+		t.Errorf("loopBatch = %d, BATCH_BLOCK = %d; want the defaults", config.loopBatch, config.BATCH_BLOCK)
+	}
+}
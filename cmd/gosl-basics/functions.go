@@ -0,0 +1,32 @@
+// Auxiliary functions which I'm always using.
+// The ones for HTTP handling live with the handlers, in the gosl package.
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+)
+
+// checkErrPanic logs a fatal error and panics.
+func checkErrPanic(err error) {
+	if err != nil {
+		if pc, file, line, ok := runtime.Caller(1); ok {
+			log.Panicf("%s:%d (%v) - panic: %v\n", filepath.Base(file), line, pc, err)
+			return
+		}
+		log.Panic(err)
+	}
+}
+
+// checkErr checks if there is an error, and if yes, it logs it out and continues.
+//
+//	this is for 'normal' situations when we want to get a log if something goes wrong but do not need to panic
+func checkErr(err error) {
+	if err != nil {
+		if pc, file, line, ok := runtime.Caller(1); ok {
+			log.Errorf("%s:%d (%v) - error: %v\n", filepath.Base(file), line, pc, err)
+			return
+		}
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,54 @@
+// Optional gRPC listener, next to the standalone HTTP server, for internal services doing lots of lookups.
+// It uses the same store as the HTTP handlers, and the same TLS certificates, if any.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics/goslpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// serveGRPC listens on goslConfig.grpcListen until the context is cancelled; in-flight calls
+// (including open Resolve streams) get up to shutdownTimeout to finish.
+// It returns the service, so that it can be reconfigured, and an error only if it could not start at all.
+func serveGRPC(ctx context.Context, store *gosl.Store, tlsConfig *tls.Config) (gosl.Reconfigurable, error) {
+	listener, err := listenOn(goslConfig.grpcListen)
+	if err != nil {
+		return nil, err
+	}
+	var options []grpc.ServerOption
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpc.NewServer(options...)
+	service := gosl.NewGRPCService(store, handlerOptions()...)
+	goslpb.RegisterNameServiceServer(grpcServer, service)
+	log.Info("starting to run gRPC service on", listener.Addr())
+
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			log.Debug("all in-flight gRPC calls finished")
+		case <-time.After(goslConfig.shutdownTimeout):
+			log.Warningf("in-flight gRPC calls did not finish within %v\n", goslConfig.shutdownTimeout)
+			grpcServer.Stop()
+		}
+	}()
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Error("gRPC server stopped:", err)
+		}
+	}()
+	return service.(gosl.Reconfigurable), nil
+}
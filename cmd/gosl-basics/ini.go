@@ -0,0 +1,67 @@
+// INI support for viper, which dropped it in v1.20, without telling anyone but its changelog;
+// since then, `config.ini` was silently ignored ("decoder not found for this format"), and
+// everything ran with the defaults. This puts it back, using the same library that viper used to.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/viper"
+	"gopkg.in/ini.v1"
+)
+
+// iniCodec converts between INI files and viper's nested maps: one map per [section], and keys
+// before the first section go to the top level.
+type iniCodec struct{}
+
+func (iniCodec) Decode(b []byte, v map[string]any) error {
+	cfg, err := ini.Load(b)
+	if err != nil {
+		return err
+	}
+	for _, section := range cfg.Sections() {
+		values := v
+		if section.Name() != ini.DefaultSection {
+			values = make(map[string]any)
+			v[section.Name()] = values
+		}
+		for _, key := range section.Keys() {
+			values[key.Name()] = key.Value()
+		}
+	}
+	return nil
+}
+
+func (iniCodec) Encode(v map[string]any) ([]byte, error) {
+	cfg := ini.Empty()
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values, ok := v[key].(map[string]any)
+		if !ok {
+			values = map[string]any{key: v[key]}
+			key = ini.DefaultSection
+		}
+		section := cfg.Section(key)
+		for name, value := range values {
+			if _, err := section.NewKey(name, fmt.Sprint(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var buf bytes.Buffer
+	_, err := cfg.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// codecs knows about INI, plus everything that viper knows by itself (JSON, TOML, YAML...).
+func codecs() viper.CodecRegistry {
+	registry := viper.NewCodecRegistry()
+	checkErr(registry.RegisterCodec("ini", iniCodec{}))
+	return registry
+}
@@ -0,0 +1,131 @@
+// Listeners for the standalone server and FastCGI modes.
+// Besides the usual TCP port, we can listen on a Unix domain socket (with configurable owner
+// and permissions, so that the web server can connect to it) or on sockets passed by systemd.
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// openListeners returns the listener(s) configured by the `listen` option, which can be:
+//   - empty: TCP on `myPort` for the standalone server, or stdin for FastCGI (the classic behaviour);
+//   - "unix:/path/to/socket": a Unix domain socket, owned by `socketOwner` with mode `socketMode`;
+//   - "systemd": whatever sockets were passed by systemd socket activation (LISTEN_FDS);
+//   - anything else is taken to be a TCP address, e.g. "127.0.0.1:3000".
+func openListeners(fastCGI bool) ([]net.Listener, error) {
+	listen := goslConfig.listen
+	switch {
+	case listen == "" && fastCGI:
+		l, err := net.FileListener(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("stdin is not a socket — are we running under a web server? (%w)", err)
+		}
+		return []net.Listener{l}, nil
+	case listen == "":
+		l, err := net.Listen("tcp", ":"+goslConfig.myPort)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	case listen == "systemd":
+		return systemdListeners()
+	default:
+		l, err := listenOn(listen)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+}
+
+// listenOn listens on a single address, either "unix:/path/to/socket" or a TCP address.
+func listenOn(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return listenUnix(path)
+	}
+	return net.Listen("tcp", address)
+}
+
+// listenUnix creates a Unix domain socket at path, removing any stale socket left behind
+// by a previous run, and sets its permissions and owner according to the configuration.
+// The socket is removed when the listener is closed, i.e. when shutting down.
+func listenUnix(path string) (net.Listener, error) {
+	if stat, err := os.Stat(path); err == nil {
+		if stat.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%q exists and is not a socket, refusing to remove it", path)
+		}
+		log.Debugf("removing stale socket %q\n", path)
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(true) // the default, for now; but leaving sockets behind is not an option.
+	if goslConfig.socketMode != "" {
+		mode, err := strconv.ParseUint(goslConfig.socketMode, 8, 32)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("invalid socketMode %q (must be octal, e.g. 0660): %w", goslConfig.socketMode, err)
+		}
+		if err = os.Chmod(path, os.FileMode(mode)); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	if goslConfig.socketOwner != "" {
+		uid, gid, err := lookupOwner(goslConfig.socketOwner)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		if err = os.Chown(path, uid, gid); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	log.Debugf("listening on Unix socket %q (mode %q, owner %q)\n", path, goslConfig.socketMode, goslConfig.socketOwner)
+	return l, nil
+}
+
+// lookupOwner converts "user", "user:group" or ":group" (names or numeric ids) into uid/gid;
+// -1 means 'leave unchanged', as in os.Chown().
+func lookupOwner(owner string) (uid int, gid int, err error) {
+	uid, gid = -1, -1
+	userName, groupName, _ := strings.Cut(owner, ":")
+	if userName != "" {
+		if uid, err = strconv.Atoi(userName); err != nil {
+			u, err := user.Lookup(userName)
+			if err != nil {
+				return -1, -1, err
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if groupName != "" {
+		if gid, err = strconv.Atoi(groupName); err != nil {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return -1, -1, err
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// listenerNames is just for logging purposes.
+func listenerNames(listeners []net.Listener) string {
+	names := make([]string, 0, len(listeners))
+	for _, l := range listeners {
+		names = append(names, l.Addr().Network()+":"+l.Addr().String())
+	}
+	return strings.Join(names, ", ")
+}
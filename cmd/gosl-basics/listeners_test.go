@@ -0,0 +1,98 @@
+// Checks the listeners: Unix sockets (permissions, stale sockets, cleaning up), TCP, and socket owners.
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	goslConfig.socketMode, goslConfig.socketOwner = "0600", ""
+	path := filepath.Join(t.TempDir(), "gosl.sock")
+
+	// A stale socket, left behind by a run which got killed, is replaced.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listenOn("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode()&os.ModeSocket == 0 || stat.Mode().Perm() != 0600 {
+		t.Errorf("socket mode is %v, want a socket with 0600", stat.Mode())
+	}
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the socket is still there after closing the listener: %v", err)
+	}
+
+	// Anything which is not a socket is left alone.
+	if err = os.WriteFile(path, []byte("precious"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = listenUnix(path); err == nil {
+		l.Close()
+		t.Error("listenUnix() replaced a regular file")
+	}
+
+	goslConfig.socketMode = "rw-rw----"
+	if l, err = listenUnix(filepath.Join(t.TempDir(), "bad-mode.sock")); err == nil {
+		l.Close()
+		t.Error("listenUnix() accepted a socketMode which is not octal")
+	}
+	goslConfig.socketMode = "0660"
+}
+
+func TestOpenListeners(t *testing.T) {
+	goslConfig.listen = "127.0.0.1:0"
+	listeners, err := openListeners(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 1 || listeners[0].Addr().Network() != "tcp" {
+		t.Errorf("openListeners() for a TCP address = %v", listenerNames(listeners))
+	}
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	// Without LISTEN_PID and LISTEN_FDS, there are no systemd sockets.
+	goslConfig.listen = "systemd"
+	t.Setenv("LISTEN_PID", "")
+	if _, err = openListeners(false); err == nil {
+		t.Error("openListeners() found systemd sockets where there were none")
+	}
+	goslConfig.listen = ""
+}
+
+func TestLookupOwner(t *testing.T) {
+	for _, test := range []struct {
+		owner    string
+		uid, gid int
+	}{
+		{"", -1, -1},
+		{"33", 33, -1},
+		{":44", -1, 44},
+		{"1000:1001", 1000, 1001},
+	} {
+		uid, gid, err := lookupOwner(test.owner)
+		if err != nil || uid != test.uid || gid != test.gid {
+			t.Errorf("lookupOwner(%q) = %d, %d, %v; want %d, %d", test.owner, uid, gid, err, test.uid, test.gid)
+		}
+	}
+	if _, _, err := lookupOwner("no-such-user-hopefully"); err == nil {
+		t.Error("lookupOwner() found a user which does not exist")
+	}
+}
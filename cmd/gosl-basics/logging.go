@@ -0,0 +1,140 @@
+// Log formats: the good old text lines, or one JSON object per line, for log pipelines which would rather
+// not parse text; and the access log (see accesslog.go in the gosl package), which goes to its own file,
+// in the same format as the log, so that it can be indexed per region and object.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+	"github.com/op/go-logging"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// logFormats are the values for log.logFormat.
+var logFormats = []string{"text", "json"}
+
+// logFormatter returns the formatter for the configured format; colours are only for terminals,
+// since they're just noise in a file.
+func logFormatter(format string, colour bool) logging.Formatter {
+	if format == "json" {
+		return jsonFormatter{}
+	}
+	if colour {
+		return logging.MustStringFormatter(`%{color}%{time:2006/01/02 15:04:05.0} %{shortfile} - %{shortfunc} ▶ %{level:.4s}%{color:reset} %{message}`)
+	}
+	return logging.MustStringFormatter(`%{time:2006/01/02 15:04:05.0} %{shortfile} - %{shortfunc} ▶ %{level:.4s} %{message}`)
+}
+
+// jsonFormatter writes each log record as a JSON object, on a line of its own.
+type jsonFormatter struct{}
+
+// Format implements logging.Formatter.
+func (jsonFormatter) Format(calldepth int, r *logging.Record, w io.Writer) error {
+	record := struct {
+		Time		time.Time	`json:"time"`
+		Level		string		`json:"level"`
+		Module		string		`json:"module"`
+		File		string		`json:"file,omitempty"`
+		Function	string		`json:"function,omitempty"`
+		Message		string		`json:"message"`
+	}{
+		Time:		r.Time,
+		Level:		r.Level.String(),
+		Module:		r.Module,
+		Message:	strings.TrimRight(r.Message(), "\n"),	// most of our messages end with one, which is fine for text, but not here.
+	}
+	// Same as go-logging's %{shortfile} and %{shortfunc}.
+	if pc, file, line, ok := runtime.Caller(calldepth + 1); ok {
+		record.File = filepath.Base(file) + ":" + strconv.Itoa(line)
+		if f := runtime.FuncForPC(pc); f != nil {
+			record.Function = f.Name()[strings.LastIndex(f.Name(), ".")+1:]
+		}
+	}
+	return json.NewEncoder(w).Encode(record)
+}
+
+// The access log is only opened by the commands which need it, the first time they ask for it.
+var (
+	accessLogOnce	sync.Once
+	accessLogFunc	func(gosl.AccessEntry)
+)
+
+// accessLog returns what gosl.WithAccessLog needs to write to log.accessLog, or nil if there is no access log.
+func accessLog() func(gosl.AccessEntry) {
+	accessLogOnce.Do(func() {
+		if goslConfig.accessLogFilename == "" {
+			return
+		}
+		// Same rotation as the log; lumberjack is safe for concurrent use, and each entry is a single Write.
+		w := &lumberjack.Logger{
+			Filename:   goslConfig.accessLogFilename,
+			MaxSize:    goslConfig.maxSize, // megabytes
+			MaxBackups: goslConfig.maxBackups,
+			MaxAge:     goslConfig.maxAge, //days
+		}
+		format := goslConfig.logFormat
+		accessLogFunc = func(entry gosl.AccessEntry) {
+			if _, err := w.Write(formatAccessEntry(entry, format)); err != nil {
+				log.Warningf("could not write to access log %q: %v\n", goslConfig.accessLogFilename, err)
+			}
+		}
+		log.Infof("logging all requests to %q\n", goslConfig.accessLogFilename)
+	})
+	return accessLogFunc
+}
+
+// formatAccessEntry returns a line for the access log: JSON, or key=value pairs (a.k.a. logfmt),
+// which are just as easy to read, and not much harder to parse.
+func formatAccessEntry(entry gosl.AccessEntry, format string) []byte {
+	if format == "json" {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			line = []byte(strconv.Quote(err.Error())) // can't happen, since everything in there is a string or a number.
+		}
+		return append(line, '\n')
+	}
+	var b strings.Builder
+	pair := func(key string, value string) {
+		// Quote only what needs quoting, like logfmt does.
+		if value == "" || strings.ContainsAny(value, " =") || strconv.Quote(value) != `"`+value+`"` {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+	b.WriteString(entry.Time.Format("2006/01/02 15:04:05.0"))
+	pair("remote", entry.RemoteAddr)
+	pair("method", entry.Method)
+	pair("path", entry.Path)
+	// Maps have no order, but log lines should.
+	for _, name := range slices.Sorted(maps.Keys(entry.Params)) {
+		pair("params."+name, entry.Params[name])
+	}
+	pair("status", strconv.Itoa(entry.Status))
+	pair("bytes", strconv.FormatInt(entry.Bytes, 10))
+	pair("latency", entry.Latency.String())
+	if entry.Region != "" {
+		pair("region", entry.Region)
+	}
+	if entry.OwnerKey != "" {
+		pair("ownerKey", entry.OwnerKey)
+	}
+	if entry.ObjectName != "" {
+		pair("objectName", entry.ObjectName)
+	}
+	for _, outcome := range slices.Sorted(maps.Keys(entry.Lookups)) {
+		pair("lookups."+outcome, strconv.Itoa(entry.Lookups[outcome]))
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
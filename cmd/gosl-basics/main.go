@@ -0,0 +1,262 @@
+// gosl-basics implements the name2key/key2name functionality for about
+// ten million avatar names (≈⅙ of the total database).
+// All the real work is done by the gosl package (in the root of this repository); this is just
+// the command-line wrapper, which reads the configuration and runs one of the commands in commands.go.
+package main
+
+import (
+	//	"bufio"			// replaced by the more sophisticated readline (gwyneth 20211106)
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	//	"regexp"
+	"time"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+	//	"gopkg.in/go-playground/validator.v9"	// to validate UUIDs... and a lot of thinks
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Logging setup.
+var log = logging.MustGetLogger("gosl") // configuration for the go-logging logger, must be available everywhere
+// Sets up type of log.
+var logFormat logging.Formatter
+// The level of all our log backends; see setLogLevel.
+var logLevels logging.LeveledBackend
+
+// Set to the program name, which is the first entry in os.Args[].
+// Do some cleanup as well. This is just for avoiding redundancy and having
+// a nice-to-remember name! (gwyneth 20231203)
+var programName = filepath.Clean(os.Args[0])
+
+/*
+				  .__
+  _____ _____  |__| ____
+ /		  \\__	 \ |	 |/	\
+|  Y Y	\/ __ \|	 |		 |	 \
+|__|_|	(____  /__|___|	 /
+	  \/	 \/			  \/
+*/
+
+// Configuration options.
+type goslConfigOptions struct {
+	BATCH_BLOCK                             int		// how many entries to write to the database as a block; the bigger, the faster, but the more memory it consumes.
+	loopBatch								int		// how many entries to skip when emitting debug messages in a tight loop.
+	noMemory, isServer, isShell             bool	// !isServer && !isShell => FastCGI!
+	myDir, myPort, importFilename, database string
+	databaseName							string	// Name of the database, as placed on disk. Defaults to "gosl-database.db".
+	memorySnapshot							bool	// memory database only: load it from (and save it to) the database file.
+	configFilename							string	// name (+ path?) of the configuratio file.
+	logLevel, logFilename                   string	// for logs.
+	maxSize, maxBackups, maxAge             int		// logs configuration options.
+	logFormat								string	// "text" or "json", for the log and the access log.
+	accessLogFilename						string	// if set, log every HTTP request there.
+	redactNames								bool	// keep avatar names out of the access log.
+	bloomFilter								bool	// keep a Bloom filter of all names/UUIDs, to answer definite misses without touching the database.
+	bloomCapacity							uint	// expected number of keys (names *and* UUIDs) in the Bloom filter.
+	bloomFalsePositive						float64	// desired false positive rate for the Bloom filter.
+	shutdownTimeout							time.Duration	// how long to wait for in-flight requests when shutting down.
+	listen									string	// "" (port/stdin), "unix:/path", "systemd", or a TCP address.
+	basePath								string	// where the web server mounts us, e.g. "/examples/gosl-basics"; see gosl.WithBasePath.
+	socketOwner, socketMode					string	// for Unix domain sockets, e.g. "www-data:www-data" and "0660".
+	tlsCertFile, tlsKeyFile					string	// TLS certificate and key for the standalone server; empty means plain HTTP.
+	tlsMinVersion							string	// minimum TLS version, e.g. "1.2".
+	tlsRedirect								string	// if set, address of a plain HTTP listener that redirects to HTTPS, e.g. ":80".
+	signingSecret							string	// if set, registrations must be signed with it (see touch.lsl).
+	adminToken								string	// if set, enables the admin endpoints (e.g. backups), which require it.
+	grpcListen								string	// if set, also serve gRPC on this address (standalone server only).
+	respListen								string	// if set, also serve the Redis protocol on this address (standalone server only).
+	resolveFilename, resolveOutput			string	// batch resolver: file with names/UUIDs ("-" is stdin), and where to write the results.
+	resolveFormat							string	// batch resolver output, "csv" or "jsonl".
+	resolveColumn							int		// batch resolver: CSV column to read (1 is the first), or 0 for whole lines.
+	resolveHeader							bool	// batch resolver: skip the first line of the input.
+}
+
+var goslConfig goslConfigOptions	// list of all configuration options.
+
+// loadConfiguration reads our configuration from a `config.ini` file (or whatever --config says),
+// and the environment; it returns whatever was wrong with them, but it fills in goslConfig anyway,
+// so that `config show` can show what's wrong.
+func loadConfiguration() error {
+	fmt.Fprintln(os.Stderr, "Reading ", programName, " configuration:") // note that we might not have go-logging active as yet, so we use fmt; stderr keeps stdout clean for --resolve
+	// Open our config file and extract relevant data from there
+	// Find and read the config file
+	var readErr error
+	if err := viper.ReadInConfig(); errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		// Not having one is fine, though; but if there is one, it must be readable.
+		fmt.Fprintln(os.Stderr, "no configuration file found, using the defaults (and GOSL_* environment variables, if any)")
+	} else if err != nil {
+		readErr = fmt.Errorf("cannot read configuration file: %w", err)
+	}
+	var err error
+	loadedSettings, err = readConfiguration(viper.GetViper(), &goslConfig)
+	return errors.Join(readErr, err)
+}
+
+// readConfiguration fills in config with what v has read, the environment, or the defaults, and returns
+// all the settings it read; this is also used when reloading the configuration (see reload.go), with a brand new v.
+// Values which cannot be converted (e.g. a port which is not a number) are errors, and so are unknown settings;
+// whether the values make sense is up to validateConfiguration.
+func readConfiguration(v *viper.Viper, config *goslConfigOptions) ([]configSetting, error) {
+	r := newConfigReader(v)
+	// NOTE(gwyneth): the authors of say that 100000 is way too much for Badger.
+	// Let's see what happens with BuntDB
+	config.BATCH_BLOCK = r.Int("config.BATCH_BLOCK", 100000)
+	config.loopBatch = r.Int("config.loopBatch", 1000)
+	config.myPort = r.String("config.myPort", "3000")
+	config.myDir = r.String("config.myDir", "slkvdb")
+	config.isServer = r.Bool("config.isServer", false)
+	config.isShell = r.Bool("config.isShell", false)
+	config.database = r.String("config.database", "badger") // currently, badger, boltdb, buntdb, leveldb, memory, mmap (read-only), pebble, sqlite.
+	config.databaseName = r.String("config.databaseName", "gosl-database.db") // file (or directory) name, inside myDir.
+	config.shutdownTimeout = r.Duration("config.shutdownTimeout", 15 * time.Second)
+	config.listen = r.String("config.listen", "") // empty means the port for the server, stdin for FastCGI.
+	config.basePath = r.String("config.basePath", "") // empty means the end of the path for FastCGI, and the root for the server.
+	config.grpcListen = r.String("config.grpcListen", "") // empty means no gRPC.
+	config.respListen = r.String("config.respListen", "") // empty means no Redis protocol.
+	config.socketOwner = r.String("config.socketOwner", "")
+	config.socketMode = r.String("config.socketMode", "0660")
+	config.importFilename = r.String("options.importFilename", "") // must be empty by default.
+	config.noMemory = r.Bool("options.noMemory", true) // this was always the default for the flag, which overrode the configuration.
+	config.memorySnapshot = r.Bool("options.memorySnapshot", false) // without it, a memory database starts empty every time.
+	config.bloomFilter = r.Bool("options.bloomFilter", true)
+	config.bloomCapacity = r.Uint("options.bloomCapacity", 20000000) // W-Hat has ~10 million avatars, and we store name *and* UUID.
+	config.bloomFalsePositive = r.Float64("options.bloomFalsePositive", 0.01)
+	config.signingSecret = r.String("options.signingSecret", "") // no flag for this one, it would show up on `ps`.
+	config.adminToken = r.String("options.adminToken", "") // same here.
+	// TLS options (standalone server only)
+	config.tlsCertFile = r.String("tls.certFile", "")
+	config.tlsKeyFile = r.String("tls.keyFile", "")
+	config.tlsMinVersion = r.String("tls.minVersion", "1.2")
+	config.tlsRedirect = r.String("tls.redirect", "")
+	// Logging options
+	config.logFilename = r.String("log.Filename", "gosl.log")
+	config.logLevel = r.String("log.logLevel", "ERROR")
+	config.maxSize = r.Int("log.MaxSize", 10)
+	config.maxBackups = r.Int("log.MaxBackups", 3)
+	config.maxAge = r.Int("log.MaxAge", 28)
+	config.logFormat = r.String("log.logFormat", "text") // or "json".
+	config.accessLogFilename = r.String("log.accessLog", "") // empty means no access log.
+	config.redactNames = r.Bool("log.redactNames", false)
+	return r.settings, r.Err()
+}
+
+// main() starts here.
+func main() {
+	// Config viper, which reads in the configuration file every time it's needed.
+	viper.SetOptions(viper.WithCodecRegistry(codecs())) // viper no longer knows about INI by itself.
+	// --config has to be read before all the other flags, since the file has their defaults.
+	if goslConfig.configFilename = configFileFrom(os.Args[1:]); goslConfig.configFilename != "" {
+		viper.SetConfigFile(goslConfig.configFilename)
+		// we can switch filetypes here
+		viper.SetConfigType(configType(goslConfig.configFilename))
+	} else {
+		// Note that we need some hard-coded variables for the path and config file name.
+		viper.SetConfigName("config")
+		// just to make sure; it's the same format as OpenSimulator (or MySQL) config files.
+		viper.SetConfigType("ini")
+		// optionally, look for config in the working directory.
+		viper.AddConfigPath(".")
+		// this is also a great place to put standard configurations:
+		// NOTE:
+		viper.AddConfigPath(filepath.Join("$HOME/.config/", programName))
+		// last chance — check on the usual place for Go source.
+		viper.AddConfigPath("$HOME/go/src/git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics/")
+	}
+
+	loadError = loadConfiguration()
+
+	// Which command are we running? This also sets up its flags (which override the configuration
+	// file) and parses them; without a command, the old --server/--shell flags decide, as they always did.
+	cmd, flags, args := selectCommand(os.Args[1:])
+	if err := viper.BindPFlags(flags); err != nil {
+		fmt.Printf("error parsing/binding flags: %s\n", err)
+	}
+
+	// The flags are in, so now we can check whether it all makes sense. `help` doesn't care,
+	// and `config` explains what's wrong by itself.
+	if cmd.name != "help" && cmd.name != "config" {
+		if err := errors.Join(loadError, validateConfiguration(&goslConfig)); err != nil {
+			printConfigErrors(err)
+			os.Exit(2)
+		}
+	}
+	// The configuration is read again, on demand, by serve and fcgi; see reload.go.
+	commandLine = flags
+
+	// NOTE(gwyneth): We cannot write to stdout if we're running as FastCGI, only to logs!
+	if cmd.chatty {
+		fmt.Println(programName, " is starting...")
+	}
+
+	// This is mostly to deal with scoping issues below. (gwyneth 20211106)
+	var err error
+
+	// Setup the lumberjack rotating logger. This is because we need it for the go-logging logger when writing to files. (20170813)
+	rotatingLogger := &lumberjack.Logger{
+		Filename:   goslConfig.logFilename,
+		MaxSize:    goslConfig.maxSize, // megabytes
+		MaxBackups: goslConfig.maxBackups,
+		MaxAge:     goslConfig.maxAge, //days
+	}
+
+	// Setup the go-logging Logger. Do **not** log to stderr if running as FastCGI!
+	// Formatting for stderr and file is basically the same, except for the colours (see logging.go).
+	backendFile := logging.NewLogBackend(rotatingLogger, "", 0)
+	logBackends := []logging.Backend{logging.NewBackendFormatter(backendFile, logFormatter(goslConfig.logFormat, false))}
+	if cmd.chatty {
+		backendStderr := logging.NewLogBackend(os.Stderr, "", 0)
+		logBackends = append(logBackends, logging.NewBackendFormatter(backendStderr, logFormatter(goslConfig.logFormat, isTerminal(os.Stderr))))
+	}
+	// Until now, go-logging was using its default backend, which logs everything to stderr.
+	// From now on, both file and stderr share the same level, which can be changed while running.
+	logLevels = logging.SetBackend(logBackends...)
+	if err = setLogLevel(goslConfig.logLevel); err != nil {
+		log.Warningf("could not set log level to %q — invalid?\nlogging.LogLevel() returned error %q\n", goslConfig.logLevel, err)
+	} else {
+		log.Debugf("log level set to: %v\n", logLevels.GetLevel("gosl"))
+	}
+	loggedConfig := goslConfig	// a copy, so that secrets do not end up in the logs.
+	if loggedConfig.signingSecret != "" {
+		loggedConfig.signingSecret = "********"
+	}
+	if loggedConfig.adminToken != "" {
+		loggedConfig.adminToken = "********"
+	}
+	log.Debugf("Full config: %+v\n", loggedConfig)
+
+	// From now on, SIGINT/SIGTERM (e.g. from systemd) will cancel this context, instead of killing us
+	// in the middle of a transaction; everything below is supposed to check for it and wind down.
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	// Commands open the database themselves, since some of them (e.g. stats --url) don't need it, and
+	// others (migrate) need two; they close it before returning, so that we can just exit afterwards.
+	err = cmd.run(ctx, args)
+	var code exitCode
+	if errors.As(err, &code) {
+		os.Exit(int(code))
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %v\n", programName, cmd.name, err) // under FastCGI, this ends up in the web server's error log.
+		os.Exit(1)
+	}
+}
+
+// storeConfig translates our configuration into what the gosl package needs.
+func storeConfig() gosl.Config {
+	return gosl.Config{
+		Database:			goslConfig.database,
+		Dir:				goslConfig.myDir,
+		DatabaseName:		goslConfig.databaseName,
+		NoMemory:			goslConfig.noMemory,
+		MemorySnapshot:		goslConfig.memorySnapshot,
+		BatchBlock:			goslConfig.BATCH_BLOCK,
+		LoopBatch:			goslConfig.loopBatch,
+		BloomFilter:		goslConfig.bloomFilter,
+		BloomCapacity:		goslConfig.bloomCapacity,
+		BloomFalsePositive:	goslConfig.bloomFalsePositive,
+	}
+}
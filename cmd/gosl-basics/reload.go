@@ -0,0 +1,204 @@
+// Reloading the configuration of a running server (serve or fcgi), on SIGHUP (`systemctl reload`)
+// or whenever the configuration file changes. The log level, the signing secret, the admin token and
+// whether names are kept out of the access log change straight away, for all requests arriving from
+// then on; everything else (database, listeners, TLS, Bloom filter, log files...) only changes with
+// a restart, and we say so in the logs, instead of pretending.
+// The new configuration is checked first, and, if anything is wrong with it, none of it is used.
+// Flags given on the command line still win over the file, as they do when starting.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+	"github.com/fsnotify/fsnotify"
+	"github.com/op/go-logging"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// commandLine has the flags of the command being run, so that we know which settings they override.
+var commandLine *flag.FlagSet
+
+// restartOnly are the settings which a running server cannot change.
+var restartOnly = []struct {
+	key		string
+	value	func(*goslConfigOptions) any
+}{
+	{"config.database",				func(c *goslConfigOptions) any { return c.database }},
+	{"config.myDir",				func(c *goslConfigOptions) any { return c.myDir }},
+	{"config.databaseName",			func(c *goslConfigOptions) any { return c.databaseName }},
+	{"config.BATCH_BLOCK",			func(c *goslConfigOptions) any { return c.BATCH_BLOCK }},
+	{"config.loopBatch",			func(c *goslConfigOptions) any { return c.loopBatch }},
+	{"config.myPort",				func(c *goslConfigOptions) any { return c.myPort }},
+	{"config.listen",				func(c *goslConfigOptions) any { return c.listen }},
+	{"config.basePath",				func(c *goslConfigOptions) any { return c.basePath }},
+	{"config.grpcListen",			func(c *goslConfigOptions) any { return c.grpcListen }},
+	{"config.respListen",			func(c *goslConfigOptions) any { return c.respListen }},
+	{"config.socketOwner",			func(c *goslConfigOptions) any { return c.socketOwner }},
+	{"config.socketMode",			func(c *goslConfigOptions) any { return c.socketMode }},
+	{"config.shutdownTimeout",		func(c *goslConfigOptions) any { return c.shutdownTimeout }},
+	{"options.noMemory",			func(c *goslConfigOptions) any { return c.noMemory }},
+	{"options.memorySnapshot",		func(c *goslConfigOptions) any { return c.memorySnapshot }},
+	{"options.bloomFilter",			func(c *goslConfigOptions) any { return c.bloomFilter }},
+	{"options.bloomCapacity",		func(c *goslConfigOptions) any { return c.bloomCapacity }},
+	{"options.bloomFalsePositive",	func(c *goslConfigOptions) any { return c.bloomFalsePositive }},
+	{"tls.certFile",				func(c *goslConfigOptions) any { return c.tlsCertFile }},
+	{"tls.keyFile",					func(c *goslConfigOptions) any { return c.tlsKeyFile }},
+	{"tls.minVersion",				func(c *goslConfigOptions) any { return c.tlsMinVersion }},
+	{"tls.redirect",				func(c *goslConfigOptions) any { return c.tlsRedirect }},
+	{"log.Filename",				func(c *goslConfigOptions) any { return c.logFilename }},
+	{"log.MaxSize",					func(c *goslConfigOptions) any { return c.maxSize }},
+	{"log.MaxBackups",				func(c *goslConfigOptions) any { return c.maxBackups }},
+	{"log.MaxAge",					func(c *goslConfigOptions) any { return c.maxAge }},
+	{"log.logFormat",				func(c *goslConfigOptions) any { return c.logFormat }},
+	{"log.accessLog",				func(c *goslConfigOptions) any { return c.accessLogFilename }},
+}
+
+// setLogLevel changes the level of all log backends (file and stderr) at once.
+func setLogLevel(level string) error {
+	theLogLevel, err := logging.LogLevel(level)
+	if err != nil {
+		return err
+	}
+	logLevels.SetLevel(theLogLevel, "gosl")
+	return nil
+}
+
+// watchConfiguration reloads the configuration on SIGHUP, or when the file changes, until the context
+// is cancelled; targets are the handlers (HTTP, gRPC...) which get the new signing secret and admin token.
+func watchConfiguration(ctx context.Context, targets ...gosl.Reconfigurable) {
+	filename := viper.ConfigFileUsed()
+	// Without this, SIGHUP would kill us, which is not what `systemctl reload` is supposed to do.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if filename == "" {
+		log.Info("no configuration file was found, so there is nothing to reload")
+	} else if watcher, err := fsnotify.NewWatcher(); err != nil {
+		log.Warningf("cannot watch %s for changes, reload it with SIGHUP instead: %v\n", filename, err)
+	} else if err = watcher.Add(filepath.Dir(filename)); err != nil {
+		// Like the TLS certificates, we watch the directory, since editors replace files instead of writing to them.
+		watcher.Close()
+		log.Warningf("cannot watch %s for changes, reload it with SIGHUP instead: %v\n", filename, err)
+	} else {
+		events, watchErrors = watcher.Events, watcher.Errors
+		go func() {
+			<-ctx.Done()
+			watcher.Close()
+		}()
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+		// Editors often write files in several steps, so wait for things to settle down a bit.
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Notice("received SIGHUP, reloading configuration...")
+				reload(filename, targets)
+			case event, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+				if filepath.Clean(event.Name) == filepath.Clean(filename) && !event.Has(fsnotify.Chmod) {
+					log.Debugf("configuration file changed: %v\n", event)
+					debounce = time.After(time.Second)
+				}
+			case err, ok := <-watchErrors:
+				if !ok {
+					watchErrors = nil
+					continue
+				}
+				log.Errorf("error while watching %s: %v\n", filename, err)
+			case <-debounce:
+				debounce = nil
+				reload(filename, targets)
+			}
+		}
+	}()
+}
+
+// reload tells systemd what's going on (if it's watching), and logs whatever went wrong.
+func reload(filename string, targets []gosl.Reconfigurable) {
+	if filename == "" {
+		log.Warning("no configuration file was found when starting, so there is nothing to reload")
+		return
+	}
+	sdNotify("RELOADING=1")
+	if err := reloadConfiguration(filename, targets); err != nil {
+		log.Errorf("configuration not reloaded, still using the old one: %v\n", err)
+	}
+	sdNotify("READY=1")
+}
+
+// reloadConfiguration reads the configuration file into a fresh viper (the global one belongs to main),
+// checks it, and then applies whatever can be applied. It is only ever called from one goroutine,
+// and the only settings it changes are not read by anyone else after starting, except through the targets.
+func reloadConfiguration(filename string, targets []gosl.Reconfigurable) error {
+	v := viper.NewWithOptions(viper.WithCodecRegistry(codecs()))
+	v.SetConfigFile(filename)
+	v.SetConfigType(configType(filename))
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	// Check everything first, with the same checks as when starting.
+	var next goslConfigOptions
+	if _, err := readConfiguration(v, &next); err != nil {
+		return err
+	}
+	if changedFlag("log.logLevel") != nil {
+		next.logLevel = goslConfig.logLevel
+	}
+	if err := validateConfiguration(&next); err != nil {
+		return err
+	}
+	for _, setting := range restartOnly {
+		if changedFlag(setting.key) != nil {
+			continue
+		}
+		if before, after := setting.value(&goslConfig), setting.value(&next); before != after {
+			log.Warningf("%s changed from %v to %v, but that needs a restart\n", setting.key, before, after)
+		}
+	}
+
+	// And now apply it.
+	var changes []string
+	if next.logLevel != goslConfig.logLevel {
+		changes = append(changes, fmt.Sprintf("log level %s → %s", goslConfig.logLevel, next.logLevel))
+	}
+	if next.signingSecret != goslConfig.signingSecret {
+		changes = append(changes, "signing secret")
+	}
+	if next.adminToken != goslConfig.adminToken {
+		changes = append(changes, "admin token")
+	}
+	if next.redactNames != goslConfig.redactNames {
+		changes = append(changes, fmt.Sprintf("name redaction %v → %v", goslConfig.redactNames, next.redactNames))
+	}
+	checkErr(setLogLevel(next.logLevel)) // already checked above.
+	goslConfig.logLevel, goslConfig.signingSecret, goslConfig.adminToken = next.logLevel, next.signingSecret, next.adminToken
+	goslConfig.redactNames = next.redactNames
+	for _, target := range targets {
+		target.Reconfigure(handlerOptions()...)
+	}
+	if len(changes) == 0 {
+		log.Noticef("configuration reloaded from %s, nothing that can be changed while running has changed\n", filename)
+	} else {
+		log.Noticef("configuration reloaded from %s, changed: %s\n", filename, strings.Join(changes, ", "))
+	}
+	return nil
+}
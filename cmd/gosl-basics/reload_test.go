@@ -0,0 +1,121 @@
+// Checks that reloading the configuration applies what it can, warns about the rest, and applies nothing if anything is wrong.
+package main
+
+import (
+	stdlog "log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+	"github.com/op/go-logging"
+	flag "github.com/spf13/pflag"
+)
+
+// countingTarget counts how many times it was reconfigured.
+type countingTarget struct {
+	calls	int
+}
+
+func (c *countingTarget) Reconfigure(options ...gosl.HandlerOption) {
+	c.calls++
+}
+
+// reloadSetup starts from the defaults (but logging everything), and captures the log; it returns the configuration file, and the log messages so far.
+func reloadSetup(t *testing.T) (string, func() []string) {
+	t.Helper()
+	defaults, defaultLevels, defaultCommandLine := goslConfig, logLevels, commandLine
+	t.Cleanup(func() {
+		goslConfig, logLevels, commandLine = defaults, defaultLevels, defaultCommandLine
+		logging.SetBackend(logging.NewLogBackend(os.Stderr, "", stdlog.LstdFlags)) // go-logging's own default.
+	})
+	memory := logging.NewMemoryBackend(100)
+	logLevels = logging.AddModuleLevel(memory)
+	logging.SetBackend(logLevels)
+	commandLine = nil
+
+	goslConfig = goslConfigOptions{}
+	if _, err := readConfiguration(configFile(t, ""), &goslConfig); err != nil {
+		t.Fatal(err)
+	}
+	goslConfig.logLevel = "DEBUG" // so that the warnings get logged.
+	checkErr(setLogLevel(goslConfig.logLevel))
+	messages := func() []string {
+		var lines []string
+		for node := memory.Head(); node != nil; node = node.Next() {
+			lines = append(lines, strings.TrimSpace(node.Record.Message()))
+		}
+		return lines
+	}
+	return filepath.Join(t.TempDir(), "config.ini"), messages
+}
+
+func writeConfig(t *testing.T, filename, contents string) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfiguration(t *testing.T) {
+	filename, messages := reloadSetup(t)
+	writeConfig(t, filename, "[config]\nmyPort = 4000\n\n[options]\nadminToken = s3cr3t\n\n[log]\nlogLevel = WARNING\n")
+	target := new(countingTarget)
+	if err := reloadConfiguration(filename, []gosl.Reconfigurable{target}); err != nil {
+		t.Fatal(err)
+	}
+	if goslConfig.logLevel != "WARNING" || goslConfig.adminToken != "s3cr3t" || logLevels.GetLevel("gosl") != logging.WARNING {
+		t.Errorf("after reloading, log level %q (%v), admin token %q", goslConfig.logLevel, logLevels.GetLevel("gosl"), goslConfig.adminToken)
+	}
+	if goslConfig.myPort != "3000" {
+		t.Errorf("the port changed to %q without a restart", goslConfig.myPort)
+	}
+	if target.calls != 1 {
+		t.Errorf("the target was reconfigured %d times", target.calls)
+	}
+	want := "config.myPort changed from 3000 to 4000, but that needs a restart"
+	if log := messages(); !strings.Contains(strings.Join(log, "\n"), want) {
+		t.Errorf("the log does not say %q:\n%s", want, strings.Join(log, "\n"))
+	}
+}
+
+func TestReloadConfigurationRejected(t *testing.T) {
+	filename, _ := reloadSetup(t)
+	before := goslConfig
+	// A good admin token, but a bad log level: none of it is used.
+	writeConfig(t, filename, "[options]\nadminToken = s3cr3t\n\n[log]\nlogLevel = LOUD\n")
+	target := new(countingTarget)
+	if err := reloadConfiguration(filename, []gosl.Reconfigurable{target}); err == nil || !strings.Contains(err.Error(), "log.logLevel") {
+		t.Errorf("reloadConfiguration() = %v, want an error about log.logLevel", err)
+	}
+	if goslConfig != before || target.calls != 0 {
+		t.Errorf("a rejected configuration was applied: admin token %q, log level %q, %d calls", goslConfig.adminToken, goslConfig.logLevel, target.calls)
+	}
+	// Nor is anything from a file which cannot be read.
+	writeConfig(t, filename, "[options\nadminToken = s3cr3t\n")
+	if err := reloadConfiguration(filename, []gosl.Reconfigurable{target}); err == nil || goslConfig != before || target.calls != 0 {
+		t.Errorf("reloadConfiguration() of a broken file = %v, and admin token %q", err, goslConfig.adminToken)
+	}
+}
+
+func TestReloadConfigurationFlags(t *testing.T) {
+	filename, messages := reloadSetup(t)
+	commandLine = flag.NewFlagSet("serve", flag.ContinueOnError)
+	commandLine.String("debug", "", "")
+	commandLine.String("port", "", "")
+	checkErr(commandLine.Parse([]string{"--debug", "DEBUG", "--port", "3000"}))
+	writeConfig(t, filename, "[config]\nmyPort = 4000\n\n[log]\nlogLevel = WARNING\n")
+	if err := reloadConfiguration(filename, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Flags win over the file, when reloading as when starting.
+	if goslConfig.logLevel != "DEBUG" {
+		t.Errorf("the file changed the log level set by --debug to %q", goslConfig.logLevel)
+	}
+	for _, line := range messages() {
+		if strings.Contains(line, "config.myPort") {
+			t.Errorf("the port set by --port is reported as changed: %s", line)
+		}
+	}
+}
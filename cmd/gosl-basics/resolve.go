@@ -0,0 +1,192 @@
+// Non-interactive batch resolver: reads a list of avatar names and/or UUIDs (say, a column of a
+// spreadsheet exported as CSV), looks each one up, and writes the results as CSV or JSON Lines.
+// The exit code tells scripts whether everything was found.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+)
+
+// Exit codes for resolve, similar to grep's.
+const (
+	resolveAllFound	exitCode = 0	// every name/UUID was found.
+	resolveMisses	exitCode = 1	// at least one was not found.
+	resolveFailed	exitCode = 2	// something went wrong, e.g. the input could not be read; the output is incomplete.
+)
+
+// resolveResult is one line of output; for JSON Lines, it's the same as what /api/v1/lookup returns for each item.
+type resolveResult struct {
+	Query	string	`json:"query"`
+	Found	bool	`json:"found"`
+	gosl.AvatarUUID
+}
+
+// runResolve resolves everything in the file given as its argument, and returns the exit code
+// (even when it is 0). resolve is not chatty, so the log only goes to the log file; whatever makes
+// it fail is printed to stderr as well (see resolveFail).
+func runResolve(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: resolve <file>, or - for stdin")
+	}
+	// Everything that can go wrong is checked before the output file is created, since that truncates it.
+	if err := checkResolveFormat(goslConfig.resolveFormat); err != nil {
+		return resolveFail(err)
+	}
+	if goslConfig.resolveColumn < 0 {
+		return resolveFail(fmt.Errorf("invalid column %d", goslConfig.resolveColumn))
+	}
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return resolveFail(fmt.Errorf("cannot read names/UUIDs to resolve: %w", err))
+		}
+		defer f.Close()
+		in = f
+	}
+	store, err := openStore()
+	if err != nil {
+		return resolveFail(err)
+	}
+	defer func() {
+		checkErr(store.Close())
+	}()
+	out := os.Stdout
+	if goslConfig.resolveOutput != "" && goslConfig.resolveOutput != "-" {
+		if out, err = os.Create(goslConfig.resolveOutput); err != nil {
+			return resolveFail(fmt.Errorf("cannot write results: %w", err))
+		}
+	}
+	bw := bufio.NewWriter(out)
+	writeResult, err := resolveWriter(bw, goslConfig.resolveFormat)
+	if err != nil {
+		if out != os.Stdout {
+			out.Close()
+		}
+		return resolveFail(err)
+	}
+
+	var total, misses int
+	err = readQueries(in, goslConfig.resolveColumn, goslConfig.resolveHeader, func(query string) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		result := resolveResult{Query: query}
+		record, err := store.Lookup(query)
+		switch {
+		case err == nil:
+			result.Found, result.AvatarUUID = true, record
+		case errors.Is(err, gosl.ErrNotFound):
+			misses++
+		default:
+			return fmt.Errorf("could not look up %q: %w", query, err)
+		}
+		total++
+		return writeResult(result)
+	})
+	if flushErr := bw.Flush(); err == nil {
+		err = flushErr
+	}
+	if out != os.Stdout {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr // on some filesystems, this is the only place where we find out that the disk is full.
+		}
+	}
+	if err != nil {
+		return resolveFail(fmt.Errorf("resolving stopped after %d entries: %w", total, err))
+	}
+	log.Infof("resolved %d entries, %d not found\n", total, misses)
+	if misses > 0 {
+		return resolveMisses
+	}
+	return resolveAllFound
+}
+
+// resolveFail logs why resolve could not finish, and tells whoever is running it, too.
+func resolveFail(err error) error {
+	log.Error(err)
+	fmt.Fprintf(os.Stderr, "%s resolve: %v\n", programName, err)
+	return resolveFailed
+}
+
+// readQueries calls fn for each non-empty name/UUID in the input: whole lines if column is 0,
+// otherwise that (1-based) column of a CSV file. If header is set, the first line is skipped.
+func readQueries(in io.Reader, column int, header bool, fn func(query string) error) error {
+	if column < 0 {
+		return fmt.Errorf("invalid column %d", column)
+	}
+	if column == 0 {
+		scanner := bufio.NewScanner(in)
+		for first := true; scanner.Scan(); first = false {
+			if first && header {
+				continue
+			}
+			if query := strings.TrimSpace(scanner.Text()); query != "" {
+				if err := fn(query); err != nil {
+					return err
+				}
+			}
+		}
+		return scanner.Err()
+	}
+	cr := csv.NewReader(in)
+	cr.FieldsPerRecord = -1 // spreadsheets are not always tidy.
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if (first && header) || len(record) < column {
+			continue
+		}
+		if query := strings.TrimSpace(record[column-1]); query != "" {
+			if err := fn(query); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkResolveFormat returns an error unless resolveWriter knows about format.
+func checkResolveFormat(format string) error {
+	switch strings.ToLower(format) {
+	case "csv", "", "jsonl", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, it should be either \"csv\" or \"jsonl\"", format)
+}
+
+// resolveWriter returns a function which writes each result in the requested format.
+func resolveWriter(w io.Writer, format string) (func(resolveResult) error, error) {
+	switch strings.ToLower(format) {
+	case "csv", "":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"query", "found", "name", "key", "grid"}); err != nil {
+			return nil, err
+		}
+		return func(result resolveResult) error {
+			cw.Write([]string{result.Query, strconv.FormatBool(result.Found), result.AvatarName, result.UUID, result.Grid})
+			cw.Flush()
+			return cw.Error()
+		}, nil
+	case "jsonl", "json":
+		encoder := json.NewEncoder(w)
+		return func(result resolveResult) error {
+			return encoder.Encode(result)
+		}, nil
+	}
+	return nil, checkResolveFormat(format)
+}
@@ -0,0 +1,56 @@
+// Checks which names and UUIDs are read from a file to resolve, as plain lines or from a CSV column.
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadQueries(t *testing.T) {
+	const lines = "Name\n  Resident One \n\na2e76fcd-9360-4f6d-a924-000000000002\n"
+	const csv = "uuid,name,grid\n" +
+		"a2e76fcd-9360-4f6d-a924-000000000001,Resident One,Production\n" +
+		"a2e76fcd-9360-4f6d-a924-000000000002\n" + // too short for the second column.
+		"a2e76fcd-9360-4f6d-a924-000000000003,\"Resident, Three\"\n" +
+		"a2e76fcd-9360-4f6d-a924-000000000004,  ,Production\n"
+	for _, test := range []struct {
+		input	string
+		column	int
+		header	bool
+		want	[]string
+	}{
+		{lines, 0, false, []string{"Name", "Resident One", "a2e76fcd-9360-4f6d-a924-000000000002"}},
+		{lines, 0, true, []string{"Resident One", "a2e76fcd-9360-4f6d-a924-000000000002"}},
+		{csv, 2, true, []string{"Resident One", "Resident, Three"}},
+		{csv, 1, false, []string{"uuid", "a2e76fcd-9360-4f6d-a924-000000000001", "a2e76fcd-9360-4f6d-a924-000000000002",
+			"a2e76fcd-9360-4f6d-a924-000000000003", "a2e76fcd-9360-4f6d-a924-000000000004"}},
+		{csv, 4, false, nil},
+	} {
+		var got []string
+		err := readQueries(strings.NewReader(test.input), test.column, test.header, func(query string) error {
+			got = append(got, query)
+			return nil
+		})
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("readQueries(column %d, header %v) = %q, %v; want %q", test.column, test.header, got, err, test.want)
+		}
+	}
+
+	if err := readQueries(strings.NewReader(lines), -1, false, func(string) error { return nil }); err == nil {
+		t.Error("readQueries() accepted column -1")
+	}
+	if err := readQueries(strings.NewReader("a,\"b\nc"), 1, false, func(string) error { return nil }); err == nil {
+		t.Error("readQueries() accepted a broken CSV file")
+	}
+	// An error from fn stops the reading.
+	stop, calls := errors.New("stop"), 0
+	err := readQueries(strings.NewReader(lines), 0, false, func(string) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("readQueries() = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
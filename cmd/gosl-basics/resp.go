@@ -0,0 +1,43 @@
+// Optional Redis-protocol listener, next to the standalone HTTP server, for bots and scripts which
+// already speak Redis. It uses the same store as the HTTP handlers, and the same TLS certificates, if any.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+)
+
+// serveRESP listens on goslConfig.respListen until the context is cancelled; commands which are
+// already running get up to shutdownTimeout to finish, and idle clients are disconnected at once.
+// It returns the server, so that it can be reconfigured, and an error only if it could not start at all.
+func serveRESP(ctx context.Context, store *gosl.Store, tlsConfig *tls.Config) (*gosl.RESPServer, error) {
+	listener, err := listenOn(goslConfig.respListen)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	respServer := gosl.NewRESPServer(store, handlerOptions()...)
+	log.Info("starting to run Redis-protocol service on", listener.Addr())
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), goslConfig.shutdownTimeout)
+		defer cancel()
+		if err := respServer.Shutdown(shutdownCtx); err != nil {
+			log.Warningf("Redis-protocol clients were still busy after %v\n", goslConfig.shutdownTimeout)
+		} else {
+			log.Debug("all Redis-protocol clients disconnected")
+		}
+	}()
+	go func() {
+		if err := respServer.Serve(listener); err != nil && !errors.Is(err, gosl.ErrRESPServerClosed) {
+			log.Error("Redis-protocol server stopped:", err)
+		}
+	}()
+	return respServer, nil
+}
@@ -0,0 +1,368 @@
+// Interactive shell, for day-to-day administration of the database.
+// It started as a way to test lookups, and a bare name or UUID still does just that;
+// a line is only a command (type `help` to see them all) if it starts with one, in lower case,
+// and the rest fits the command, so that looking up e.g. `Export Resident` does not export anything.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+	"gitlab.com/cznic/readline"
+)
+
+// maxShellMatches limits how many entries `prefix` lists and how many names tab completion offers,
+// so that a careless `prefix a` does not dump a few million lines on the terminal.
+const maxShellMatches = 50
+
+// shell keeps everything the commands need.
+type shell struct {
+	ctx			context.Context
+	store		*gosl.Store
+	rl			*readline.Instance
+	historyFile	string	// empty if there is no place to keep it.
+}
+
+// shellCommand is one of the commands the shell understands; run gets everything after the command name,
+// if fits says that it looks like what the command expects (otherwise, the whole line is looked up).
+type shellCommand struct {
+	name	string
+	usage	string
+	help	string
+	fits	func(args string) bool
+	run		func(sh *shell, args string) error
+}
+
+// shellCommands is a slice, and not a map, so that `help` lists them in a sensible order.
+// It gets filled in init(), since `help` needs to refer to it.
+var shellCommands []shellCommand
+
+func init() {
+	shellCommands = []shellCommand{
+		{"get", "get <name or UUID>", "look up an avatar (just typing the name or UUID does the same, unless it starts with a command)", someArgs, (*shell).get},
+		{"add", "add <name> <UUID> [grid]", "add or replace an avatar (grid defaults to Production)", func(args string) bool {
+			_, ok := parseShellAdd(args)
+			return ok
+		}, (*shell).add},
+		{"del", "del <name or UUID>", "delete an avatar, both under its name and its UUID", someArgs, (*shell).del},
+		{"prefix", "prefix <text>", fmt.Sprintf("list up to %d avatars whose name or UUID starts with text", maxShellMatches), someArgs, (*shell).prefix},
+		{"history", "history [n]", "show the last n commands (default 20)", func(args string) bool {
+			n, err := strconv.Atoi(args)
+			return args == "" || (err == nil && n > 0)
+		}, (*shell).history},
+		{"stats", "stats", "show what the database has been doing since it was opened", noArgs, (*shell).stats},
+		{"import", "import <file>", "import a CSV file (plain, gzip'ed or bzip2'ed) with UUID,name[,grid]", someArgs, (*shell).importFile},
+		{"export", "export <file>", "export the whole database as CSV (gzip'ed if the file name ends in .gz)", someArgs, (*shell).exportFile},
+		{"help", "help", "show this list", noArgs, (*shell).help},
+		{"quit", "quit", "leave the shell (so do exit, Ctrl-C and Ctrl-D)", noArgs, nil},
+	}
+}
+
+func noArgs(args string) bool {
+	return args == ""
+}
+
+func someArgs(args string) bool {
+	return args != ""
+}
+
+// runShell reads commands until the user quits, or the context is cancelled.
+func runShell(ctx context.Context, store *gosl.Store) error {
+	sh := &shell{ctx: ctx, store: store, historyFile: shellHistoryFile()}
+	var err error
+	sh.rl, err = readline.NewEx(&readline.Config{
+		Prompt:				"gosl> ",
+		HistoryFile:		sh.historyFile,
+		HistoryLimit:		1000,
+		AutoComplete:		&shellCompleter{store: store},
+		InterruptPrompt:	"^C",
+		EOFPrompt:			"quit",
+	})
+	if err != nil {
+		return err
+	}
+	defer sh.rl.Close()
+	// SIGTERM while waiting for input: closing readline makes Readline() return.
+	go func() {
+		<-ctx.Done()
+		sh.rl.Close()
+	}()
+
+	fmt.Println("Type \"help\" for a list of commands, and \"quit\" (or Ctrl-C, or Ctrl-D) to leave.")
+	for {
+		line, err := sh.rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) && line != "" {
+			continue // Ctrl-C with something typed just clears the line; on an empty line, it quits, as it always did.
+		} else if err != nil { // io.EOF, or Ctrl-C
+			return nil
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		command, args := parseShellLine(line)
+		if command.run == nil { // quit
+			return nil
+		}
+		if err := command.run(sh, args); err != nil {
+			fmt.Println("error:", err)
+		}
+	}
+}
+
+// parseShellLine returns the command for a (non-empty) line, and its arguments. Anything which is not
+// a command, or does not fit it, is assumed to be a name or UUID, like the shell always did.
+func parseShellLine(line string) (*shellCommand, string) {
+	name, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+	if command := findShellCommand(name); command != nil && command.fits(args) {
+		return command, args
+	}
+	return findShellCommand("get"), line
+}
+
+// findShellCommand returns the command with this name (which is case-sensitive), or nil. "exit" is also accepted for "quit".
+func findShellCommand(name string) *shellCommand {
+	if name == "exit" {
+		name = "quit"
+	}
+	for i := range shellCommands {
+		if shellCommands[i].name == name {
+			return &shellCommands[i]
+		}
+	}
+	return nil
+}
+
+// shellHistoryFile returns where to keep the command history (~/.config/gosl/history),
+// creating the directory if needed; or the empty string, which disables saving it.
+func shellHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Warning("no home directory, command history will not be saved:", err)
+		return ""
+	}
+	dir := filepath.Join(home, ".config", "gosl")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Warning("command history will not be saved:", err)
+		return ""
+	}
+	return filepath.Join(dir, "history")
+}
+
+// printAvatar prints a record the way the shell always did.
+func printAvatar(record gosl.AvatarUUID) {
+	fmt.Println(record.AvatarName, "which has UUID:", record.UUID, "comes from grid:", record.Grid)
+}
+
+func (sh *shell) get(args string) error {
+	if args == "" {
+		return errors.New("usage: get <name or UUID>")
+	}
+	record, err := sh.store.Lookup(args)
+	if errors.Is(err, gosl.ErrNotFound) {
+		fmt.Println("sorry, unknown input", args)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	printAvatar(record)
+	return nil
+}
+
+// parseShellAdd takes the name (which usually has a space in it) to be everything before the UUID,
+// and the grid to be everything after it; ok is false if there is no name, or no UUID.
+func parseShellAdd(args string) (record gosl.AvatarUUID, ok bool) {
+	fields := strings.Fields(args)
+	for i, field := range fields {
+		if !gosl.IsValidUUID(field) {
+			continue
+		}
+		record = gosl.AvatarUUID{
+			AvatarName:	strings.Join(fields[:i], " "),
+			UUID:		field,
+			Grid:		strings.Join(fields[i+1:], " "),
+		}
+		if record.Grid == "" {
+			record.Grid = "Production"
+		}
+		return record, record.AvatarName != ""
+	}
+	return record, false
+}
+
+func (sh *shell) add(args string) error {
+	record, ok := parseShellAdd(args)
+	if !ok {
+		return errors.New("usage: add <name> <UUID> [grid]")
+	}
+	// Like the REST API, if the avatar changed names, the old name goes away.
+	if old, err := sh.store.Lookup(record.UUID); err == nil && old.AvatarName != record.AvatarName {
+		if err := sh.store.Delete(gosl.AvatarUUID{AvatarName: old.AvatarName}); err != nil {
+			return err
+		}
+		fmt.Printf("(was %q)\n", old.AvatarName)
+	}
+	if err := sh.store.Insert(record); err != nil {
+		return err
+	}
+	printAvatar(record)
+	return nil
+}
+
+func (sh *shell) del(args string) error {
+	if args == "" {
+		return errors.New("usage: del <name or UUID>")
+	}
+	record, err := sh.store.Lookup(args)
+	if errors.Is(err, gosl.ErrNotFound) {
+		fmt.Println("sorry, unknown input", args)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := sh.store.Delete(record); err != nil {
+		return err
+	}
+	fmt.Println("deleted", record.AvatarName, "with UUID", record.UUID)
+	return nil
+}
+
+// prefix lists each avatar only once, even if both its name and UUID match.
+func (sh *shell) prefix(args string) error {
+	if args == "" {
+		return errors.New("usage: prefix <text>")
+	}
+	seen := make(map[string]bool)
+	more := false
+	err := sh.store.Scan(args, func(key string, record gosl.AvatarUUID) bool {
+		if seen[record.UUID] {
+			return true
+		}
+		if len(seen) == maxShellMatches {
+			more = true
+			return false
+		}
+		seen[record.UUID] = true
+		printAvatar(record)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case more:
+		fmt.Printf("... and more; only the first %d are shown.\n", maxShellMatches)
+	case len(seen) == 0:
+		fmt.Println("nothing starts with", args)
+	}
+	return nil
+}
+
+// history reads the history file, since readline does not let us look at its own copy.
+func (sh *shell) history(args string) error {
+	n := 20
+	if args != "" {
+		var err error
+		if n, err = strconv.Atoi(args); err != nil || n <= 0 {
+			return errors.New("usage: history [n]")
+		}
+	}
+	if sh.historyFile == "" {
+		return errors.New("command history is not being saved")
+	}
+	f, err := os.Open(sh.historyFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	start := max(len(lines) - n, 0)
+	for i := start; i < len(lines); i++ {
+		fmt.Printf("%5d  %s\n", i+1, lines[i])
+	}
+	return scanner.Err()
+}
+
+func (sh *shell) stats(args string) error {
+	printStats(sh.store.Stats())
+	return nil
+}
+
+func (sh *shell) importFile(args string) error {
+	if args == "" {
+		return errors.New("usage: import <file>")
+	}
+	start := time.Now()
+	count, err := sh.store.Import(sh.ctx, args)
+	fmt.Printf("imported %d records in %v\n", count, time.Since(start).Round(time.Millisecond))
+	return err
+}
+
+func (sh *shell) exportFile(args string) error {
+	if args == "" {
+		return errors.New("usage: export <file>")
+	}
+	count, err := exportTo(sh.ctx, sh.store, args)
+	fmt.Printf("exported %d records to %s\n", count, args)
+	return err
+}
+
+func (sh *shell) help(args string) error {
+	for _, command := range shellCommands {
+		fmt.Printf("  %-26s %s\n", command.usage, command.help)
+	}
+	fmt.Println("Commands are in lower case. Anything else is looked up as a name or UUID; so is a line which starts")
+	fmt.Println("with a command but does not fit it. To look up a name which does fit one, such as \"del Resident\", use get.")
+	return nil
+}
+
+// shellCompleter completes command names and, for the commands which take one, avatar names (and UUIDs).
+type shellCompleter struct {
+	store	*gosl.Store
+}
+
+// Do is called by readline on Tab; it returns the possible endings for what was typed so far,
+// and how many runes of it they share.
+func (c *shellCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	typed := strings.TrimLeft(string(line[:pos]), " ")
+	name, args, hasArgs := strings.Cut(typed, " ")
+	var candidates [][]rune
+	if !hasArgs {
+		for _, command := range shellCommands {
+			if strings.HasPrefix(command.name, name) {
+				candidates = append(candidates, []rune(command.name[len(name):] + " "))
+			}
+		}
+		return candidates, len([]rune(name))
+	}
+	switch name {
+	case "get", "del", "prefix":
+	default:
+		return nil, 0
+	}
+	args = strings.TrimLeft(args, " ")
+	if args == "" {
+		return nil, 0 // we are not going to offer the whole database.
+	}
+	// Both names and UUIDs are keys, so this completes either.
+	c.store.Scan(args, func(key string, _ gosl.AvatarUUID) bool {
+		candidates = append(candidates, []rune(key[len(args):]))
+		return len(candidates) < maxShellMatches
+	})
+	return candidates, len([]rune(args))
+}
@@ -0,0 +1,193 @@
+// Checks which lines are shell commands, the commands themselves, and tab completion, on a memory database.
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics"
+)
+
+// newTestShell returns a shell without a terminal, nor a history, on an empty memory database.
+func newTestShell(t *testing.T) *shell {
+	t.Helper()
+	config := gosl.DefaultConfig()
+	config.Database, config.Dir, config.BloomCapacity = "memory", t.TempDir(), 1000
+	store, err := gosl.Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return &shell{ctx: context.Background(), store: store}
+}
+
+func TestFindShellCommand(t *testing.T) {
+	for name, want := range map[string]string{
+		"get":		"get",
+		"DEL":		"",
+		"Export":	"",
+		"exit":		"quit",
+		"quit":		"quit",
+		"lookup":	"",
+		"":			"",
+	} {
+		got := ""
+		if command := findShellCommand(name); command != nil {
+			got = command.name
+		}
+		if got != want {
+			t.Errorf("findShellCommand(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// Only lines which start with a command in lower case, and fit it, are commands; anything else is a lookup.
+func TestParseShellLine(t *testing.T) {
+	const key = "a2e76fcd-9360-4f6d-a924-000000000001"
+	for _, test := range []struct {
+		line, command, args string
+	}{
+		{"Resident One", "get", "Resident One"},
+		{"get Resident One", "get", "Resident One"},
+		{"get  del Resident", "get", "del Resident"},
+		{"get", "get", "get"},
+		{"export avatars.csv.gz", "export", "avatars.csv.gz"},
+		{"Export Resident", "get", "Export Resident"},
+		{"Delete Resident", "get", "Delete Resident"},
+		{"del Resident", "del", "Resident"},
+		{"quit", "quit", ""},
+		{"exit", "quit", ""},
+		{"Quit Resident", "get", "Quit Resident"},
+		{"quit Resident", "get", "quit Resident"},
+		{"stats Resident", "get", "stats Resident"},
+		{"history", "history", ""},
+		{"history 5", "history", "5"},
+		{"history Resident", "get", "history Resident"},
+		{"add Resident One " + key, "add", "Resident One " + key},
+		{"add Resident One", "get", "add Resident One"},
+		{"add " + key, "get", "add " + key},
+	} {
+		command, args := parseShellLine(test.line)
+		if command.name != test.command || args != test.args {
+			t.Errorf("parseShellLine(%q) = %s %q, want %s %q", test.line, command.name, args, test.command, test.args)
+		}
+	}
+}
+
+func TestShellCommands(t *testing.T) {
+	sh := newTestShell(t)
+	const key = "a2e76fcd-9360-4f6d-a924-000000000001"
+	lookup := func(query string) gosl.AvatarUUID {
+		t.Helper()
+		record, err := sh.store.Lookup(query)
+		if err != nil && !errors.Is(err, gosl.ErrNotFound) {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	for _, args := range []string{"", "Resident One", key, key + " Production"} {
+		if err := sh.add(args); err == nil {
+			t.Errorf("add(%q) worked", args)
+		}
+	}
+	// The name is everything before the UUID, and the grid everything after it.
+	if err := sh.add("Resident One " + key + " OSGrid Beta"); err != nil {
+		t.Fatal(err)
+	}
+	if record := lookup("Resident One"); record != (gosl.AvatarUUID{AvatarName: "Resident One", UUID: key, Grid: "OSGrid Beta"}) {
+		t.Errorf("after add, Lookup() = %+v", record)
+	}
+	// A new name for the same UUID replaces the old one.
+	if err := sh.add("Resident Renamed " + key); err != nil {
+		t.Fatal(err)
+	}
+	if record := lookup(key); record != (gosl.AvatarUUID{AvatarName: "Resident Renamed", UUID: key, Grid: "Production"}) {
+		t.Errorf("after renaming, Lookup() = %+v", record)
+	}
+	if record := lookup("Resident One"); record.AvatarName != "" {
+		t.Errorf("the old name is still there: %+v", record)
+	}
+	for _, run := range []func(string) error{sh.get, sh.prefix} {
+		if err := run("Resident"); err != nil {
+			t.Error(err)
+		}
+		if err := run(""); err == nil {
+			t.Error("a command worked without arguments")
+		}
+	}
+
+	if err := sh.del("Resident Renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if record := lookup(key); record.AvatarName != "" {
+		t.Errorf("after del, Lookup() = %+v", record)
+	}
+	if err := sh.del("Resident Renamed"); err != nil {
+		t.Errorf("del() of something which is not there = %v", err)
+	}
+	if err := sh.history(""); err == nil {
+		t.Error("history() worked without a history file")
+	}
+}
+
+func TestShellExportImport(t *testing.T) {
+	sh := newTestShell(t)
+	for _, args := range []string{
+		"Resident One a2e76fcd-9360-4f6d-a924-000000000001",
+		"Resident Two a2e76fcd-9360-4f6d-a924-000000000002 OSGrid",
+	} {
+		if err := sh.add(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filename := filepath.Join(t.TempDir(), "avatars.csv.gz")
+	if err := sh.exportFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	other := newTestShell(t)
+	if err := other.importFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if record, err := other.store.Lookup("Resident Two"); err != nil || record.Grid != "OSGrid" {
+		t.Errorf("after import, Lookup() = %+v, %v", record, err)
+	}
+}
+
+func TestShellCompleter(t *testing.T) {
+	sh := newTestShell(t)
+	for _, args := range []string{
+		"Resident One a2e76fcd-9360-4f6d-a924-000000000001",
+		"Resident Two a2e76fcd-9360-4f6d-a924-000000000002",
+		"Someone Else a2e76fcd-9360-4f6d-a924-000000000003",
+	} {
+		if err := sh.add(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	completer := &shellCompleter{store: sh.store}
+	for _, test := range []struct {
+		line	string
+		want	[]string
+		length	int
+	}{
+		{"he", []string{"lp "}, 2},
+		{"  h", []string{"istory ", "elp "}, 1}, // in the order of help.
+		{"get Resident ", []string{"One", "Two"}, 9},
+		{"prefix Some", []string{"one Else"}, 4},
+		{"get ", nil, 0},
+		{"stats Res", nil, 0},
+	} {
+		candidates, length := completer.Do([]rune(test.line), len([]rune(test.line)))
+		var got []string
+		for _, candidate := range candidates {
+			got = append(got, string(candidate))
+		}
+		if !slices.Equal(got, test.want) || length != test.length {
+			t.Errorf("Do(%q) = %q, %d; want %q, %d", test.line, got, length, test.want, test.length)
+		}
+	}
+}
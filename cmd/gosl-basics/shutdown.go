@@ -0,0 +1,149 @@
+// Graceful shutdown: systemd (see startup-scripts/gosl-name2key.service) sends us a SIGTERM
+// when stopping the service, and Ctrl-C sends a SIGINT. Instead of just dying, we stop accepting
+// new requests, let the in-flight ones finish (up to `shutdownTimeout`), and close the database cleanly,
+// so that Badger does not need to go through a slow recovery on the next start.
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// shutdownContext returns a context that gets cancelled when we receive SIGINT or SIGTERM.
+func shutdownContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		log.Notice("received shutdown signal, winding down...")
+		sdNotify("STOPPING=1")
+	}()
+	return ctx, stop
+}
+
+// serveHTTP runs the standalone server on all listeners until the context is cancelled,
+// and then drains all in-flight requests before returning.
+func serveHTTP(ctx context.Context, srv *http.Server, listeners []net.Listener) error {
+	errChan := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() {
+			if srv.TLSConfig != nil {
+				errChan <- srv.ServeTLS(l, "", "") // certificates come from TLSConfig.GetCertificate.
+				return
+			}
+			errChan <- srv.Serve(l)
+		}()
+	}
+	sdNotify("READY=1")
+	select {
+	case err := <-errChan:
+		// Could not even start listening (or died for some other reason).
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), goslConfig.shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Warningf("in-flight requests did not finish within %v: %v\n", goslConfig.shutdownTimeout, err)
+		return nil	// we're shutting down anyway, no reason to panic.
+	}
+	log.Debug("all in-flight HTTP requests finished")
+	return nil
+}
+
+// requestTracker counts the requests being handled, so that we can wait for them to finish.
+// A sync.WaitGroup won't do, since requests which fcgi.Serve had already accepted may only reach the
+// handler (and Add to the count) while we are already waiting; here, those are turned away instead.
+type requestTracker struct {
+	mutex	sync.Mutex
+	active	int
+	closing	bool
+	idle	chan struct{}	// closed once closing and no request is active.
+}
+
+func newRequestTracker() *requestTracker {
+	return &requestTracker{idle: make(chan struct{})}
+}
+
+// start counts a new request; it returns false if we are shutting down, and the request must not be handled.
+func (t *requestTracker) start() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closing {
+		return false
+	}
+	t.active++
+	return true
+}
+
+// done is called when a request that was started has finished.
+func (t *requestTracker) done() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.active--
+	if t.closing && t.active == 0 {
+		close(t.idle)
+	}
+}
+
+// drain turns away all new requests, and returns a channel which is closed once the active ones have finished.
+func (t *requestTracker) drain() <-chan struct{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.closing {
+		t.closing = true
+		if t.active == 0 {
+			close(t.idle)
+		}
+	}
+	return t.idle
+}
+
+// serveFastCGI is like fcgi.Serve(listener, handler) for all listeners, but it stops accepting connections
+// when the context is cancelled, and waits for the in-flight requests to finish.
+// The fcgi package has no Shutdown() of its own, so we keep count of the requests ourselves.
+func serveFastCGI(ctx context.Context, handler http.Handler, listeners []net.Listener) error {
+	inFlight := newRequestTracker()
+	tracked := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !inFlight.start() {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer inFlight.done()
+		handler.ServeHTTP(w, r)
+	})
+
+	errChan := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() {
+			errChan <- fcgi.Serve(l, tracked)
+		}()
+	}
+	sdNotify("READY=1")
+	select {
+	case err := <-errChan:
+		// not a shutdown, something went wrong.
+		return err
+	case <-ctx.Done():
+	}
+	for _, l := range listeners {
+		if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) { // makes fcgi.Serve() return.
+			log.Debugf("closing FastCGI listener %v returned %v\n", l.Addr(), err)
+		}
+	}
+
+	select {
+	case <-inFlight.drain():
+		log.Debug("all in-flight FastCGI requests finished")
+	case <-time.After(goslConfig.shutdownTimeout):
+		log.Warningf("in-flight FastCGI requests did not finish within %v\n", goslConfig.shutdownTimeout)
+	}
+	return nil
+}
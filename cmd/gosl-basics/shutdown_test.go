@@ -0,0 +1,147 @@
+// Checks that shutting down waits for the requests which are still being handled.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fcgiRecord writes one FastCGI record (see the FastCGI specification, section 3.3) for request 1.
+func fcgiRecord(w io.Writer, recordType byte, content []byte) error {
+	header := []byte{1, recordType, 0, 1, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(header[4:], uint16(len(content)))
+	_, err := w.Write(append(header, content...))
+	return err
+}
+
+// fcgiGet sends a GET for path over conn, as a web server would, and returns whatever the application wrote to stdout.
+func fcgiGet(conn net.Conn, path string) (string, error) {
+	const (
+		beginRequest	= 1
+		endRequest		= 3
+		params			= 4
+		stdin			= 5
+		stdout			= 6
+	)
+	var pairs []byte
+	for _, pair := range [][2]string{{"REQUEST_METHOD", "GET"}, {"SERVER_PROTOCOL", "HTTP/1.1"}, {"REQUEST_URI", path}} {
+		pairs = append(pairs, byte(len(pair[0])), byte(len(pair[1])))
+		pairs = append(pairs, pair[0]+pair[1]...)
+	}
+	for _, record := range []struct {
+		recordType byte
+		content    []byte
+	}{
+		{beginRequest, []byte{0, 1, 0, 0, 0, 0, 0, 0}}, // the responder role, and close the connection afterwards.
+		{params, pairs},
+		{params, nil},
+		{stdin, nil},
+	} {
+		if err := fcgiRecord(conn, record.recordType, record.content); err != nil {
+			return "", err
+		}
+	}
+	var output strings.Builder
+	br := bufio.NewReader(conn)
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(br, header); err != nil {
+			return output.String(), err
+		}
+		content := make([]byte, int(binary.BigEndian.Uint16(header[4:]))+int(header[6]))
+		if _, err := io.ReadFull(br, content); err != nil {
+			return output.String(), err
+		}
+		switch header[1] {
+		case stdout:
+			output.Write(content[:binary.BigEndian.Uint16(header[4:])])
+		case endRequest:
+			return output.String(), nil
+		}
+	}
+}
+
+func TestServeFastCGIWaitsForSlowRequests(t *testing.T) {
+	goslConfig.shutdownTimeout = 10 * time.Second
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("finished"))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- serveFastCGI(ctx, handler, []net.Listener{listener}) }()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	replied := make(chan string, 1)
+	go func() {
+		output, err := fcgiGet(conn, "/slow")
+		if err != nil {
+			t.Errorf("FastCGI request: %v", err)
+		}
+		replied <- output
+	}()
+	<-started
+
+	cancel()
+	select {
+	case err := <-served:
+		t.Fatalf("serveFastCGI() returned %v while a request was still being handled", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	if output := <-replied; !strings.HasSuffix(output, "finished") {
+		t.Errorf("the slow request got %q", output)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serveFastCGI() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("serveFastCGI() did not return after the last request finished")
+	}
+}
+
+// Once draining has started, requests which had been accepted but had not started yet are turned away.
+func TestRequestTracker(t *testing.T) {
+	tracker := newRequestTracker()
+	if !tracker.start() {
+		t.Fatal("start() refused a request before draining")
+	}
+	idle := tracker.drain()
+	if tracker.start() {
+		t.Error("start() accepted a request while draining")
+	}
+	select {
+	case <-idle:
+		t.Fatal("drained while a request was still active")
+	default:
+	}
+	tracker.done()
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Error("not drained after the last request finished")
+	}
+	if tracker.drain() != idle {
+		t.Error("drain() called twice returned different channels")
+	}
+}
@@ -0,0 +1,68 @@
+// Minimal systemd integration: socket activation (LISTEN_FDS) and sd_notify().
+// Both protocols are simple enough that we do not need to pull in go-systemd for them;
+// see sd_listen_fds(3) and sd_notify(3) for the details.
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// sdListenFdsStart is the first file descriptor passed by systemd (after stdin, stdout and stderr).
+const sdListenFdsStart = 3
+
+// systemdListeners returns the listeners passed by systemd socket activation, if any.
+// The environment variables are unset afterwards, so that child processes do not inherit them.
+func systemdListeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("no sockets passed by systemd (LISTEN_PID is %q, we are %d)", os.Getenv("LISTEN_PID"), os.Getpid())
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds < 1 {
+		return nil, fmt.Errorf("no sockets passed by systemd (LISTEN_FDS is %q)", os.Getenv("LISTEN_FDS"))
+	}
+	listeners := make([]net.Listener, 0, nfds)
+	for fd := sdListenFdsStart; fd < sdListenFdsStart+nfds; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close() // net.FileListener dup()s the descriptor.
+		if err != nil {
+			return nil, fmt.Errorf("file descriptor %d passed by systemd is not a listening socket: %w", fd, err)
+		}
+		log.Debugf("got listener %v from systemd on fd %d\n", l.Addr(), fd)
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// sdNotify sends a state change (e.g. "READY=1" or "STOPPING=1") to systemd, for units with Type=notify.
+// If we were not started by systemd (no NOTIFY_SOCKET), it does nothing.
+func sdNotify(state string) {
+	socketAddr := os.Getenv("NOTIFY_SOCKET")
+	if socketAddr == "" {
+		return
+	}
+	if socketAddr[0] == '@' {
+		socketAddr = "\x00" + socketAddr[1:] // abstract namespace socket.
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketAddr, Net: "unixgram"})
+	if err != nil {
+		log.Errorf("could not connect to systemd notification socket: %v\n", err)
+		return
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		log.Errorf("could not notify systemd of %q: %v\n", state, err)
+		return
+	}
+	log.Debugf("notified systemd: %q\n", state)
+}
@@ -0,0 +1,159 @@
+// Optional TLS for the standalone server, so that we do not need nginx just to terminate HTTPS
+// (llHTTPRequest is perfectly happy with https URLs).
+// Certificates are reloaded whenever the files change on disk (e.g. after a certbot renewal),
+// without restarting and without dropping any connections: new handshakes simply get the new certificate.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// certReloader keeps the current certificate and swaps it when the files change.
+type certReloader struct {
+	certFile, keyFile string
+	mu                sync.RWMutex
+	cert              *tls.Certificate
+}
+
+// newCertReloader loads the certificate for the first time; this one *must* work.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// reload reads the certificate and key from disk again. If that fails (say, certbot is still
+// in the middle of writing them), we keep on using the old certificate.
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load TLS certificate %q / key %q: %w", cr.certFile, cr.keyFile, err)
+	}
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.mu.Unlock()
+	log.Infof("loaded TLS certificate from %q\n", cr.certFile)
+	return nil
+}
+
+// getCertificate is used as tls.Config.GetCertificate.
+func (cr *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// watch reloads the certificate whenever something changes in the directories where the
+// certificate and key are. We watch the directories and not the files themselves, because
+// certbot replaces symlinks (and editors replace files) instead of writing to them.
+func (cr *certReloader) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := map[string]bool{filepath.Dir(cr.certFile): true, filepath.Dir(cr.keyFile): true}
+	for dir := range dirs {
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+	go func() {
+		defer watcher.Close()
+		// Renewals usually touch several files in a row, so wait for things to settle down a bit.
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				log.Debugf("TLS certificate directory changed: %v\n", event)
+				debounce = time.After(time.Second)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("error while watching TLS certificate: %v\n", err)
+			case <-debounce:
+				debounce = nil
+				checkErr(cr.reload())
+			}
+		}
+	}()
+	return nil
+}
+
+// tlsVersions maps the configuration values to the crypto/tls constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// setupTLS returns the TLS configuration for the standalone server, or nil if TLS is not configured.
+func setupTLS(ctx context.Context) (*tls.Config, error) {
+	if goslConfig.tlsCertFile == "" && goslConfig.tlsKeyFile == "" {
+		return nil, nil
+	}
+	if goslConfig.tlsCertFile == "" || goslConfig.tlsKeyFile == "" {
+		return nil, fmt.Errorf("TLS needs both a certificate (%q) and a key (%q)", goslConfig.tlsCertFile, goslConfig.tlsKeyFile)
+	}
+	minVersion, ok := tlsVersions[goslConfig.tlsMinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unknown minimum TLS version %q, must be one of 1.0, 1.1, 1.2, 1.3", goslConfig.tlsMinVersion)
+	}
+	cr, err := newCertReloader(goslConfig.tlsCertFile, goslConfig.tlsKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if err = cr.watch(ctx); err != nil {
+		log.Warningf("cannot watch TLS certificate for changes, it will not be reloaded: %v\n", err)
+	}
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: cr.getCertificate,
+	}, nil
+}
+
+// serveRedirect runs a plain HTTP listener that redirects everything to HTTPS, until the context is cancelled.
+// httpsPort is the port the TLS server is listening on; it is omitted from the URL if it's 443.
+func serveRedirect(ctx context.Context, addr string, httpsPort string) {
+	srv := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = r.Host // no port on the Host: header.
+			}
+			if httpsPort != "" && httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		}),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), goslConfig.shutdownTimeout)
+		defer cancel()
+		checkErr(srv.Shutdown(shutdownCtx))
+	}()
+	log.Info("redirecting HTTP on", addr, "to HTTPS")
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("HTTP→HTTPS redirect listener on %q failed: %v\n", addr, err)
+	}
+}
@@ -0,0 +1,133 @@
+// Checks that TLS certificates are reloaded when they change on disk, and kept when the new ones are broken.
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate for name, and its key, the way certbot does:
+// to new files, which then replace the old ones.
+func writeCertificate(t *testing.T, certFile, keyFile, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:	big.NewInt(time.Now().UnixNano()),
+		Subject:		pkix.Name{CommonName: name},
+		DNSNames:		[]string{name},
+		NotBefore:		time.Now().Add(-time.Hour),
+		NotAfter:		time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for filename, block := range map[string]*pem.Block{
+		certFile:	{Type: "CERTIFICATE", Bytes: der},
+		keyFile:	{Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err = os.WriteFile(filename+".new", pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Rename(filename+".new", filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// certificateName returns the name in the certificate which cr is currently handing out.
+func certificateName(t *testing.T, cr *certReloader) string {
+	t.Helper()
+	cert, err := cr.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if _, err := newCertReloader(certFile, keyFile); err == nil {
+		t.Error("newCertReloader() worked without a certificate")
+	}
+	writeCertificate(t, certFile, keyFile, "old.example.com")
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err = cr.watch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCertificate(t, certFile, keyFile, "new.example.com")
+	deadline := time.Now().Add(10 * time.Second)
+	for certificateName(t, cr) != "new.example.com" {
+		if time.Now().After(deadline) {
+			t.Fatal("the renewed certificate was never loaded")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Half-written files must not replace a certificate which works.
+	if err = os.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = cr.reload(); err == nil {
+		t.Error("reload() accepted a broken certificate")
+	}
+	if name := certificateName(t, cr); name != "new.example.com" {
+		t.Errorf("after a failed reload, the certificate is for %q", name)
+	}
+}
+
+func TestSetupTLS(t *testing.T) {
+	defaults := goslConfig
+	defer func() { goslConfig = defaults }()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "gosl.example.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	goslConfig.tlsCertFile, goslConfig.tlsKeyFile = "", ""
+	if config, err := setupTLS(ctx); config != nil || err != nil {
+		t.Errorf("setupTLS() without a certificate = %v, %v; want plain HTTP", config, err)
+	}
+	goslConfig.tlsCertFile = certFile
+	if _, err := setupTLS(ctx); err == nil {
+		t.Error("setupTLS() worked without a key")
+	}
+	goslConfig.tlsKeyFile, goslConfig.tlsMinVersion = keyFile, "1.4"
+	if _, err := setupTLS(ctx); err == nil {
+		t.Error("setupTLS() accepted TLS 1.4")
+	}
+	goslConfig.tlsMinVersion = "1.3"
+	config, err := setupTLS(ctx)
+	if err != nil || config.MinVersion != tlsVersions["1.3"] || config.GetCertificate == nil {
+		t.Errorf("setupTLS() = %+v, %v", config, err)
+	}
+}
@@ -0,0 +1,42 @@
+// Exporting the database back into CSV, in the same format that Import() reads.
+package gosl
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+)
+
+// Export writes every record in the database as a CSV line with UUID, avatar name and grid;
+// the first two columns are what W-Hat uses, so the output can be imported again with Import()
+// (which will also restore the grid), or by anything else which reads W-Hat's files.
+// It returns how many records were written; if the context gets cancelled, it stops early and
+// returns the context's error.
+func (s *Store) Export(ctx context.Context, w io.Writer) (int, error) {
+	cw := csv.NewWriter(w)
+	count := 0
+	var writeErr error
+	err := s.Scan("", func(key string, record AvatarUUID) bool {
+		// Every record is stored twice; we only write the copy under the UUID, which is unique,
+		// and which is always current, even if an old name is still lingering around.
+		if key != record.UUID {
+			return true
+		}
+		if writeErr = cw.Write([]string{record.UUID, record.AvatarName, record.Grid}); writeErr != nil {
+			return false
+		}
+		count++
+		return ctx.Err() == nil
+	})
+	if err == nil {
+		err = writeErr
+	}
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return count, err
+}
@@ -1,6 +1,6 @@
 // Auxiliary functions which I'm always using.
 // Moved to separate file on 20211102.
-package main
+package gosl
 
 import (
 	"fmt"
@@ -9,20 +9,8 @@ import (
 	"runtime"
 
 	"github.com/google/uuid"
-	// "github.com/op/go-logging"
 )
 
-// checkErrPanic logs a fatal error and panics.
-func checkErrPanic(err error) {
-	if err != nil {
-		if pc, file, line, ok := runtime.Caller(1); ok {
-			log.Panicf("%s:%d (%v) - panic: %v\n", filepath.Base(file), line, pc, err)
-			return
-		}
-		log.Panic(err)
-	}
-}
-
 // checkErr checks if there is an error, and if yes, it logs it out and continues.
 //
 //	this is for 'normal' situations when we want to get a log if something goes wrong but do not need to panic
@@ -50,18 +38,6 @@ func checkErrHTTP(w http.ResponseWriter, httpStatus int, errorMessage string, er
 	}
 }
 
-// checkErrPanicHTTP returns an error via HTTP and logs the error with a panic.
-func checkErrPanicHTTP(w http.ResponseWriter, httpStatus int, errorMessage string, err error) {
-	if err != nil {
-		http.Error(w, fmt.Sprintf(errorMessage, err), httpStatus)
-		if pc, file, line, ok := runtime.Caller(1); ok {
-			log.Panic("(", http.StatusText(httpStatus), ") ", filepath.Base(file), ":", line, ":", pc, " - panic:", errorMessage, err)
-			return
-		}
-		log.Panic("(", http.StatusText(httpStatus), ") ", errorMessage, err)
-	}
-}
-
 // logErrHTTP assumes that the error message was already composed and writes it to HTTP and logs it.
 //
 //	this is mostly to avoid code duplication and make sure that all entries are written similarly
@@ -90,3 +66,17 @@ func isValidUUID(u string) bool {
 	_, err := uuid.Parse(u)
 	return err == nil
 }
+
+// canonicalUUID returns u in canonical form (lower case, no braces), if it is a UUID, and u unchanged otherwise,
+// so that each avatar is stored under only one key, however its UUID was sent.
+func canonicalUUID(u string) string {
+	if parsed, err := uuid.Parse(u); err == nil {
+		return parsed.String()
+	}
+	return u
+}
+
+// IsValidUUID is isValidUUID() for the outside world.
+func IsValidUUID(u string) bool {
+	return isValidUUID(u)
+}
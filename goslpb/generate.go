@@ -0,0 +1,11 @@
+// Package goslpb has the protocol buffer messages and the gRPC service definition for gosl-basics,
+// generated from gosl.proto. The server side is implemented by gosl.NewGRPCService.
+//
+// To regenerate the code after changing gosl.proto, you need protoc, protoc-gen-go and protoc-gen-go-grpc:
+//
+//	go install google.golang.org/protobuf/cmd/protoc-gen-go@latest
+//	go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@latest
+//	go generate ./goslpb
+package goslpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gosl.proto
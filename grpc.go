@@ -0,0 +1,160 @@
+// gRPC service (see goslpb/gosl.proto), for services which make lots of lookups and would rather
+// not pay for HTTP and form parsing on each one. It uses the same store (and therefore the same
+// Bloom filter and coalesced lookups) as the HTTP handlers; to serve it, register it on a grpc.Server:
+//
+//	grpcServer := grpc.NewServer()
+//	goslpb.RegisterNameServiceServer(grpcServer, gosl.NewGRPCService(store))
+package gosl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics/goslpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcService implements goslpb.NameServiceServer on top of the same server as the HTTP handlers.
+type grpcService struct {
+	goslpb.UnimplementedNameServiceServer
+	srv *server
+}
+
+// NewGRPCService returns the gRPC service for a store; the options are the same as for NewHandler,
+// and it implements Reconfigurable, too.
+func NewGRPCService(store *Store, options ...HandlerOption) goslpb.NameServiceServer {
+	return &grpcService{srv: newServer(store, options)}
+}
+
+// Reconfigure implements Reconfigurable.
+func (g *grpcService) Reconfigure(options ...HandlerOption) {
+	g.srv.Reconfigure(options...)
+}
+
+// Name2Key returns the record for an avatar name.
+func (g *grpcService) Name2Key(ctx context.Context, req *goslpb.Name2KeyRequest) (*goslpb.Avatar, error) {
+	name := strings.TrimSpace(req.GetName())
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing avatar name")
+	}
+	return g.lookup(name)
+}
+
+// Key2Name returns the record for an avatar UUID.
+func (g *grpcService) Key2Name(ctx context.Context, req *goslpb.Key2NameRequest) (*goslpb.Avatar, error) {
+	key := strings.TrimSpace(req.GetKey())
+	if !isValidUUID(key) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid UUID %q", key)
+	}
+	return g.lookup(key)
+}
+
+// Resolve replies to each item as it comes in; unknown items are not an error.
+func (g *grpcService) Resolve(stream goslpb.NameService_ResolveServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		reply := &goslpb.ResolveResponse{Query: req.GetQuery()}
+		if record, found := g.srv.lookupAvatar(stream.Context(), req.GetQuery()); found {
+			reply.Found, reply.Avatar = true, avatarToProto(record)
+		}
+		if err = stream.Send(reply); err != nil {
+			return err
+		}
+	}
+}
+
+// Register creates or replaces the record for an avatar; like PUT on the REST API, it needs the admin token
+// or a signature, and if the avatar changed names, the old name is removed.
+func (g *grpcService) Register(ctx context.Context, req *goslpb.RegisterRequest) (*goslpb.Avatar, error) {
+	record := AvatarUUID{
+		AvatarName:	strings.TrimSpace(req.GetAvatar().GetName()),
+		UUID:		strings.TrimSpace(req.GetAvatar().GetKey()),
+		Grid:		req.GetAvatar().GetGrid(),
+	}
+	if record.AvatarName == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing avatar name")
+	}
+	if !isValidUUID(record.UUID) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid UUID %q", record.UUID)
+	}
+	if err := g.authoriseWrite(ctx, record.AvatarName, record.UUID); err != nil {
+		return nil, err
+	}
+
+	defer g.srv.lockRecord(canonicalUUID(record.UUID))()
+	if old, found := g.srv.lookupAvatar(ctx, record.UUID); found && old.AvatarName != record.AvatarName {
+		if err := g.srv.store.Delete(AvatarUUID{AvatarName: old.AvatarName}); err != nil {
+			return nil, status.Errorf(writeErrorCode(err), "could not remove old name: %v", err)
+		}
+	}
+	if err := g.srv.store.Insert(record); err != nil {
+		return nil, status.Errorf(writeErrorCode(err), "could not store record: %v", err)
+	}
+	return avatarToProto(record), nil
+}
+
+// authoriseWrite is the gRPC version of (*server).authoriseWrite(): the admin token comes as
+// `authorization: Bearer <token>` metadata, and the signature as x-gosl-timestamp and x-gosl-signature.
+func (g *grpcService) authoriseWrite(ctx context.Context, name string, key string) error {
+	options := g.srv.options.Load()
+	md, _ := metadata.FromIncomingContext(ctx)
+	from := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		from = p.Addr.String()
+	}
+	switch {
+	case options.signingSecret == "" && options.adminToken == "":
+		return status.Error(codes.PermissionDenied, "registering through gRPC is disabled; set a signing secret or an admin token")
+	case isAdminAuthorization(firstValue(md, "authorization"), options.adminToken):
+		return nil
+	case options.signingSecret != "":
+		if err := g.srv.verifySignature(firstValue(md, TimestampHeader), firstValue(md, SignatureHeader), name, key, from); err != nil {
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		return nil
+	}
+	log.Warningf("rejected gRPC write from %s\n", from)
+	return status.Error(codes.Unauthenticated, "missing or invalid admin token")
+}
+
+// writeErrorCode is the gRPC version of writeErrorStatus().
+func writeErrorCode(err error) codes.Code {
+	if errors.Is(err, ErrReadOnly) {
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
+// lookup turns the result of Store.Lookup() into what gRPC expects.
+func (g *grpcService) lookup(searchItem string) (*goslpb.Avatar, error) {
+	record, err := g.srv.store.Lookup(searchItem)
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "no avatar %q", searchItem)
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return avatarToProto(record), nil
+}
+
+// avatarToProto converts our record into the protocol buffer message.
+func avatarToProto(record AvatarUUID) *goslpb.Avatar {
+	return &goslpb.Avatar{Name: record.AvatarName, Key: record.UUID, Grid: record.Grid}
+}
+
+// firstValue returns the first value for a metadata key (which gRPC keeps in lowercase), or "".
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+// Checks the gRPC service end-to-end, over an in-memory connection, and who may register avatars with it.
+package gosl
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"git.gwynethllewelyn.net/GwynethLlewelyn/gosl-basics/goslpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// grpcClient serves the gRPC service for store, with options, over an in-memory connection, until the test ends.
+func grpcClient(t *testing.T, store *Store, options ...HandlerOption) goslpb.NameServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	goslpb.RegisterNameServiceServer(grpcServer, NewGRPCService(store, options...))
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return goslpb.NewNameServiceClient(conn)
+}
+
+func TestGRPCService(t *testing.T) {
+	const (
+		secret = "s3cret"
+		name   = "Some Resident"
+		key    = "a2e76fcd-9360-4f6d-a924-000000000001"
+	)
+	store := openMemoryStore(t)
+	c := grpcClient(t, store, WithSigningSecret(secret))
+	ctx := context.Background()
+	var err error
+
+	if _, err = c.Name2Key(ctx, &goslpb.Name2KeyRequest{Name: name}); status.Code(err) != codes.NotFound {
+		t.Errorf("Name2Key before registering: got %v, want NotFound", err)
+	}
+	register := &goslpb.RegisterRequest{Avatar: &goslpb.Avatar{Name: name, Key: key, Grid: "Production"}}
+	if _, err = c.Register(ctx, register); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("unsigned Register: got %v, want Unauthenticated", err)
+	}
+	timestamp := time.Now().Unix()
+	signed := metadata.AppendToOutgoingContext(ctx,
+		TimestampHeader, strconv.FormatInt(timestamp, 10),
+		SignatureHeader, Sign(secret, timestamp, name, key))
+	if _, err = c.Register(signed, register); err != nil {
+		t.Fatalf("signed Register: %v", err)
+	}
+	avatar, err := c.Name2Key(ctx, &goslpb.Name2KeyRequest{Name: name})
+	if err != nil || avatar.GetKey() != key {
+		t.Errorf("Name2Key: got %v, %v", avatar, err)
+	}
+	if _, err = c.Key2Name(ctx, &goslpb.Key2NameRequest{Key: "not a UUID"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Key2Name with invalid UUID: got %v, want InvalidArgument", err)
+	}
+
+	stream, err := c.Resolve(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := []string{key, "Nobody Here", name}
+	for _, query := range queries {
+		if err = stream.Send(&goslpb.ResolveRequest{Query: query}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream.CloseSend()
+	for i, query := range queries {
+		reply, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.GetQuery() != query || reply.GetFound() != (i != 1) {
+			t.Errorf("Resolve %q: got %v", query, reply)
+		}
+	}
+}
+
+// Without a signing secret or an admin token, Register is refused; with an admin token, it is accepted instead of a signature.
+func TestGRPCRegisterNeedsCredentials(t *testing.T) {
+	const (
+		token = "s3cret"
+		key   = "a2e76fcd-9360-4f6d-a924-000000000001"
+	)
+	store := openMemoryStore(t)
+	if err := store.Insert(AvatarUUID{"Resident One", key, "Production"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	rename := &goslpb.RegisterRequest{Avatar: &goslpb.Avatar{Name: "Resident Renamed", Key: key}}
+
+	open := grpcClient(t, store)
+	if _, err := open.Register(ctx, rename); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("unconfigured Register: got %v, want PermissionDenied", err)
+	}
+	admin := grpcClient(t, store, WithAdminToken(token))
+	if _, err := admin.Register(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer wrong"), rename); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Register with the wrong admin token: got %v, want Unauthenticated", err)
+	}
+	if record, err := store.Lookup(key); err != nil || record.AvatarName != "Resident One" {
+		t.Fatalf("after refused writes, Lookup() = %+v, %v", record, err)
+	}
+	if _, err := admin.Register(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), rename); err != nil {
+		t.Fatalf("Register with the admin token: %v", err)
+	}
+	if record, err := store.Lookup(key); err != nil || record.AvatarName != "Resident Renamed" {
+		t.Errorf("after Register, Lookup() = %+v, %v", record, err)
+	}
+	if _, err := store.Lookup("Resident One"); err == nil {
+		t.Error("the old name is still there")
+	}
+}
@@ -0,0 +1,292 @@
+// A very simple router with explicit routes, which works the same way under the standalone
+// server and FastCGI.
+// Under FastCGI, we never know where the application has been 'mounted' by the web server
+// (it might be `/name2key.fcgi`, or `/examples/gosl-basics`...), because Go's fcgi package
+// does not give us SCRIPT_NAME; so, unless it has been configured (see WithBasePath), routes are
+// matched on the *end* of the path instead, and the web server is trusted to send us only what is ours.
+// Everything that does not match an explicit route goes to the good old legacy handler, which
+// figures out what to do from the parameters — that's how `query.lsl` and old `touch.lsl` scripts work.
+// The REST API (see api.go) is found in the same way, by looking for `/api/v1/` anywhere in the path
+// (or right after the base path).
+package gosl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// route associates the last element of a path with its handler.
+type route struct {
+	name    string
+	handler http.HandlerFunc
+}
+
+// server has the handlers, which all need to get to the store.
+type server struct {
+	store		*Store
+	options		atomic.Pointer[serverOptions]	// never nil; see Reconfigure.
+	reconfigure	sync.Mutex						// so that concurrent Reconfigure()s do not lose each other's changes.
+	recordLocks	[64]sync.Mutex					// see lockRecord in api.go.
+}
+
+// serverOptions are what HandlerOptions change; they are replaced as a whole by Reconfigure,
+// so each request sees either the old ones or the new ones, and never a mix.
+type serverOptions struct {
+	signingSecret	string				// if not empty, writes must be signed; see sign.go.
+	adminToken		string				// if not empty, enables the admin endpoints; see admin.go.
+	accessLog		func(AccessEntry)	// if not nil, gets every HTTP request; see accesslog.go.
+	redactNames		bool				// keep avatar names out of the access log.
+	basePath		string				// if not empty, where the handler is mounted; see WithBasePath.
+}
+
+// router dispatches requests to the explicit routes, falling back to the legacy handler.
+type router struct {
+	srv      *server
+	routes   []route
+	fallback http.HandlerFunc
+	api      *http.ServeMux	// see api.go.
+}
+
+// NewHandler returns an http.Handler with all our routes (LSL-friendly, REST API and documentation),
+// working on the given store. It works the same under FastCGI and can be mounted anywhere.
+// It also implements Reconfigurable.
+func NewHandler(store *Store, options ...HandlerOption) http.Handler {
+	return newRouter(newServer(store, options))
+}
+
+// newServer returns a server for store, with these options.
+func newServer(store *Store, options []HandlerOption) *server {
+	srv := &server{store: store}
+	srv.options.Store(&serverOptions{})
+	srv.Reconfigure(options...)
+	return srv
+}
+
+// WithBasePath says where the handler is mounted, e.g. "/examples/gosl-basics", or "/" for the root;
+// routes (and the API) must then come right after it, and anything outside it gets a 404.
+// Without it, which is the default, routes are matched on the end of the path.
+func WithBasePath(basePath string) HandlerOption {
+	return func(options *serverOptions) {
+		options.basePath = basePath
+	}
+}
+
+// Reconfigure applies options on top of the current ones; requests which are already being
+// handled carry on with the old ones.
+func (srv *server) Reconfigure(options ...HandlerOption) {
+	srv.reconfigure.Lock()
+	defer srv.reconfigure.Unlock()
+	next := *srv.options.Load()
+	for _, option := range options {
+		option(&next)
+	}
+	srv.options.Store(&next)
+}
+
+// Reconfigure implements Reconfigurable.
+func (rt *router) Reconfigure(options ...HandlerOption) {
+	rt.srv.Reconfigure(options...)
+}
+
+// newRouter returns the router with all our routes.
+func newRouter(srv *server) *router {
+	return &router{
+		srv: srv,
+		routes: []route{
+			{"name2key", srv.name2keyHandler},
+			{"key2name", srv.key2nameHandler},
+			{"register", srv.registerHandler},
+			{"touch", srv.registerHandler}, // what touch.lsl has always used.
+			{"openapi.json", openAPIHandler},
+			{"docs", docsHandler},
+		},
+		fallback: srv.legacyHandler,
+		api:      srv.newAPIMux(),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if options := rt.srv.options.Load(); options.accessLog != nil {
+		serveLogged(rt.dispatch, options.accessLog, options.redactNames, w, r)
+		return
+	}
+	rt.dispatch(w, r)
+}
+
+// dispatch sends the request wherever it should go.
+func (rt *router) dispatch(w http.ResponseWriter, r *http.Request) {
+	path, anchored := r.URL.Path, false
+	if basePath := rt.srv.options.Load().basePath; basePath != "" {
+		rest, ok := strings.CutPrefix(path, strings.TrimSuffix(basePath, "/"))
+		if !ok || (rest != "" && rest[0] != '/') {
+			http.NotFound(w, r) // e.g. /gosl-basicsXYZ is not under /gosl-basics.
+			return
+		}
+		path, anchored = rest, true
+	}
+	if serveAPI(rt.api, w, r, path, anchored) {
+		return
+	}
+	path = strings.TrimSuffix(path, "/")
+	for _, route := range rt.routes {
+		if path == "/"+route.name || (!anchored && strings.HasSuffix(path, "/"+route.name)) {
+			log.Debugf("routing %q to /%s\n", r.URL.Path, route.name)
+			route.handler(w, r)
+			return
+		}
+	}
+	rt.fallback(w, r)
+}
+
+// name2keyHandler looks up the UUID for an avatar name (`name` parameter).
+func (srv *server) name2keyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logErrHTTP(w, http.StatusBadRequest, "could not parse parameters: "+err.Error())
+		return
+	}
+	name := r.Form.Get("name")
+	if name == "" {
+		logErrHTTP(w, http.StatusBadRequest, "missing avatar name")
+		return
+	}
+	replyToSL(w, srv.name2keyMessage(r.Context(), name, r.Form.Get("compat")))
+}
+
+// key2nameHandler looks up the avatar name for a UUID (`key` parameter).
+func (srv *server) key2nameHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logErrHTTP(w, http.StatusBadRequest, "could not parse parameters: "+err.Error())
+		return
+	}
+	key := r.Form.Get("key")
+	if key == "" {
+		logErrHTTP(w, http.StatusBadRequest, "missing avatar UUID key")
+		return
+	}
+	replyToSL(w, srv.key2nameMessage(r.Context(), key, r.Form.Get("compat")))
+}
+
+// registerHandler adds a new entry with both `name` and `key`.
+func (srv *server) registerHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logErrHTTP(w, http.StatusBadRequest, "could not parse parameters: "+err.Error())
+		return
+	}
+	name, key := r.Form.Get("name"), r.Form.Get("key")
+	if name == "" || key == "" {
+		logErrHTTP(w, http.StatusBadRequest, "both avatar name and UUID key are required")
+		return
+	}
+	if messageToSL, ok := srv.registerAvatar(w, r, name, key); ok {
+		replyToSL(w, messageToSL)
+	}
+}
+
+// legacyHandler deals with incoming queries and/or associates avatar names with keys depending on parameters.
+// These days, it's the compatibility route, used for everything that doesn't go to an explicit route.
+// Basically we check if both an avatar name and a UUID key has been received: if yes, this means a new entry;
+// - if just the avatar name was received, it means looking up its key;
+// - if just the key was received, it means looking up the name (not necessary since llKey2Name does that, but it's just to illustrate);
+// - if nothing is received, then return an error.
+//
+// Note: to ensure quick lookups, we actually set *two* key/value pairs, one with avatar name/UUID,
+// the other with UUID/name — that way, we can efficiently search for *both* in the same database!
+// Theoretically, we could even have *two* KV databases, but that's too much trouble for the
+// sake of some extra efficiency. (gwyneth 20211030)
+func (srv *server) legacyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logErrHTTP(w, http.StatusNotFound, "no avatar and/or UUID received")
+		return
+	}
+	// test first if this comes from Second Life or OpenSimulator
+	/*
+		if r.Header.Get("X-Secondlife-Region") == "" {
+			logErrHTTP(w, http.StatusForbidden, "Sorry, this application only works inside Second Life.")
+			return
+		}
+	*/
+	name	:= r.Form.Get("name")	// can be empty.
+	key		:= r.Form.Get("key")	// can be empty.
+	compat	:= r.Form.Get("compat")	// compatibility mode with W-Hat,
+	messageToSL := "" // this is what we send back to SL - defined here due to scope issues.
+	if name != "" {
+		if key != "" {
+			// we received both: add a new entry.
+			var ok bool
+			if messageToSL, ok = srv.registerAvatar(w, r, name, key); !ok {
+				return
+			}
+		} else {
+			// we received a name: look up its UUID key and grid.
+			messageToSL = srv.name2keyMessage(r.Context(), name, compat)
+		}
+	} else if key != "" {
+		// in this scenario, we have the UUID key but no avatar name: do the equivalent of a llKey2Name
+		messageToSL = srv.key2nameMessage(r.Context(), key, compat)
+	} else {
+		// neither UUID key nor avatar received, this is an error
+		logErrHTTP(w, http.StatusNotFound, "empty avatar name and UUID key received, cannot proceed")
+		return
+	}
+	replyToSL(w, messageToSL)
+}
+
+// name2keyMessage returns what we send back to SL for a name lookup; with compat=false,
+// we send back a 'cute' message, otherwise just the UUID, like W-Hat.
+func (srv *server) name2keyMessage(ctx context.Context, name string, compat string) string {
+	record, err := srv.lookup(ctx, name)
+	key, grid := record.UUID, record.Grid
+	if err != nil || len(key) != 36 || !isValidUUID(key) { // this is to prevent stupid mistakes!
+		key = NullUUID
+	}
+	if compat == "false" {
+		return "UUID for '" + name + "' is: " + key + " from grid: '" + grid + "'"
+	} // empty also means true!
+	return key
+}
+
+// key2nameMessage does the equivalent of a llKey2Name; see name2keyMessage for compat.
+func (srv *server) key2nameMessage(ctx context.Context, key string, compat string) string {
+	record, err := srv.lookup(ctx, key)
+	name, grid := record.AvatarName, record.Grid
+	if err != nil {
+		name, grid = "", ""
+	}
+	if compat == "false" {
+		return "avatar name for '" + key + "' is '" + name + "' on grid: '" + grid + "'"
+	} // empty also means true!
+	return name
+}
+
+// registerAvatar validates and stores a new entry, using the grid name sent by SL/OpenSimulator.
+// If something goes wrong, the error has already been sent back, and ok is false.
+func (srv *server) registerAvatar(w http.ResponseWriter, r *http.Request, name string, key string) (messageToSL string, ok bool) {
+	name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+	// be stricter!
+	if len(key) != 36 || !isValidUUID(key) {
+		logErrHTTP(w, http.StatusBadRequest, fmt.Sprintf("invalid key %q", key))
+		return "", false
+	}
+	if err := srv.checkSignature(r, name, key); err != nil {
+		logErrHTTP(w, http.StatusUnauthorized, err.Error())
+		return "", false
+	}
+	uuidToInsert := AvatarUUID{name, key, r.Header.Get("X-Secondlife-Shard")}
+	if err := srv.store.Insert(uuidToInsert); err != nil {
+		checkErrHTTP(w, writeErrorStatus(w, err), "could not add new entry: %v", err)
+		return "", false
+	}
+	return "Added new entry for '" + name + "' which is: " + uuidToInsert.UUID + " from grid: '" + uuidToInsert.Grid + "'", true
+}
+
+// replyToSL sends back a plain text reply.
+func replyToSL(w http.ResponseWriter, messageToSL string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, messageToSL)
+}
@@ -0,0 +1,51 @@
+// Checks where the router finds its routes: anywhere at the end of the path, or right after the base path.
+package gosl
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouterMountPoint(t *testing.T) {
+	const key = "a2e76fcd-9360-4f6d-a924-000000000001"
+	store := openMemoryStore(t)
+	if err := store.Insert(AvatarUUID{"Resident One", key, "Production"}); err != nil {
+		t.Fatal(err)
+	}
+	// /register without a key is a 400 on the route, but a plain lookup for the legacy handler.
+	const (
+		route    = http.StatusBadRequest
+		fallback = http.StatusOK
+		api      = -1 // a JSON reply from the API.
+		notFound = http.StatusNotFound
+	)
+	for _, test := range []struct {
+		basePath string
+		target   string
+		want     int
+	}{
+		{"", "/register?name=Resident+One", route},
+		{"", "/register/?name=Resident+One", route},
+		{"", "/examples/gosl-basics/register?name=Resident+One", route},
+		{"", "/register/anything?name=Resident+One", fallback},
+		{"", "/api/v1/avatars/" + key, api},
+		{"", "/examples/gosl-basics/api/v1/avatars/" + key, api},
+		{"/examples/gosl-basics", "/examples/gosl-basics/register?name=Resident+One", route},
+		{"/examples/gosl-basics/", "/examples/gosl-basics/register?name=Resident+One", route},
+		{"/examples/gosl-basics", "/examples/gosl-basics?name=Resident+One", fallback},
+		{"/examples/gosl-basics", "/examples/gosl-basics/api/v1/avatars/" + key, api},
+		{"/examples/gosl-basics", "/examples/gosl-basics/deeper/register?name=Resident+One", fallback},
+		{"/examples/gosl-basics", "/examples/gosl-basics/deeper/api/v1/avatars/" + key, notFound}, // the legacy handler, without parameters.
+		{"/examples/gosl-basics", "/register?name=Resident+One", notFound},
+		{"/examples/gosl-basics", "/examples/gosl-basicsXYZ/register?name=Resident+One", notFound},
+		{"/", "/register?name=Resident+One", route},
+		{"/", "/static/register?name=Resident+One", fallback},
+	} {
+		handler := NewHandler(store, WithBasePath(test.basePath))
+		rec := apiRequest(handler, http.MethodGet, test.target, "")
+		isAPI := rec.Header().Get("Content-Type") == "application/json"
+		if got := rec.Code; (test.want == api) != isAPI || (test.want != api && got != test.want) {
+			t.Errorf("with base path %q, GET %s = %d (%s), want %d", test.basePath, test.target, got, rec.Header().Get("Content-Type"), test.want)
+		}
+	}
+}
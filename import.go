@@ -0,0 +1,153 @@
+// Tools to import a avatar key & name database in CSV format into a KV database.
+package gosl
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/matchers"
+)
+
+// Import is essentially reading a bzip2'ed CSV file with UUID,AvatarName downloaded from http://w-hat.com/#name2key .
+//
+//	One could theoretically set a cron job to get this file, save it on disk periodically, and keep the database up-to-date.
+//	See https://stackoverflow.com/questions/24673335/how-do-i-read-a-gzipped-csv-file for the actual usage of these complicated things!
+//
+// It returns how many records were imported; see ImportReader for the details.
+func (s *Store) Import(ctx context.Context, filename string) (int, error) {
+	filehandler, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer filehandler.Close()
+	return s.ImportReader(ctx, filehandler)
+}
+
+// ImportReader imports a CSV file (possibly gzip'ed or bzip2'ed) from any reader, e.g. stdin.
+//
+//	If the context gets cancelled (e.g. SIGTERM), the import stops at the next batch boundary, after
+//	committing the current batch, so that the database is left in a consistent state; in that case,
+//	the context's error is returned, together with the number of records imported so far.
+func (s *Store) ImportReader(ctx context.Context, r io.Reader) (int, error) {
+	// First, check if we _do_ have a gzipped file or not...
+	// We'll use a small library for that (gwyneth 20211027)
+	// We only have to look at the file header = first 261 bytes; peeking means that we do not
+	// have to rewind anything, so this works with pipes, too.
+	br := bufio.NewReader(r)
+	head, err := br.Peek(261)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return 0, err
+	}
+	kind, _ := filetype.Match(head) // unknown types are just assumed to be plain CSV.
+
+	var cr *csv.Reader // CSV reader needs to be declared here because of scope issues. (gwyneth 20211027)
+
+	// Technically, we could match for a lot of archives and get a io.Reader for each.
+	// However, W-Hat has a limited selection of archives available (currently gzip and bzip2)
+	// so we limit ourselves to these two, falling back to plaintext (gwyneth 20211027).
+	switch kind {
+	case matchers.TypeBz2:
+		cr = csv.NewReader(bzip2.NewReader(br)) // open csv reader and feed the bzip2 reader into it
+	case matchers.TypeGz:
+		zr, err := gzip.NewReader(br) // open gzip reader
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		cr = csv.NewReader(zr) // open csv reader and feed the gzip reader into it
+	default:
+		// We just assume that it's a CSV (uncompressed) file and open it.
+		cr = csv.NewReader(br)
+	}
+	cr.FieldsPerRecord = -1 // we check the number of fields ourselves.
+
+	limit := 0               // outside of for loop so that we can count how many entries we had in total
+	BATCH_BLOCK := s.config.BatchBlock	// saving a few struct accesses...
+	loopBatch := s.config.LoopBatch		// define statically up here.
+	time_start := time.Now() // we want to get an idea on how long this takes
+	batch := make([]kvPair, 0, 2*BATCH_BLOCK)
+	keys := make([]string, 0, 2*BATCH_BLOCK)
+
+	// flush writes the current batch to the database, and only then adds it to the Bloom filter.
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		log.Debug("processing:", limit)
+		if err := s.db.put(batch); err != nil {
+			return err
+		}
+		s.bloomAddBatch(keys...)
+		s.counters.imported.Add(uint64(len(batch) / 2))
+		batch, keys = batch[:0], keys[:0]
+		runtime.GC() // it never hurts...
+		return nil
+	}
+
+	if err = s.beginBloomBatch(); err != nil {
+		return 0, err
+	}
+	// Persist the Bloom filter with all the newly imported entries, however we get out of here.
+	defer s.saveBloomFilter()
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return limit, err
+		}
+		// CSV: first entry is avatar key UUID, second entry is avatar name.
+		if len(record) < 2 {
+			log.Warningf("skipping line %d, which does not have both a UUID and a name: %q\n", limit+1, record)
+			continue
+		}
+		key, name := canonicalUUID(strings.TrimSpace(record[0])), strings.TrimSpace(record[1])
+		grid := "Production" // W-Hat keys come all from the main LL grid, known as 'Production'...
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			grid = strings.TrimSpace(record[2]) // ... but our own exports have the grid as a third column.
+		}
+		jsonNewEntry, err := json.Marshal(AvatarUUID{name, key, grid})
+		if err != nil {
+			log.Warning(err)
+			continue
+		}
+		if limit % loopBatch == 0 {
+			log.Debugf("Entry %04d - Name: %s UUID: %s - JSON: %s\n", limit, name, key, jsonNewEntry)
+		}
+		// Place this record under the avatar's name, and then again under the avatar's key.
+		batch = append(batch, kvPair{name, jsonNewEntry}, kvPair{key, jsonNewEntry})
+		keys = append(keys, name, key)
+		limit++
+		if limit % BATCH_BLOCK == 0 {
+			if err = flush(); err != nil {
+				return limit, fmt.Errorf("could not write batch ending at record %d: %w", limit, err)
+			}
+			if ctx.Err() != nil {
+				log.Notice("import interrupted after", limit, "records")
+				break
+			}
+		}
+	}
+	// commit last batch
+	if err = flush(); err != nil {
+		return limit, err
+	}
+	if c, ok := s.db.(compacter); ok && ctx.Err() == nil { // compacting takes ages, don't do it while shutting down.
+		checkErr(c.compact())
+	}
+	log.Info("total read", limit, "records (or thereabouts) in", time.Since(time_start))
+	return limit, ctx.Err()
+}
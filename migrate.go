@@ -0,0 +1,208 @@
+// Copying a whole database from one backend to another (say, from Badger to LevelDB), without going
+// through the original W-Hat file, which would lose everything registered since it was imported.
+// Keys and values are copied as they are, in batches; after each batch, a small checkpoint file next
+// to the destination records how far we got, so that an interrupted migration can pick up from there.
+package gosl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// MigrationResult says what MigrateTo() did.
+type MigrationResult struct {
+	Copied			int		// keys copied this time...
+	Skipped			int		// ... and keys skipped, since they had been copied before the migration was interrupted.
+	SourceKeys		int		// keys in the source, counted after copying...
+	DestinationKeys	int		// ... and in the destination; these must match.
+}
+
+// migrationCheckpoint is saved (as JSON) after each batch, and removed once the migration is verified.
+type migrationCheckpoint struct {
+	Source		string	`json:"source"`		// backend and path, so that we do not resume a different migration.
+	LastKey		string	`json:"lastKey"`	// everything up to (and including) this key has been written.
+	Copied		int		`json:"copied"`
+	Updated		time.Time	`json:"updated"`
+}
+
+// migrationCheckpointFilename is where the checkpoint for migrating into this store is kept.
+func (s *Store) migrationCheckpointFilename() string {
+	return migrationCheckpointPath(s.config)
+}
+
+// migrationCheckpointPath is migrationCheckpointFilename, for backends, which only get the configuration.
+func migrationCheckpointPath(config Config) string {
+	return config.Path() + ".migrate"
+}
+
+// source identifies a store in a checkpoint.
+func (s *Store) source() string {
+	return s.config.Database + ":" + s.config.Path()
+}
+
+// MigrateTo copies every key in this store into dst, in batches of BatchBlock keys, and then
+// checks that both have the same number of keys.
+// The destination must be empty, unless a previous migration from the same source into it was
+// interrupted, in which case it continues after the last batch which was written; this relies on
+// backends scanning in key order. Nothing should be writing to either store while this runs.
+func (s *Store) MigrateTo(ctx context.Context, dst *Store) (MigrationResult, error) {
+	var result MigrationResult
+	checkpoint, err := dst.loadMigrationCheckpoint()
+	if err != nil {
+		return result, err
+	}
+	resuming := checkpoint.Source != ""
+	if resuming && checkpoint.Source != s.source() {
+		return result, fmt.Errorf("%s has an unfinished migration from %s; remove %s to start over", dst.config.Path(), checkpoint.Source, dst.migrationCheckpointFilename())
+	}
+	if !resuming {
+		if empty, err := dst.isEmpty(); err != nil {
+			return result, err
+		} else if !empty {
+			return result, fmt.Errorf("%s (%s) is not empty; migrate into a new database", dst.config.Path(), dst.config.Database)
+		}
+		checkpoint.Source = s.source()
+	} else {
+		log.Noticef("resuming migration into %s after %q (%d keys copied so far)\n", dst.config.Path(), checkpoint.LastKey, checkpoint.Copied)
+	}
+
+	if err = dst.beginBloomBatch(); err != nil {
+		return result, err
+	}
+	defer dst.saveBloomFilter()
+
+	batchBlock := dst.config.BatchBlock
+	batch := make([]kvPair, 0, batchBlock)
+	keys := make([]string, 0, batchBlock)
+	// flush writes the batch and only then moves the checkpoint forward, so that the
+	// checkpoint never claims more than what is actually on the destination.
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := dst.db.put(batch); err != nil {
+			return err
+		}
+		dst.bloomAddBatch(keys...)
+		result.Copied += len(batch)
+		checkpoint.LastKey = batch[len(batch)-1].key
+		checkpoint.Copied += len(batch)
+		if err := dst.saveMigrationCheckpoint(checkpoint); err != nil {
+			return err
+		}
+		log.Infof("migrated %d keys so far\n", checkpoint.Copied)
+		batch, keys = batch[:0], keys[:0]
+		return nil
+	}
+
+	var flushErr error
+	err = s.db.scan("", func(key string, value []byte) bool {
+		if resuming && key <= checkpoint.LastKey {
+			// Already there; but the destination's Bloom filter may not have been saved
+			// if we were killed, so make sure that it knows about it.
+			dst.bloomAddBatch(key)
+			result.Skipped++
+			return true
+		}
+		// Backends may reuse the value's memory after we return, so we keep a copy.
+		batch = append(batch, kvPair{key, append([]byte(nil), value...)})
+		keys = append(keys, key)
+		if len(batch) == batchBlock {
+			if flushErr = flush(); flushErr != nil {
+				return false
+			}
+			return ctx.Err() == nil
+		}
+		return true
+	})
+	if err == nil {
+		err = flushErr
+	}
+	if err == nil && ctx.Err() == nil {
+		err = flush()
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return result, err // the checkpoint has what was written.
+	}
+
+	// Everything is across; now count both sides.
+	if result.SourceKeys, err = s.countKeys(); err != nil {
+		return result, err
+	}
+	if result.DestinationKeys, err = dst.countKeys(); err != nil {
+		return result, err
+	}
+	if result.SourceKeys != result.DestinationKeys {
+		return result, fmt.Errorf("verification failed: %d keys in %s, but %d in %s", result.SourceKeys, s.config.Path(), result.DestinationKeys, dst.config.Path())
+	}
+	if c, ok := dst.db.(compacter); ok {
+		checkErr(c.compact())
+	}
+	if err = os.Remove(dst.migrationCheckpointFilename()); err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	return result, nil
+}
+
+// isEmpty is true if there is nothing at all in the database.
+func (s *Store) isEmpty() (bool, error) {
+	empty := true
+	err := s.db.scan("", func(string, []byte) bool {
+		empty = false
+		return false
+	})
+	return empty, err
+}
+
+// countKeys counts everything in the database.
+func (s *Store) countKeys() (int, error) {
+	count := 0
+	err := s.db.scan("", func(string, []byte) bool {
+		count++
+		return true
+	})
+	return count, err
+}
+
+// loadMigrationCheckpoint returns the checkpoint for an interrupted migration into this store,
+// or an empty one if there is none.
+func (s *Store) loadMigrationCheckpoint() (migrationCheckpoint, error) {
+	var checkpoint migrationCheckpoint
+	if s.config.diskless() {
+		return checkpoint, nil // an interrupted migration into memory is simply gone.
+	}
+	data, err := os.ReadFile(s.migrationCheckpointFilename())
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	} else if err != nil {
+		return checkpoint, err
+	}
+	if err = json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("corrupted migration checkpoint %s: %w", s.migrationCheckpointFilename(), err)
+	}
+	return checkpoint, nil
+}
+
+// saveMigrationCheckpoint writes the checkpoint atomically, via a temporary file.
+func (s *Store) saveMigrationCheckpoint(checkpoint migrationCheckpoint) error {
+	if s.config.diskless() {
+		return nil
+	}
+	checkpoint.Updated = time.Now()
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	tmpFilename := s.migrationCheckpointFilename() + ".tmp"
+	if err = os.WriteFile(tmpFilename, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, s.migrationCheckpointFilename())
+}
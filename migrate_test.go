@@ -0,0 +1,157 @@
+// Checks that migrations copy everything, and that an interrupted one can be resumed.
+package gosl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMigrateTo(t *testing.T) {
+	dir := t.TempDir()
+	openStore := func(database string) *Store {
+		config := DefaultConfig()
+		config.Database = database
+		config.Dir = dir
+		config.DatabaseName = database + ".db"
+		config.BatchBlock = 1
+		config.BloomCapacity = 1000
+		store, err := Open(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+	source := openStore("leveldb")
+	for i := 1; i <= 5; i++ {
+		record := AvatarUUID{fmt.Sprintf("Resident %d", i), fmt.Sprintf("a2e76fcd-9360-4f6d-a924-%012d", i), "Production"}
+		if err := source.Insert(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	destination := openStore("buntdb")
+
+	// With a cancelled context, it stops after the first batch (of one key).
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := source.MigrateTo(cancelled, destination)
+	if !errors.Is(err, context.Canceled) || result.Copied != 1 {
+		t.Fatalf("interrupted migration: got %+v, %v; want 1 key copied and context.Canceled", result, err)
+	}
+	if _, err := os.Stat(destination.migrationCheckpointFilename()); err != nil {
+		t.Fatalf("no checkpoint after an interrupted migration: %v", err)
+	}
+
+	result, err = source.MigrateTo(context.Background(), destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped != 1 || result.Copied != 9 || result.SourceKeys != 10 || result.DestinationKeys != 10 {
+		t.Errorf("resumed migration: got %+v", result)
+	}
+	if _, err := os.Stat(destination.migrationCheckpointFilename()); !os.IsNotExist(err) {
+		t.Errorf("checkpoint left behind after a successful migration: %v", err)
+	}
+	for _, item := range []string{"Resident 1", "a2e76fcd-9360-4f6d-a924-000000000005"} {
+		if _, err := destination.Lookup(item); err != nil {
+			t.Errorf("Lookup(%q) after migrating: %v", item, err)
+		}
+	}
+
+	// Migrating again into a database which is not empty is refused.
+	if _, err = source.MigrateTo(context.Background(), destination); err == nil {
+		t.Error("migrating into a non-empty database should fail")
+	}
+}
+
+// An mmap database is only finished when the migration is, so a migration which was interrupted
+// (and the process with it) carries on into it, instead of finding it read-only.
+func TestMigrateToMmapResumes(t *testing.T) {
+	dir := t.TempDir()
+	openStore := func(database string) *Store {
+		config := DefaultConfig()
+		config.Database = database
+		config.Dir = dir
+		config.DatabaseName = database + ".db"
+		config.BatchBlock = 1
+		config.BloomCapacity = 1000
+		store, err := Open(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+	source := openStore("leveldb")
+	defer source.Close()
+	for i := 1; i <= 5; i++ {
+		record := AvatarUUID{fmt.Sprintf("Resident %d", i), fmt.Sprintf("a2e76fcd-9360-4f6d-a924-%012d", i), "Production"}
+		if err := source.Insert(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	destination := openStore("mmap")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := source.MigrateTo(cancelled, destination); !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted migration: %v", err)
+	}
+	if err := destination.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	destination = openStore("mmap")
+	result, err := source.MigrateTo(context.Background(), destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped != 1 || result.Copied != 9 || result.DestinationKeys != 10 {
+		t.Errorf("resumed migration: got %+v", result)
+	}
+	if err := destination.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	destination = openStore("mmap")
+	defer destination.Close()
+	if _, err := destination.Lookup("Resident 5"); err != nil {
+		t.Errorf("Lookup() after migrating: %v", err)
+	}
+	if err := destination.Insert(AvatarUUID{"Resident 6", "a2e76fcd-9360-4f6d-a924-000000000006", "Production"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Insert() into a finished mmap database = %v, want ErrReadOnly", err)
+	}
+}
+
+// Older versions stored records with an empty name under the name; migrating those into SQLite
+// (which keeps names and UUIDs in columns, not in opaque values) must not fail.
+func TestMigrateLegacyRecordsToSQLite(t *testing.T) {
+	const key = "a2e76fcd-9360-4f6d-a924-000000000001"
+	dir := t.TempDir()
+	openStore := func(database string) *Store {
+		config := DefaultConfig()
+		config.Database = database
+		config.Dir = dir
+		config.DatabaseName = database + ".db"
+		config.BloomCapacity = 1000
+		store, err := Open(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+	source := openStore("leveldb")
+	legacy := []byte(`{"name":"","key":"` + key + `","grid":"Production"}`)
+	if err := source.db.put([]kvPair{{"Legacy Resident", legacy}, {key, legacy}}); err != nil {
+		t.Fatal(err)
+	}
+	destination := openStore("sqlite")
+	if result, err := source.MigrateTo(context.Background(), destination); err != nil || result.DestinationKeys != 2 {
+		t.Fatalf("MigrateTo() = %+v, %v", result, err)
+	}
+	if record, err := destination.Lookup("Legacy Resident"); err != nil || record.UUID != key || record.AvatarName != "Legacy Resident" {
+		t.Errorf("Lookup(\"Legacy Resident\") after migrating = %+v, %v", record, err)
+	}
+}
@@ -0,0 +1,28 @@
+// OpenAPI 3 document describing all our routes, plus a self-contained viewer for humans,
+// both embedded in the binary; see openapi.json and docs.html.
+// openapi_test.go makes sure that the document and the routes do not drift apart.
+package gosl
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+//go:embed docs.html
+var openAPIViewer []byte
+
+// openAPIHandler serves the OpenAPI document.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*") // so that external viewers/editors can load it.
+	w.Write(openAPISpec)
+}
+
+// docsHandler serves the HTML viewer, which loads openapi.json from the same place.
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(openAPIViewer)
+}
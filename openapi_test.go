@@ -0,0 +1,100 @@
+// Checks that openapi.json describes exactly the routes that we have.
+package gosl
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// openAPIOperations returns "METHOD /path" for every operation in the embedded document.
+func openAPIOperations(t *testing.T) map[string]bool {
+	t.Helper()
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Fatalf("openapi.json is not an OpenAPI 3 document (openapi: %q)", spec.OpenAPI)
+	}
+	operations := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			operations[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	return operations
+}
+
+// TestOpenAPIMatchesRoutes checks both ways: every route is documented, and every documented path is a route.
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	operations := openAPIOperations(t)
+	documentedPaths := make(map[string]bool)
+	for operation := range operations {
+		documentedPaths[strings.SplitN(operation, " ", 2)[1]] = true
+	}
+
+	routes := map[string]bool{"/": true} // the compatibility route.
+	for _, route := range newRouter(&server{}).routes {
+		routes["/"+route.name] = true
+	}
+	apiOperations := make(map[string]bool)
+	for _, route := range (&server{}).apiRoutes() {
+		method, path, _ := strings.Cut(route.pattern, " ")
+		routes[apiPrefix+path] = true
+		apiOperations[method+" "+apiPrefix+path] = true
+	}
+
+	for path := range routes {
+		if !documentedPaths[path] {
+			t.Errorf("route %q is not documented in openapi.json", path)
+		}
+	}
+	for path := range documentedPaths {
+		if !routes[path] {
+			t.Errorf("openapi.json documents %q, but there is no such route", path)
+		}
+	}
+	// The API routes are method-specific, so those must match exactly, too.
+	for operation := range apiOperations {
+		if !operations[operation] {
+			t.Errorf("API operation %q is not documented in openapi.json", operation)
+		}
+	}
+	for operation := range operations {
+		if strings.Contains(operation, apiPrefix) && !apiOperations[operation] {
+			t.Errorf("openapi.json documents %q, but there is no such API operation", operation)
+		}
+	}
+}
+
+// TestOpenAPIServed checks that the document and the viewer are actually served by the router.
+func TestOpenAPIServed(t *testing.T) {
+	for path, contentType := range map[string]string{
+		"/openapi.json":                   "application/json",
+		"/docs":                           "text/html",
+		"/some/fastcgi/path/openapi.json": "application/json",
+	} {
+		rec := httptest.NewRecorder()
+		NewHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), contentType) {
+			t.Errorf("GET %s: got %d %q, want 200 %q", path, rec.Code, rec.Header().Get("Content-Type"), contentType)
+		}
+	}
+	// and the viewer must be self-contained.
+	rec := httptest.NewRecorder()
+	NewHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	for _, external := range []string{"<script src=", "<link rel=\"stylesheet\""} {
+		if strings.Contains(rec.Body.String(), external) {
+			t.Errorf("docs viewer loads external resources (%q)", external)
+		}
+	}
+}
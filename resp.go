@@ -0,0 +1,626 @@
+// A small subset of the Redis protocol (RESP), so that bots and scripts which already talk to Redis
+// can query gosl with any Redis client library (or redis-cli), and no HTTP code at all:
+//
+//	GET <name|uuid>                            the UUID for a name, or the name for a UUID (nil if unknown)
+//	MGET <name|uuid> [<name|uuid> ...]         the same, for several at once
+//	EXISTS <name|uuid> [<name|uuid> ...]       how many of them are known
+//	SET <name> <uuid>                          registers an avatar (see below)
+//	SCAN <cursor> [MATCH prefix*] [COUNT n]    names and UUIDs starting with prefix
+//	INFO [server|stats]                        the store's counters
+//	AUTH, PING, ECHO, SELECT 0 and QUIT        so that client libraries are happy
+//
+// It uses the same store as the HTTP handlers and gRPC, so lookups go through the same Bloom filter,
+// and are counted in the same stats. Lookups are open to everyone, as usual; SET needs AUTH with the
+// admin token first, so, without an admin token, nobody can register avatars this way. Serving it works much like an http.Server:
+//
+//	respServer := gosl.NewRESPServer(store, gosl.WithAdminToken(token))
+//	go respServer.Serve(listener)
+//	...
+//	respServer.Shutdown(ctx)
+package gosl
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits for what clients may send; names and UUIDs are short, so there is no need to accept
+// the 512 MBytes which Redis itself accepts.
+const (
+	respMaxLength	= 64 << 10	// longest argument, and most arguments in a command.
+	respMaxInline	= 4096		// longest inline command, i.e. typed by hand.
+	respScanCount	= 10		// SCAN's default COUNT, as in Redis...
+	respScanMax		= 10000		// ... and the most that it returns at once, no matter what COUNT says.
+)
+
+// ErrRESPServerClosed is returned by RESPServer.Serve after Shutdown.
+var ErrRESPServerClosed = errors.New("RESP server closed")
+
+// RESPServer answers Redis-protocol clients; see NewRESPServer.
+type RESPServer struct {
+	srv			*server
+	mutex		sync.Mutex
+	listeners	map[net.Listener]struct{}
+	conns		map[net.Conn]struct{}
+	closing		bool
+	active		sync.WaitGroup	// one for each connection.
+}
+
+// NewRESPServer returns a Redis-protocol server for a store; the options are the same as for NewHandler
+// (WithAdminToken sets the password for AUTH).
+// It implements Reconfigurable; after a new admin token is set, clients have to AUTH again.
+func NewRESPServer(store *Store, options ...HandlerOption) *RESPServer {
+	return &RESPServer{
+		srv:		newServer(store, options),
+		listeners:	make(map[net.Listener]struct{}),
+		conns:		make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on listener until Shutdown is called, and then returns ErrRESPServerClosed.
+func (rs *RESPServer) Serve(listener net.Listener) error {
+	rs.mutex.Lock()
+	if rs.closing {
+		rs.mutex.Unlock()
+		listener.Close()
+		return ErrRESPServerClosed
+	}
+	rs.listeners[listener] = struct{}{}
+	rs.mutex.Unlock()
+	defer func() {
+		rs.mutex.Lock()
+		delete(rs.listeners, listener)
+		rs.mutex.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if rs.isClosing() {
+				return ErrRESPServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(10 * time.Millisecond) // e.g. out of file descriptors; let's hope it gets better.
+				continue
+			}
+			return err
+		}
+		rs.mutex.Lock()
+		if rs.closing {
+			rs.mutex.Unlock()
+			conn.Close()
+			return ErrRESPServerClosed
+		}
+		rs.conns[conn] = struct{}{}
+		rs.active.Add(1)
+		rs.mutex.Unlock()
+		go rs.serveConn(conn)
+	}
+}
+
+// Shutdown stops accepting connections and disconnects all clients, each one as soon as it has
+// finished its current command, if any. If ctx expires first, the remaining connections are closed anyway,
+// and ctx's error is returned.
+func (rs *RESPServer) Shutdown(ctx context.Context) error {
+	rs.mutex.Lock()
+	rs.closing = true
+	for listener := range rs.listeners {
+		listener.Close()
+	}
+	// Waiting clients get an error straight away; busy ones, as soon as they try to read the next command.
+	for conn := range rs.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	rs.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		rs.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		rs.mutex.Lock()
+		for conn := range rs.conns {
+			conn.Close()
+		}
+		rs.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Reconfigure implements Reconfigurable.
+func (rs *RESPServer) Reconfigure(options ...HandlerOption) {
+	rs.srv.Reconfigure(options...)
+}
+
+// isClosing is true once Shutdown has been called.
+func (rs *RESPServer) isClosing() bool {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return rs.closing
+}
+
+// respConn is one client connection; replies are buffered (see flushingReader).
+type respConn struct {
+	rs				*RESPServer
+	bw				*bufio.Writer
+	from			string	// just for the logs.
+	password		[]byte	// from the last successful AUTH.
+	quit			bool	// after QUIT.
+}
+
+// serveConn reads and runs commands until the client goes away (or the server does).
+func (rs *RESPServer) serveConn(conn net.Conn) {
+	defer rs.active.Done()
+	defer func() {
+		conn.Close()
+		rs.mutex.Lock()
+		delete(rs.conns, conn)
+		rs.mutex.Unlock()
+	}()
+	c := &respConn{
+		rs:				rs,
+		bw:				bufio.NewWriter(conn),
+		from:			conn.RemoteAddr().String(),
+	}
+	// Replies are sent whenever we run out of commands to read, so that clients which pipeline
+	// their commands get all the replies at once.
+	br := bufio.NewReader(flushingReader{conn, c.bw})
+	defer c.bw.Flush()
+	for !c.quit {
+		args, err := readRESPCommand(br)
+		if err != nil {
+			var netErr net.Error
+			if err != io.EOF && err != io.ErrUnexpectedEOF && !errors.As(err, &netErr) && !errors.Is(err, net.ErrClosed) {
+				// Garbage; Redis tells the client why, and hangs up, since it's lost track of where commands begin.
+				log.Warningf("RESP protocol error from %s: %v\n", c.from, err)
+				c.errorReply("ERR Protocol error: " + err.Error())
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue // an empty line, typed by hand.
+		}
+		c.command(args)
+	}
+}
+
+// flushingReader flushes w before waiting for anything to read, since the client may be waiting
+// for the replies to what it sent before sending anything else.
+type flushingReader struct {
+	r	io.Reader
+	w	*bufio.Writer
+}
+
+func (fr flushingReader) Read(p []byte) (int, error) {
+	if fr.w.Buffered() > 0 {
+		if err := fr.w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return fr.r.Read(p)
+}
+
+// command runs a single command, and writes its reply.
+func (c *respConn) command(args [][]byte) {
+	typed := string(args[0])
+	name := strings.ToUpper(typed)
+	args = args[1:]
+	log.Debugf("RESP %s %q from %s\n", name, args, c.from)
+	wrongArguments := func() {
+		c.errorReply(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+	}
+	switch name {
+	case "GET":
+		if len(args) != 1 {
+			wrongArguments()
+			return
+		}
+		c.lookup(string(args[0]))
+	case "MGET":
+		if len(args) == 0 {
+			wrongArguments()
+			return
+		}
+		c.arrayHeader(len(args))
+		for _, arg := range args {
+			c.lookup(string(arg))
+		}
+	case "EXISTS":
+		if len(args) == 0 {
+			wrongArguments()
+			return
+		}
+		count := 0
+		for _, arg := range args {
+			if _, found := c.rs.srv.lookupAvatar(context.Background(), string(arg)); found {
+				count++
+			}
+		}
+		c.integer(count)
+	case "SET":
+		if len(args) < 2 {
+			wrongArguments()
+			return
+		}
+		if len(args) > 2 {
+			c.errorReply("ERR syntax error (only SET <name> <uuid> is supported)")
+			return
+		}
+		c.set(string(args[0]), string(args[1]))
+	case "SCAN":
+		c.scan(args)
+	case "INFO":
+		if len(args) > 1 {
+			c.errorReply("ERR syntax error")
+			return
+		}
+		section := "default"
+		if len(args) == 1 {
+			section = strings.ToLower(string(args[0]))
+		}
+		c.bulk(c.info(section))
+	case "AUTH":
+		c.auth(args)
+	case "PING":
+		switch len(args) {
+		case 0:
+			c.simple("PONG")
+		case 1:
+			c.bulk(string(args[0]))
+		default:
+			wrongArguments()
+		}
+	case "ECHO":
+		if len(args) != 1 {
+			wrongArguments()
+			return
+		}
+		c.bulk(string(args[0]))
+	case "SELECT":
+		if len(args) != 1 {
+			wrongArguments()
+		} else if string(args[0]) != "0" {
+			c.errorReply("ERR DB index is out of range")
+		} else {
+			c.simple("OK")
+		}
+	case "QUIT":
+		c.simple("OK")
+		c.quit = true
+	default:
+		// Redis' own wording, which some clients look for, e.g. to fall back from HELLO.
+		c.errorReply(fmt.Sprintf("ERR unknown command '%s', with args beginning with: %s", typed, quoteArgs(args)))
+	}
+}
+
+// lookup replies with the UUID for a name, or the name for a UUID, or nil if neither is known.
+func (c *respConn) lookup(searchItem string) {
+	record, found := c.rs.srv.lookupAvatar(context.Background(), searchItem)
+	switch {
+	case !found:
+		c.null()
+	case strings.TrimSpace(searchItem) == record.UUID:
+		c.bulk(record.AvatarName)
+	default:
+		c.bulk(record.UUID)
+	}
+}
+
+// set registers an avatar; like Register on gRPC, if the avatar changed names, the old name is removed.
+func (c *respConn) set(name string, key string) {
+	if !c.mayWrite() {
+		c.errorReply("NOAUTH Authentication required.")
+		return
+	}
+	record := AvatarUUID{AvatarName: strings.TrimSpace(name), UUID: strings.TrimSpace(key)}
+	if record.AvatarName == "" {
+		c.errorReply("ERR missing avatar name")
+		return
+	}
+	if !isValidUUID(record.UUID) {
+		c.errorReply(fmt.Sprintf("ERR invalid UUID %q", record.UUID))
+		return
+	}
+	if old, found := c.rs.srv.lookupAvatar(context.Background(), record.UUID); found && old.AvatarName != record.AvatarName {
+		if err := c.rs.srv.store.Delete(AvatarUUID{AvatarName: old.AvatarName}); err != nil {
+			c.writeError("could not remove old name", err)
+			return
+		}
+	}
+	if err := c.rs.srv.store.Insert(record); err != nil {
+		c.writeError("could not store record", err)
+		return
+	}
+	c.simple("OK")
+}
+
+// writeError is the RESP version of writeErrorStatus(); READONLY is what Redis replicas say.
+func (c *respConn) writeError(what string, err error) {
+	if errors.Is(err, ErrReadOnly) {
+		c.errorReply("READONLY " + err.Error())
+		return
+	}
+	log.Errorf("RESP: %s for %s: %v\n", what, c.from, err)
+	c.errorReply("ERR " + what + ": " + err.Error())
+}
+
+// scan implements SCAN, where the cursor is how many matching keys have been returned so far.
+// That's not quite as clever as Redis' cursors, since each call has to skip over everything that
+// was returned already, so it's meant for prefixes, not for going through the whole database
+// (that's what export and backups are for). Keys deleted in the meantime may make it skip others.
+func (c *respConn) scan(args [][]byte) {
+	if len(args) == 0 || len(args)%2 == 0 {
+		c.errorReply("ERR wrong number of arguments for 'scan' command")
+		return
+	}
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		c.errorReply("ERR invalid cursor")
+		return
+	}
+	pattern, count := "*", respScanCount
+	for i := 1; i < len(args); i += 2 {
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				c.errorReply("ERR value is not an integer or out of range")
+				return
+			}
+		default:
+			c.errorReply("ERR syntax error")
+			return
+		}
+	}
+	count = min(count, respScanMax)
+	prefix, exact, ok := scanPrefix(pattern)
+	if !ok {
+		c.errorReply("ERR only MATCH patterns like 'prefix*' are supported")
+		return
+	}
+	var keys []string
+	var seen uint64
+	more := false
+	err = c.rs.srv.store.Scan(prefix, func(key string, _ AvatarUUID) bool {
+		if exact && key != prefix {
+			return true
+		}
+		if seen++; seen <= cursor {
+			return true
+		}
+		if len(keys) == count {
+			more = true
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		c.writeError("could not scan the database", err)
+		return
+	}
+	next := uint64(0)
+	if more {
+		next = cursor + uint64(count)
+	}
+	c.arrayHeader(2)
+	c.bulk(strconv.FormatUint(next, 10))
+	c.arrayHeader(len(keys))
+	for _, key := range keys {
+		c.bulk(key)
+	}
+}
+
+// scanPrefix turns a MATCH pattern into a prefix, which must be all that the pattern matches
+// ("prefix*"), or the whole key (exact is then true). Anything fancier is not ok.
+func scanPrefix(pattern string) (prefix string, exact bool, ok bool) {
+	prefix, wildcard := strings.CutSuffix(pattern, "*")
+	if strings.ContainsAny(prefix, `*?[\`) {
+		return "", false, false
+	}
+	return prefix, !wildcard, true
+}
+
+// info returns the store's counters, in the same format as Redis' INFO.
+func (c *respConn) info(section string) string {
+	stats := c.rs.srv.store.Stats()
+	var sb strings.Builder
+	all := section == "default" || section == "all" || section == "everything"
+	if all || section == "server" {
+		fmt.Fprintf(&sb, "# Server\r\nserver_name:gosl-basics\r\ndatabase:%s\r\nread_only:%d\r\nuptime_in_seconds:%d\r\n\r\n",
+			stats.Database, boolToInt(c.rs.srv.store.ReadOnly()), int64(stats.Uptime.Seconds()))
+	}
+	if all || section == "stats" {
+		fmt.Fprintf(&sb, "# Stats\r\nlookups:%d\r\nhits:%d\r\nmisses:%d\r\nbloom_rejected:%d\r\ncoalesced:%d\r\nerrors:%d\r\ninserts:%d\r\ndeletes:%d\r\nimported:%d\r\n",
+			stats.Lookups, stats.Hits, stats.Misses, stats.BloomRejected, stats.Coalesced, stats.Errors, stats.Inserts, stats.Deletes, stats.Imported)
+	}
+	return sb.String()
+}
+
+// auth checks the admin token, which is the only password there is; the user, if any, must be "default".
+func (c *respConn) auth(args [][]byte) {
+	if len(args) == 0 || len(args) > 2 {
+		c.errorReply("ERR wrong number of arguments for 'auth' command")
+		return
+	}
+	adminToken := c.rs.srv.options.Load().adminToken
+	if adminToken == "" {
+		c.errorReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		return
+	}
+	password := args[len(args)-1]
+	if (len(args) == 2 && string(args[0]) != "default") || subtle.ConstantTimeCompare(password, []byte(adminToken)) != 1 {
+		log.Warningf("rejected RESP AUTH from %s\n", c.from)
+		c.password = nil
+		c.errorReply("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	c.password = password
+	c.simple("OK")
+}
+
+// mayWrite is true if the client authenticated with the current admin token; without one, nobody may write.
+func (c *respConn) mayWrite() bool {
+	adminToken := c.rs.srv.options.Load().adminToken
+	return adminToken != "" && subtle.ConstantTimeCompare(c.password, []byte(adminToken)) == 1
+}
+
+// Replies; write errors are noticed when flushing.
+
+func (c *respConn) simple(s string) {
+	c.bw.WriteString("+" + s + "\r\n")
+}
+
+func (c *respConn) errorReply(s string) {
+	c.bw.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(s) + "\r\n")
+}
+
+func (c *respConn) integer(n int) {
+	c.bw.WriteString(":" + strconv.Itoa(n) + "\r\n")
+}
+
+func (c *respConn) bulk(s string) {
+	c.bw.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (c *respConn) null() {
+	c.bw.WriteString("$-1\r\n")
+}
+
+func (c *respConn) arrayHeader(n int) {
+	c.bw.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// quoteArgs formats the first few arguments like Redis does in its error messages.
+func quoteArgs(args [][]byte) string {
+	var quoted []string
+	for i, arg := range args {
+		if i == 3 {
+			break
+		}
+		quoted = append(quoted, "'"+string(arg)+"' ")
+	}
+	return strings.Join(quoted, "")
+}
+
+// boolToInt is 1 for true, which is what Redis uses for flags.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// readRESPCommand reads a command, either as an array of bulk strings (which is what client libraries
+// send), or inline, i.e. words separated by spaces, which is what people type with telnet or nc;
+// inline, names with spaces must be "quoted".
+func readRESPCommand(br *bufio.Reader) ([][]byte, error) {
+	first, err := br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] == '*' {
+		return readRESPArray(br, respMaxLength)
+	}
+	line, err := br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull || len(line) > respMaxInline {
+		return nil, errors.New("too big inline request")
+	} else if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return splitInline(strings.TrimRight(string(line), "\r\n"))
+}
+
+// splitInline splits an inline command into words, keeping "quoted strings" together.
+func splitInline(line string) ([][]byte, error) {
+	var args [][]byte
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return args, nil
+		}
+		if rest, quoted := strings.CutPrefix(line, `"`); quoted {
+			end := strings.IndexByte(rest, '"')
+			if end < 0 {
+				return nil, errors.New("unbalanced quotes in request")
+			}
+			args = append(args, []byte(rest[:end]))
+			line = rest[end+1:]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		args = append(args, []byte(line[:end]))
+		line = line[end:]
+	}
+}
+
+// readRESPArray reads an array of bulk strings, e.g. "*2\r\n$3\r\ndel\r\n$3\r\nkey\r\n", with up to
+// maxLength strings of up to maxLength bytes each. It returns io.EOF only if there was nothing at all left to read.
+func readRESPArray(br *bufio.Reader, maxLength int) ([][]byte, error) {
+	count, err := readRESPLength(br, '*', maxLength)
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, count)
+	for i := range args {
+		length, err := readRESPLength(br, '$', maxLength)
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+		args[i] = make([]byte, length+2) // plus \r\n.
+		if _, err = io.ReadFull(br, args[i]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		args[i] = args[i][:length]
+	}
+	return args, nil
+}
+
+// readRESPLength reads a line such as "*3\r\n" or "$5\r\n", and returns the number in it.
+// Such lines are short, so anything which does not fit into br's buffer is garbage.
+func readRESPLength(br *bufio.Reader, kind byte, maxLength int) (int, error) {
+	slice, err := br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return 0, fmt.Errorf("expected %q, got a very long line", kind)
+	} else if err != nil {
+		if err == io.EOF && len(slice) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	line := strings.TrimRight(string(slice), "\r\n")
+	if len(line) < 2 || line[0] != kind {
+		return 0, fmt.Errorf("expected %q, got %q", kind, line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxLength {
+		return 0, fmt.Errorf("invalid length in %q", line)
+	}
+	return n, nil
+}
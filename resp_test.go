@@ -0,0 +1,195 @@
+// Checks the Redis-protocol frontend end-to-end, over a real TCP connection.
+package gosl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readReply reads any RESP reply; nil bulk strings come back as nil, and errors as errors.
+func readReply(br *bufio.Reader) (any, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return errors.New(line[1:]), nil
+	case ':':
+		return strconv.Atoi(line[1:])
+	case '$':
+		length, _ := strconv.Atoi(line[1:])
+		if length < 0 {
+			return nil, nil
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+	case '*':
+		count, _ := strconv.Atoi(line[1:])
+		array := make([]any, count)
+		for i := range array {
+			if array[i], err = readReply(br); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+func TestRESPServer(t *testing.T) {
+	const (
+		token = "s3cret"
+		key1  = "a2e76fcd-9360-4f6d-a924-000000000001"
+		key2  = "a2e76fcd-9360-4f6d-a924-000000000002"
+	)
+	config := DefaultConfig()
+	config.Database = "memory"
+	config.BloomCapacity = 1000
+	store, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	respServer := NewRESPServer(store, WithAdminToken(token))
+	served := make(chan error, 1)
+	go func() { served <- respServer.Serve(listener) }()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	do := func(args ...string) string {
+		t.Helper()
+		request := fmt.Sprintf("*%d\r\n", len(args))
+		for _, arg := range args {
+			request += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+		}
+		if _, err := conn.Write([]byte(request)); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := readReply(br)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(reply)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SET", "Resident One", key1}, "NOAUTH Authentication required."},
+		{[]string{"AUTH", "wrong"}, "WRONGPASS invalid username-password pair or user is disabled."},
+		{[]string{"AUTH", "default", token}, "OK"},
+		{[]string{"set", "Resident One", key1}, "OK"},
+		{[]string{"SET", "Resident Two", key2}, "OK"},
+		{[]string{"SET", "Resident Three", "not a UUID"}, `ERR invalid UUID "not a UUID"`},
+		{[]string{"GET", "Resident One"}, key1},
+		{[]string{"GET", key2}, "Resident Two"},
+		{[]string{"GET", "Nobody"}, "<nil>"},
+		{[]string{"MGET", "Resident Two", "Nobody", key1}, "[" + key2 + " <nil> Resident One]"},
+		{[]string{"EXISTS", "Resident One", "Nobody", key2}, "2"},
+		{[]string{"SCAN", "0", "MATCH", "Resident*", "COUNT", "1"}, "[1 [Resident One]]"},
+		{[]string{"SCAN", "1", "MATCH", "Resident*", "COUNT", "1"}, "[0 [Resident Two]]"},
+		{[]string{"SCAN", "0", "MATCH", "Resident Two"}, "[0 [Resident Two]]"},
+		{[]string{"SCAN", "0", "MATCH", "*One"}, "ERR only MATCH patterns like 'prefix*' are supported"},
+		{[]string{"SELECT", "1"}, "ERR DB index is out of range"},
+		{[]string{"HELLO", "3"}, "ERR unknown command 'HELLO', with args beginning with: '3' "},
+	} {
+		if got := do(test.args...); got != test.want {
+			t.Errorf("%q = %q, want %q", test.args, got, test.want)
+		}
+	}
+	// A new admin token means authenticating again.
+	respServer.Reconfigure(WithAdminToken("n3w"))
+	if got := do("SET", "Resident Two", key2); got != "NOAUTH Authentication required." {
+		t.Errorf("SET after changing the admin token = %q", got)
+	}
+	if got := do("AUTH", "n3w"); got != "OK" {
+		t.Errorf("AUTH with the new admin token = %q", got)
+	}
+	if info := do("INFO"); !strings.Contains(info, "database:memory\r\n") || !strings.Contains(info, "inserts:2\r\n") {
+		t.Errorf("INFO = %q", info)
+	}
+
+	// Inline commands, as typed by hand, work too.
+	if _, err := conn.Write([]byte("PING\r\nGET \"Resident One\"\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"PONG", key1} {
+		if reply, err := readReply(br); err != nil || fmt.Sprint(reply) != want {
+			t.Errorf("inline reply = %v, %v; want %q", reply, err, want)
+		}
+	}
+
+	// The reply must not wait for the rest of a command which has only been partly sent.
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("PING\r\n*1\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := readReply(br); err != nil || reply != "PONG" {
+		t.Errorf("reply before the end of the next command = %v, %v", reply, err)
+	}
+	if _, err := conn.Write([]byte("$4\r\nPING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := readReply(br); err != nil || reply != "PONG" {
+		t.Errorf("reply to the rest of the command = %v, %v", reply, err)
+	}
+
+	if err := respServer.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() = %v", err)
+	}
+	if err := <-served; !errors.Is(err, ErrRESPServerClosed) {
+		t.Errorf("Serve() = %v, want ErrRESPServerClosed", err)
+	}
+	if _, err := readReply(br); err == nil {
+		t.Error("the connection is still open after Shutdown()")
+	}
+}
+
+// Without an admin token, nobody can register avatars over RESP, even if nothing else has been set.
+func TestRESPWritesNeedAdminToken(t *testing.T) {
+	store := openMemoryStore(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	respServer := NewRESPServer(store)
+	go respServer.Serve(listener)
+	defer respServer.Shutdown(context.Background())
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("SET \"Resident One\" a2e76fcd-9360-4f6d-a924-000000000001\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := readReply(bufio.NewReader(conn)); err != nil || fmt.Sprint(reply) != "NOAUTH Authentication required." {
+		t.Errorf("SET without an admin token = %v, %v", reply, err)
+	}
+}
@@ -0,0 +1,56 @@
+// Counters for what the store has been doing since it was opened, for the stats endpoint (and anyone
+// embedding the package who wants to export them to their own monitoring).
+package gosl
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the store's counters.
+type Stats struct {
+	Database		string			`json:"database"`		// backend in use.
+	Uptime			time.Duration	`json:"uptime"`			// since the store was opened, in nanoseconds (as JSON).
+	Lookups			uint64			`json:"lookups"`		// all calls to Lookup(), Name2Key() and Key2Name().
+	Hits			uint64			`json:"hits"`			// lookups that found something.
+	Misses			uint64			`json:"misses"`			// lookups that found nothing, including...
+	BloomRejected	uint64			`json:"bloomRejected"`	// ... misses answered by the Bloom filter alone.
+	Coalesced		uint64			`json:"coalesced"`		// lookups which shared the result of a concurrent one.
+	Errors			uint64			`json:"errors"`			// lookups which failed for reasons other than not finding anything.
+	Inserts			uint64			`json:"inserts"`
+	Deletes			uint64			`json:"deletes"`
+	Imported		uint64			`json:"imported"`		// records written by Import()/ImportReader().
+}
+
+// storeCounters are updated atomically, since the store is used concurrently.
+type storeCounters struct {
+	opened											time.Time
+	lookups, hits, misses, bloomRejected, coalesced	atomic.Uint64
+	errors, inserts, deletes, imported				atomic.Uint64
+}
+
+// Stats returns the current counters.
+func (s *Store) Stats() Stats {
+	return Stats{
+		Database:		s.config.Database,
+		Uptime:			time.Since(s.counters.opened),
+		Lookups:		s.counters.lookups.Load(),
+		Hits:			s.counters.hits.Load(),
+		Misses:			s.counters.misses.Load(),
+		BloomRejected:	s.counters.bloomRejected.Load(),
+		Coalesced:		s.counters.coalesced.Load(),
+		Errors:			s.counters.errors.Load(),
+		Inserts:		s.counters.inserts.Load(),
+		Deletes:		s.counters.deletes.Load(),
+		Imported:		s.counters.imported.Load(),
+	}
+}
+
+// Ping checks that the database is still answering, by looking up a key which is never there.
+func (s *Store) Ping() error {
+	if _, err := s.db.get(NullUUID); err != nil && !errors.Is(err, errKeyNotFound) {
+		return err
+	}
+	return nil
+}
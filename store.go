@@ -0,0 +1,236 @@
+// The Store: an open KV database plus everything we keep around it (Bloom filter, coalesced lookups).
+// We used to open the database on every single request, which not only was slow, but also meant
+// that there was nothing to close cleanly when the process got killed. Now it is opened once, by Open(),
+// and closed by Close().
+package gosl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	"golang.org/x/sync/singleflight"
+)
+
+// Store is an open name2key database. It is safe for concurrent use.
+type Store struct {
+	config		Config
+	db			backend
+	bloomFilter	*bloom.BloomFilter	// nil means that the filter is disabled, i.e. every lookup goes to the backend.
+	bloomMutex	sync.RWMutex		// the filter itself is not safe for concurrent use.
+	// lookups coalesces concurrent lookups for the same name or UUID, so that only one
+	// backend read is in flight per key; everybody else waiting for it shares its result.
+	// This happens a lot when an in-world event starts and dozens of HUDs look up the same host.
+	lookups		singleflight.Group
+	counters	storeCounters	// see stats.go.
+	closeOnce	sync.Once
+}
+
+// Open creates the database directory if needed, opens the configured backend and
+// loads (or rebuilds) the Bloom filter.
+func Open(config Config) (*Store, error) {
+	// Avoid division by zero...
+	if config.BatchBlock < 1 {
+		config.BatchBlock = 1
+	}
+	if config.LoopBatch < 1 {
+		config.LoopBatch = 1
+	}
+	// We cannot proceed without a valid directory for the database to be written (unless there's nothing to write).
+	if !config.diskless() {
+		if err := os.MkdirAll(config.Dir, 0700); err != nil {
+			return nil, fmt.Errorf("could not create directory %q: %w", config.Dir, err)
+		}
+	}
+	db, err := openBackend(config)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("%s database open at %q\n", config.Database, config.Path())
+	s := &Store{config: config, db: db}
+	s.counters.opened = time.Now()
+	// Load (or rebuild) the Bloom filter *before* anything gets imported, so that imports just add to it.
+	s.loadBloomFilter()
+	return s, nil
+}
+
+// Config returns the configuration that the store was opened with.
+func (s *Store) Config() Config {
+	return s.config
+}
+
+// Close saves the Bloom filter and closes the database. It is safe to call more than once.
+func (s *Store) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.saveBloomFilter()
+		err = s.db.close()
+		log.Debug("database closed")
+	})
+	return err
+}
+
+// Name2Key searches the database for an avatar name.
+// Returns NullUUID if the name wasn't found.
+func (s *Store) Name2Key(avatarName string) (uuid string, grid string) {
+	record, err := s.Lookup(avatarName)
+	if err != nil {
+		return NullUUID, ""
+	}
+	return record.UUID, record.Grid
+}
+
+// Key2Name searches the database for an avatar UUID.
+// Returns empty string if the UUID wasn't found.
+func (s *Store) Key2Name(avatarKey string) (name string, grid string) {
+	record, err := s.Lookup(avatarKey)
+	if err != nil {
+		return "", ""
+	}
+	return record.AvatarName, record.Grid
+}
+
+// How a lookup got its answer, for the access log (see accesslog.go); like the counters in stats.go,
+// "bloom" lookups are also misses, and "shared" ones are also hits or misses.
+const (
+	lookupHit		= "hit"		// found in the database.
+	lookupMiss		= "miss"	// not found...
+	lookupBloom		= "bloom"	// ... without even asking the database, since the Bloom filter knew.
+	lookupShared	= "shared"	// shared the result of a concurrent lookup for the same item.
+	lookupError		= "error"	// the database failed.
+)
+
+// Lookup is the universal search: since we put everything in the KV database, we can basically search for anything.
+// *Way* more efficient! (gwyneth 20211031)
+// Returns the record from the KV store, if found, or ErrNotFound. UUIDs can be written in any form that uuid.Parse accepts.
+// Concurrent searches for the same (normalised) item are coalesced into a single backend read.
+func (s *Store) Lookup(searchItem string) (AvatarUUID, error) {
+	return s.lookupNoting(searchItem, func(string) {})
+}
+
+// lookupNoting is Lookup, which also tells note how it went (see lookupHit & co.).
+func (s *Store) lookupNoting(searchItem string, note func(outcome string)) (AvatarUUID, error) {
+	searchItem = canonicalUUID(strings.TrimSpace(searchItem))
+	time_start := time.Now()	// start chronometer to time this transaction.
+	s.counters.lookups.Add(1)
+	if searchItem == "" { // nothing is stored under an empty key, so it's a plain miss, not the Bloom filter's doing.
+		s.counters.misses.Add(1)
+		note(lookupMiss)
+		return AvatarUUID{"", NullUUID, ""}, ErrNotFound
+	}
+	// Definite misses never touch the backend.
+	if !s.bloomMayContain(searchItem) {
+		s.counters.misses.Add(1)
+		s.counters.bloomRejected.Add(1)
+		note(lookupMiss)
+		note(lookupBloom)
+		log.Debugf("Bloom filter: %q definitely not in database (%v)\n", searchItem, time.Since(time_start))
+		return AvatarUUID{"", NullUUID, ""}, ErrNotFound
+	}
+	// Do() also says 'shared' to the one which did the reading, if anyone else got its result.
+	leader := false
+	result, err, shared := s.lookups.Do(searchItem, func() (any, error) {
+		leader = true
+		return s.lookup(searchItem)
+	})
+	if shared && !leader {
+		s.counters.coalesced.Add(1)
+		note(lookupShared)
+		log.Debugf("lookup for %q was shared with concurrent requests\n", searchItem)
+	}
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			s.counters.misses.Add(1)
+			note(lookupMiss)
+		} else {
+			s.counters.errors.Add(1)
+			note(lookupError)
+			log.Errorf("error while getting or unmarshalling reply to search item: %q (%v)\n", searchItem, err)
+		}
+		return AvatarUUID{"", NullUUID, ""}, err
+	} // else:
+	s.counters.hits.Add(1)
+	note(lookupHit)
+	return result.(AvatarUUID), nil
+}
+
+// lookup does the actual reading from the backend; Lookup() is the one that should be called,
+// since it makes sure that only one lookup() is running for the same item at any given time.
+func (s *Store) lookup(searchItem string) (AvatarUUID, error) {
+	var val AvatarUUID
+	time_start := time.Now()	// start chronometer to time this transaction.
+	data, err := s.db.get(searchItem)
+	log.Debugf("time to lookup %q: %v\n", searchItem, time.Since(time_start))
+	if errors.Is(err, errKeyNotFound) {
+		return val, ErrNotFound
+	} else if err != nil {
+		return val, err
+	}
+	err = json.Unmarshal(data, &val)
+	return val, err
+}
+
+// Insert stores a record under both the avatar name and the UUID (in canonical form), so that we can look up either,
+// and adds both to the Bloom filter.
+func (s *Store) Insert(record AvatarUUID) error {
+	record.AvatarName, record.UUID = strings.TrimSpace(record.AvatarName), canonicalUUID(strings.TrimSpace(record.UUID))
+	if record.AvatarName == "" || !isValidUUID(record.UUID) {
+		return fmt.Errorf("invalid record %+v: both a name and a valid UUID are required", record)
+	}
+	jsonRecord, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err = s.db.put([]kvPair{{record.AvatarName, jsonRecord}, {record.UUID, jsonRecord}}); err != nil {
+		return err
+	}
+	s.bloomAdd(record.AvatarName, record.UUID)
+	s.counters.inserts.Add(1)
+	return nil
+}
+
+// ReadOnly is true if the database cannot be changed, in which case Insert and Delete always
+// return errors wrapping ErrReadOnly.
+func (s *Store) ReadOnly() bool {
+	ro, ok := s.db.(readOnlyBackend)
+	return ok && ro.readOnly()
+}
+
+// Delete removes a record, i.e. both the entry for the avatar name and the one for the UUID;
+// empty fields are skipped, so it can also be used to remove just one of them.
+// Bloom filters cannot forget anything, but that's fine: a deleted entry just means a false positive.
+func (s *Store) Delete(record AvatarUUID) error {
+	keys := make([]string, 0, 2)
+	for _, key := range []string{record.AvatarName, canonicalUUID(strings.TrimSpace(record.UUID))} {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := s.db.delete(keys); err != nil {
+		return err
+	}
+	s.counters.deletes.Add(1)
+	return nil
+}
+
+// Scan calls fn for every record stored under a key (name or UUID) starting with prefix,
+// until fn returns false. Note that each record is usually found twice, under its name and its UUID.
+// Records which cannot be decoded are logged and skipped.
+func (s *Store) Scan(prefix string, fn func(key string, record AvatarUUID) bool) error {
+	return s.db.scan(prefix, func(key string, value []byte) bool {
+		var record AvatarUUID
+		if err := json.Unmarshal(value, &record); err != nil {
+			log.Warningf("skipping undecodable record under %q: %v\n", key, err)
+			return true
+		}
+		return fn(key, record)
+	})
+}
@@ -0,0 +1,70 @@
+// Checks that concurrent lookups for the same item share a single read from the backend, and that empty ones never get that far.
+package gosl
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedBackend counts reads, and holds them until the gate is opened.
+type gatedBackend struct {
+	backend
+	gate  chan struct{}
+	reads *atomic.Int32
+}
+
+func (b gatedBackend) get(key string) ([]byte, error) {
+	b.reads.Add(1)
+	<-b.gate
+	return b.backend.get(key)
+}
+
+func TestLookupsAreCoalesced(t *testing.T) {
+	store := openMemoryStore(t)
+	record := AvatarUUID{"Resident One", "a2e76fcd-9360-4f6d-a924-000000000001", "Production"}
+	if err := store.Insert(record); err != nil {
+		t.Fatal(err)
+	}
+	gate, reads := make(chan struct{}), new(atomic.Int32)
+	store.db = gatedBackend{store.db, gate, reads}
+
+	const lookups = 10
+	var wg sync.WaitGroup
+	for range lookups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The name is normalised before being coalesced.
+			if found, err := store.Lookup("  Resident One "); err != nil || found != record {
+				t.Errorf("Lookup() = %+v, %v", found, err)
+			}
+		}()
+	}
+	// Give all of them the time to pile up behind the first read.
+	time.Sleep(100 * time.Millisecond)
+	close(gate)
+	wg.Wait()
+
+	stats := store.Stats()
+	if n := int(reads.Load()); n >= lookups || uint64(lookups-n) != stats.Coalesced {
+		t.Errorf("%d concurrent lookups made %d reads, and %d were coalesced", lookups, n, stats.Coalesced)
+	}
+	if stats.Lookups != lookups || stats.Hits != lookups {
+		t.Errorf("after %d lookups, stats = %+v", lookups, stats)
+	}
+}
+
+func TestEmptyLookupIsAPlainMiss(t *testing.T) {
+	store := openMemoryStore(t)
+	for _, query := range []string{"", "   "} {
+		if _, err := store.Lookup(query); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Lookup(%q) = %v, want ErrNotFound", query, err)
+		}
+	}
+	if stats := store.Stats(); stats.Misses != 2 || stats.BloomRejected != 0 {
+		t.Errorf("after two empty lookups, stats = %+v", stats)
+	}
+}